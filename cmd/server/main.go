@@ -7,16 +7,22 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 
 	"message-transformer/internal/api"
+	"message-transformer/internal/bridge"
 	"message-transformer/internal/config"
 	"message-transformer/internal/metrics"
 	"message-transformer/internal/mqtt"
+	"message-transformer/internal/pipeline"
+	"message-transformer/internal/queue"
+	"message-transformer/internal/sink"
 	"message-transformer/internal/transformer"
+	"message-transformer/internal/webhook"
 	"message-transformer/pkg/logger"
 )
 
@@ -61,36 +67,94 @@ func main() {
 		log.Fatal("Failed to initialize transformer", zap.Error(err))
 	}
 
+	// Open the store-and-forward queue if enabled
+	var publishQueue *queue.Queue
+	if cfg.Queue.Enabled {
+		publishQueue, err = queue.Open(queue.Config{
+			Directory:   cfg.Queue.Directory,
+			MaxMessages: cfg.Queue.MaxMessages,
+			MaxBytes:    cfg.Queue.MaxBytes,
+			MaxAge:      time.Duration(cfg.Queue.MaxAge) * time.Second,
+		}, log, metricsRecorder)
+		if err != nil {
+			log.Fatal("Failed to open publish queue", zap.Error(err))
+		}
+	}
+
 	// Initialize MQTT client with metrics
-	mqttClient, err := mqtt.New(mqtt.Config{
-		Broker:   cfg.MQTT.Broker,
-		ClientID: cfg.MQTT.ClientID,
-		Username: cfg.MQTT.Username,
-		Password: cfg.MQTT.Password,
-		TLS: mqtt.TLSConfig{
-			Enabled: cfg.MQTT.TLS.Enabled,
-			CACert:  cfg.MQTT.TLS.CACert,
-			Cert:    cfg.MQTT.TLS.Cert,
-			Key:     cfg.MQTT.TLS.Key,
-		},
-		Reconnect: mqtt.ReconnectConfig{
-			Initial:    cfg.MQTT.Reconnect.Initial,
-			MaxDelay:   cfg.MQTT.Reconnect.MaxDelay,
-			MaxRetries: cfg.MQTT.Reconnect.MaxRetries,
-		},
-	}, log, metricsRecorder)
+	mqttClient, err := newMQTTClient(config.SinkMQTT, cfg.MQTT, publishQueue, log, metricsRecorder)
 	if err != nil {
 		log.Fatal("Failed to initialize MQTT client", zap.Error(err))
 	}
 
+	// Connect to the named brokers, which do not queue messages
+	brokers := []*mqtt.Client{mqttClient}
+	brokerNames := make([]string, 0, len(cfg.Brokers))
+	for name := range cfg.Brokers {
+		brokerNames = append(brokerNames, name)
+	}
+	sort.Strings(brokerNames)
+	for _, name := range brokerNames {
+		client, err := newMQTTClient(name, cfg.Brokers[name], nil, log, metricsRecorder)
+		if err != nil {
+			log.Fatal("Failed to initialize MQTT client",
+				zap.Error(err),
+				zap.String("broker", name))
+		}
+		brokers = append(brokers, client)
+	}
+
+	// Create the output sinks, with the MQTT client as the default
+	webhooks := webhook.New(log, metricsRecorder)
+	sinks, err := sink.New(cfg.Sinks, brokers, webhooks, log, metricsRecorder)
+	if err != nil {
+		log.Fatal("Failed to initialize sinks", zap.Error(err))
+	}
+	if err := sinks.ValidateRules(rules); err != nil {
+		log.Fatal("Failed to load rules", zap.Error(err))
+	}
+
+	// Subscribe to the topics of MQTT source rules and deliver webhooks
+	mqttBridge := bridge.New(log, transform, sinks, webhooks)
+	mqttBridge.ApplyRules(rules)
+
+	// Start the asynchronous publish pipeline if enabled
+	var publishPipeline *pipeline.Pipeline
+	if cfg.Async.Enabled {
+		publishPipeline = pipeline.New(pipeline.Config{
+			Workers:   cfg.Async.WorkerCount(),
+			QueueSize: cfg.Async.QueueCapacity(),
+			StatusTTL: time.Duration(cfg.Async.StatusRetention()) * time.Second,
+		}, log, metricsRecorder)
+	}
+
 	// Initialize HTTP server with metrics
-	server := api.NewServer(api.ServerConfig{
-		Logger:      log,
-		Rules:       rules,
-		Transformer: transform,
-		MQTT:        mqttClient,
-		Metrics:     metricsRecorder,
-	})
+	serverCfg := api.ServerConfig{
+		Logger:         log,
+		Rules:          rules,
+		Transformer:    transform,
+		Sinks:          sinks,
+		MQTT:           mqttClient,
+		Pipeline:       publishPipeline,
+		Metrics:        metricsRecorder,
+		RulesDirectory: cfg.Rules.Directory,
+		OnRulesApplied: mqttBridge.ApplyRules,
+	}
+	if cfg.Admin.Enabled {
+		serverCfg.AdminToken = cfg.Admin.Token
+	}
+	server := api.NewServer(serverCfg)
+
+	// Watch the rules directory for changes if enabled
+	if cfg.Rules.Watch {
+		watcher, err := config.NewWatcher(cfg.Rules.Directory, log, metricsRecorder, server.ReloadRules)
+		if err != nil {
+			log.Fatal("Failed to initialize rules watcher", zap.Error(err))
+		}
+		watcher.WatchSchemas(rules)
+		watcher.Start()
+		defer watcher.Close()
+	}
 
 	httpServer := &http.Server{
 		Addr:           fmt.Sprintf("%s:%d", cfg.API.Host, cfg.API.Port),
@@ -122,16 +186,68 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
+	// Stop accepting requests and wait for those in progress, which may
+	// still submit to the pipeline or publish to the sinks
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Error("HTTP server shutdown failed", zap.Error(err))
+	}
+
 	// Update metrics before shutdown
 	server.Shutdown()
 
-	// Close MQTT client (this will update MQTT connection metric)
-	mqttClient.Close()
+	// Publish the messages still waiting in the pipeline. Close returns once
+	// the workers have stopped, cancelling them if this takes too long, so
+	// the sinks are no longer in use when they are closed below.
+	if publishPipeline != nil {
+		if err := publishPipeline.Close(shutdownCtx); err != nil {
+			log.Error("Publish pipeline shutdown failed", zap.Error(err))
+		}
+	}
 
-	// Shutdown HTTP server
-	if err := httpServer.Shutdown(shutdownCtx); err != nil {
-		log.Error("HTTP server shutdown failed", zap.Error(err))
+	// Finish the queued webhook deliveries of MQTT source rules
+	if err := mqttBridge.Close(shutdownCtx); err != nil {
+		log.Error("Webhook delivery shutdown failed", zap.Error(err))
+	}
+
+	// Close the sinks, then the MQTT clients (this will update MQTT
+	// connection metrics)
+	sinks.Close()
+	for _, client := range brokers {
+		client.Close()
 	}
 
 	log.Info("Shutdown complete")
 }
+
+// newMQTTClient connects to a broker under the given name. A nil queue
+// disables store-and-forward for the connection.
+func newMQTTClient(name string, cfg config.MQTTConfig, publishQueue *queue.Queue, log *zap.Logger, metricsRecorder metrics.Recorder) (*mqtt.Client, error) {
+	mqttCfg := mqtt.Config{
+		Name:     name,
+		Broker:   cfg.Broker,
+		ClientID: cfg.ClientID,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Failover: cfg.Failover,
+		// Failing back is disabled unless an interval is configured
+		FailbackInterval: time.Duration(cfg.Failback) * time.Second,
+		// Protocol version 0 selects the default MQTT 3.1.1 client
+		ProtocolVersion: cfg.ProtocolVersion,
+		TLS: mqtt.TLSConfig{
+			Enabled: cfg.TLS.Enabled,
+			CACert:  cfg.TLS.CACert,
+			Cert:    cfg.TLS.Cert,
+			Key:     cfg.TLS.Key,
+		},
+		Reconnect: mqtt.ReconnectConfig{
+			Initial:    cfg.Reconnect.Initial,
+			MaxDelay:   cfg.Reconnect.MaxDelay,
+			MaxRetries: cfg.Reconnect.MaxRetries,
+		},
+	}
+	// A typed nil queue would not disable queueing
+	if publishQueue != nil {
+		mqttCfg.Queue = publishQueue
+	}
+	return mqtt.New(mqttCfg, log, metricsRecorder)
+}
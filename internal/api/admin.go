@@ -0,0 +1,261 @@
+//file: internal/api/admin.go
+
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+)
+
+// Admin API errors
+var (
+	errRuleNotFound = errors.New("rule not found")
+	errRuleExists   = errors.New("rule already exists")
+)
+
+// handleListRules returns a handler that lists all active rules
+func (s *Server) handleListRules() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bw, done := s.bufferedWriter(w)
+		defer done()
+
+		rules := s.Rules()
+		JSONResponse(bw, http.StatusOK, struct {
+			Rules []config.Rule `json:"rules"`
+			Count int           `json:"count"`
+		}{
+			Rules: rules,
+			Count: len(rules),
+		})
+	}
+}
+
+// handleGetRule returns a handler that fetches a single rule by ID
+func (s *Server) handleGetRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bw, done := s.bufferedWriter(w)
+		defer done()
+
+		rule, ok := s.ruleByID(chi.URLParam(r, "id"))
+		if !ok {
+			SendError(bw, http.StatusNotFound, "Rule not found")
+			return
+		}
+		JSONResponse(bw, http.StatusOK, rule)
+	}
+}
+
+// handleCreateRule returns a handler that creates and persists a new rule
+func (s *Server) handleCreateRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bw, done := s.bufferedWriter(w)
+		defer done()
+
+		rule, ok := s.readRule(bw, r)
+		if !ok {
+			return
+		}
+
+		fileName, err := config.RuleFileName(rule.ID)
+		if err != nil {
+			SendErrorDetails(bw, http.StatusBadRequest, "Rule validation failed", err)
+			return
+		}
+		rule.File = fileName
+
+		s.reloadMu.Lock()
+		defer s.reloadMu.Unlock()
+
+		current := s.Rules()
+		for _, existing := range current {
+			if existing.ID == rule.ID || existing.File == rule.File {
+				s.sendRuleError(bw, errRuleExists, rule.ID)
+				return
+			}
+		}
+
+		candidate := append(current, rule)
+		if err := s.commitRules(candidate, func() error {
+			return config.SaveRule(s.rulesDir, rule)
+		}); err != nil {
+			s.sendRuleError(bw, err, rule.ID)
+			return
+		}
+
+		s.logger.Info("Rule created via admin API",
+			zap.String("rule_id", rule.ID),
+			zap.String("file", rule.File))
+		JSONResponse(bw, http.StatusCreated, rule)
+	}
+}
+
+// handleUpdateRule returns a handler that replaces an existing rule
+func (s *Server) handleUpdateRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bw, done := s.bufferedWriter(w)
+		defer done()
+
+		id := chi.URLParam(r, "id")
+		rule, ok := s.readRule(bw, r)
+		if !ok {
+			return
+		}
+		if rule.ID != id {
+			SendErrorDetails(bw, http.StatusBadRequest, "Rule validation failed", config.ValidationErrors{{
+				Field:   "id",
+				Message: "rule ID does not match the URL",
+			}})
+			return
+		}
+
+		s.reloadMu.Lock()
+		defer s.reloadMu.Unlock()
+
+		current := s.Rules()
+		index := -1
+		for i, existing := range current {
+			if existing.ID == id {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			s.sendRuleError(bw, errRuleNotFound, id)
+			return
+		}
+
+		rule.File = current[index].File
+		candidate := current
+		candidate[index] = rule
+		if err := s.commitRules(candidate, func() error {
+			return config.SaveRule(s.rulesDir, rule)
+		}); err != nil {
+			s.sendRuleError(bw, err, id)
+			return
+		}
+
+		s.logger.Info("Rule updated via admin API",
+			zap.String("rule_id", rule.ID),
+			zap.String("file", rule.File))
+		JSONResponse(bw, http.StatusOK, rule)
+	}
+}
+
+// handleDeleteRule returns a handler that removes a rule and its file
+func (s *Server) handleDeleteRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bw, done := s.bufferedWriter(w)
+		defer done()
+
+		id := chi.URLParam(r, "id")
+
+		s.reloadMu.Lock()
+		defer s.reloadMu.Unlock()
+
+		current := s.Rules()
+		candidate := make([]config.Rule, 0, len(current))
+		var removed *config.Rule
+		for i := range current {
+			if current[i].ID == id {
+				removed = &current[i]
+				continue
+			}
+			candidate = append(candidate, current[i])
+		}
+		if removed == nil {
+			s.sendRuleError(bw, errRuleNotFound, id)
+			return
+		}
+
+		if err := s.commitRules(candidate, func() error {
+			return config.DeleteRule(s.rulesDir, *removed)
+		}); err != nil {
+			s.sendRuleError(bw, err, id)
+			return
+		}
+
+		s.logger.Info("Rule deleted via admin API",
+			zap.String("rule_id", id),
+			zap.String("file", removed.File))
+		bw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// readRule decodes and validates a rule from the request body, writing an
+// error response and returning false if it is invalid
+func (s *Server) readRule(w http.ResponseWriter, r *http.Request) (config.Rule, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		SendError(w, http.StatusBadRequest, "Failed to read request body")
+		return config.Rule{}, false
+	}
+	defer r.Body.Close()
+
+	rule, err := config.ParseRule(body, s.rulesDir)
+	if err != nil {
+		var validationErrs config.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			SendErrorDetails(w, http.StatusBadRequest, "Rule validation failed", validationErrs)
+			return config.Rule{}, false
+		}
+		SendError(w, http.StatusBadRequest, "Invalid rule JSON")
+		return config.Rule{}, false
+	}
+
+	return rule, true
+}
+
+// commitRules applies a new rule set and persists the change, restoring the
+// previous rule set if persisting fails. Callers must hold reloadMu.
+func (s *Server) commitRules(rules []config.Rule, persist func() error) error {
+	previous := s.Rules()
+	if err := s.applyRules(rules); err != nil {
+		return err
+	}
+
+	if err := persist(); err != nil {
+		if rollbackErr := s.applyRules(previous); rollbackErr != nil {
+			s.logger.Error("Failed to restore previous rules",
+				zap.Error(rollbackErr))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// sendRuleError maps admin rule errors to HTTP responses
+func (s *Server) sendRuleError(w http.ResponseWriter, err error, ruleID string) {
+	var validationErrs config.ValidationErrors
+	switch {
+	case errors.Is(err, errRuleNotFound):
+		SendError(w, http.StatusNotFound, "Rule not found")
+	case errors.Is(err, errRuleExists):
+		SendError(w, http.StatusConflict, "Rule already exists")
+	case errors.As(err, &validationErrs):
+		SendErrorDetails(w, http.StatusConflict, "Rule conflicts with existing rules", validationErrs)
+	default:
+		s.logger.Error("Failed to update rules",
+			zap.Error(err),
+			zap.String("rule_id", ruleID))
+		SendError(w, http.StatusInternalServerError, "Failed to update rules")
+	}
+}
+
+// ruleByID looks up an active rule by its ID
+func (s *Server) ruleByID(id string) (config.Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, rule := range s.rules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return config.Rule{}, false
+}
@@ -0,0 +1,270 @@
+//file: internal/api/admin_test.go
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+)
+
+const testAdminToken = "secret"
+
+// newAdminServer creates a server with the admin API enabled, storing rules
+// in the directory
+func newAdminServer(t *testing.T, dir string, rules ...string) *Server {
+	t.Helper()
+
+	cfg := testServerConfig(t, []config.SinkConfig{{Name: "out", Type: config.SinkNull}}, nil, rules...)
+	cfg.AdminToken = testAdminToken
+	cfg.RulesDirectory = dir
+	return NewServer(cfg)
+}
+
+// adminRequest sends an authenticated admin API request to the server
+func adminRequest(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+// adminRule returns a rule definition for the admin API
+func adminRule(id, path, value string) string {
+	return `{
+		"id": "` + id + `",
+		"api": {"method": "POST", "path": "` + path + `"},
+		"transform": {"template": "{\"v\": ` + value + `}"},
+		"target": {"topic": "out", "sink": "out"}
+	}`
+}
+
+func TestAdminRules(t *testing.T) {
+	dir := t.TempDir()
+	s := newAdminServer(t, dir)
+
+	// Each step runs against the rules left by the previous ones
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		// wantFiles are the rule files expected in the directory afterwards
+		wantFiles []string
+		// wantServed maps API paths to the value their rule transforms to,
+		// zero for paths that are not served
+		wantServed map[string]float64
+	}{
+		{name: "list empty", method: http.MethodGet, path: "/admin/rules", wantCode: http.StatusOK},
+		{
+			name:       "create",
+			method:     http.MethodPost,
+			path:       "/admin/rules",
+			body:       adminRule("a", "/a", "1"),
+			wantCode:   http.StatusCreated,
+			wantFiles:  []string{"a.json"},
+			wantServed: map[string]float64{"/a": 1},
+		},
+		{
+			name:      "create duplicate",
+			method:    http.MethodPost,
+			path:      "/admin/rules",
+			body:      adminRule("a", "/other", "2"),
+			wantCode:  http.StatusConflict,
+			wantFiles: []string{"a.json"},
+		},
+		{
+			name:       "create conflicting route",
+			method:     http.MethodPost,
+			path:       "/admin/rules",
+			body:       adminRule("b", "/a", "2"),
+			wantCode:   http.StatusConflict,
+			wantFiles:  []string{"a.json"},
+			wantServed: map[string]float64{"/a": 1},
+		},
+		{
+			name:      "create invalid",
+			method:    http.MethodPost,
+			path:      "/admin/rules",
+			body:      `{"id": "c", "api": {"method": "POST", "path": "/c"}}`,
+			wantCode:  http.StatusBadRequest,
+			wantFiles: []string{"a.json"},
+		},
+		{
+			name:   "create unescapable template",
+			method: http.MethodPost,
+			path:   "/admin/rules",
+			body: `{
+				"id": "c",
+				"api": {"method": "POST", "path": "/c"},
+				"transform": {"template": "{{define \"v\"}}{{.}}{{end}}{\"v\": \"{{template \"v\" .v}}\"}", "escape": "json"},
+				"target": {"topic": "out", "sink": "out"}
+			}`,
+			wantCode:  http.StatusBadRequest,
+			wantFiles: []string{"a.json"},
+		},
+		{name: "create unparsable", method: http.MethodPost, path: "/admin/rules", body: `{"id":`, wantCode: http.StatusBadRequest},
+		{name: "get", method: http.MethodGet, path: "/admin/rules/a", wantCode: http.StatusOK},
+		{name: "get missing", method: http.MethodGet, path: "/admin/rules/missing", wantCode: http.StatusNotFound},
+		{
+			name:       "update",
+			method:     http.MethodPut,
+			path:       "/admin/rules/a",
+			body:       adminRule("a", "/a", "3"),
+			wantCode:   http.StatusOK,
+			wantFiles:  []string{"a.json"},
+			wantServed: map[string]float64{"/a": 3},
+		},
+		{
+			name:       "update with another ID",
+			method:     http.MethodPut,
+			path:       "/admin/rules/a",
+			body:       adminRule("b", "/a", "4"),
+			wantCode:   http.StatusBadRequest,
+			wantServed: map[string]float64{"/a": 3},
+		},
+		{name: "update missing", method: http.MethodPut, path: "/admin/rules/b", body: adminRule("b", "/b", "4"), wantCode: http.StatusNotFound},
+		{
+			name:       "delete",
+			method:     http.MethodDelete,
+			path:       "/admin/rules/a",
+			wantCode:   http.StatusNoContent,
+			wantFiles:  []string{},
+			wantServed: map[string]float64{"/a": 0},
+		},
+		{name: "delete missing", method: http.MethodDelete, path: "/admin/rules/a", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := adminRequest(s, tt.method, tt.path, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("%s %s status = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.wantCode, rec.Body)
+			}
+
+			if tt.wantFiles != nil {
+				var files []string
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, entry := range entries {
+					files = append(files, entry.Name())
+				}
+				if strings.Join(files, ",") != strings.Join(tt.wantFiles, ",") {
+					t.Errorf("rule files = %v, want %v", files, tt.wantFiles)
+				}
+			}
+
+			for path, want := range tt.wantServed {
+				code, got := transformed(t, s, path)
+				if want == 0 {
+					if code != http.StatusNotFound {
+						t.Errorf("POST %s status = %d, want %d", path, code, http.StatusNotFound)
+					}
+					continue
+				}
+				var msg struct {
+					V float64 `json:"v"`
+				}
+				if code != http.StatusOK || json.Unmarshal([]byte(got), &msg) != nil || msg.V != want {
+					t.Errorf("POST %s = %d %s, want v %v", path, code, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminRulesSavedRuleMatchesActiveRule(t *testing.T) {
+	dir := t.TempDir()
+	s := newAdminServer(t, dir)
+	if rec := adminRequest(s, http.MethodPost, "/admin/rules", adminRule("a", "/a", "1")); rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body)
+	}
+
+	rules, err := config.LoadRules(dir, zap.NewNop())
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	if len(rules) != 1 || !rules[0].SameDefinition(&s.Rules()[0]) {
+		t.Errorf("saved rules = %+v, want the active rule", rules)
+	}
+}
+
+func TestAdminRulesRestoredWhenPersistingFails(t *testing.T) {
+	// A file in place of the rules directory makes every write fail
+	dir := filepath.Join(t.TempDir(), "rules")
+	if err := os.WriteFile(dir, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newAdminServer(t, dir, adminRule("a", "/a", "1"))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "create", method: http.MethodPost, path: "/admin/rules", body: adminRule("b", "/b", "2")},
+		{name: "update", method: http.MethodPut, path: "/admin/rules/a", body: adminRule("a", "/a", "3")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := adminRequest(s, tt.method, tt.path, tt.body)
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusInternalServerError, rec.Body)
+			}
+
+			if rules := s.Rules(); len(rules) != 1 || rules[0].ID != "a" {
+				t.Errorf("active rules = %+v, want only rule a", rules)
+			}
+			if code, got := transformed(t, s, "/a"); code != http.StatusOK || got != `{"v":1}` {
+				t.Errorf("POST /a = %d %s, want the previous rule's output", code, got)
+			}
+			if code, _ := transformed(t, s, "/b"); code != http.StatusNotFound {
+				t.Errorf("POST /b status = %d, want %d", code, http.StatusNotFound)
+			}
+		})
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	s := newAdminServer(t, t.TempDir())
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      int
+	}{
+		{name: "token", authorization: "Bearer " + testAdminToken, wantCode: http.StatusOK},
+		{name: "wrong token", authorization: "Bearer other", wantCode: http.StatusUnauthorized},
+		{name: "no scheme", authorization: testAdminToken, wantCode: http.StatusUnauthorized},
+		{name: "missing", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/rules", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+//file: internal/api/async.go
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/metrics"
+	"message-transformer/internal/pipeline"
+	"message-transformer/internal/transformer"
+)
+
+// acceptedResponse answers a request whose messages were queued for
+// asynchronous publishing
+type acceptedResponse struct {
+	Status      string      `json:"status"`
+	RuleID      string      `json:"rule_id"`
+	MessageID   string      `json:"message_id"`
+	Route       string      `json:"route,omitempty"`
+	Topic       string      `json:"topic,omitempty"`
+	Transformed interface{} `json:"transformed,omitempty"`
+}
+
+// submitMessages queues the messages of a single target for publishing and
+// answers with the message ID their status can be queried by
+func (s *Server) submitMessages(rule config.Rule, route string, target transformer.TargetResult) (int, interface{}) {
+	messages := target.Messages
+	preview, err := decodeMessages(messages, target.Target.Transform.Fanout())
+	if err != nil {
+		s.logger.Error("Failed to parse transformed data for response",
+			zap.Error(err),
+			zap.String("rule_id", rule.ID))
+		return http.StatusInternalServerError, ErrorResponse{Error: "Internal server error"}
+	}
+
+	id, err := s.pipeline.Submit(rule.ID, func(ctx context.Context) pipeline.Result {
+		queued, err := s.publishMessages(ctx, rule, messages)
+		switch {
+		case err != nil:
+			return pipeline.Result{Status: metrics.JobFailed, Error: "Failed to publish message"}
+		case queued:
+			return pipeline.Result{Status: metrics.JobQueued}
+		default:
+			return pipeline.Result{Status: metrics.JobPublished}
+		}
+	})
+	if err != nil {
+		return s.submitErrorResponse(rule, err)
+	}
+
+	return http.StatusAccepted, acceptedResponse{
+		Status:      "accepted",
+		RuleID:      rule.ID,
+		MessageID:   id,
+		Route:       route,
+		Topic:       messagesTopic(messages),
+		Transformed: preview,
+	}
+}
+
+// submitTargets queues the targets of a multi-target rule for publishing
+// according to its partial failure policy. Transform errors that prevent
+// publishing are reported immediately; per-target results are reported as
+// the details of the message status.
+func (s *Server) submitTargets(rule config.Rule, results []transformer.TargetResult) (int, interface{}) {
+	resp, ok := s.transformedTargets(rule, results)
+	if !ok {
+		return http.StatusUnprocessableEntity, resp
+	}
+
+	id, err := s.pipeline.Submit(rule.ID, func(ctx context.Context) pipeline.Result {
+		s.publishTransformedTargets(ctx, rule, results, &resp)
+		return pipeline.Result{Status: resp.Status, Details: resp.Targets}
+	})
+	if err != nil {
+		return s.submitErrorResponse(rule, err)
+	}
+
+	return http.StatusAccepted, acceptedResponse{
+		Status:    "accepted",
+		RuleID:    rule.ID,
+		MessageID: id,
+	}
+}
+
+// submitErrorResponse maps pipeline errors to HTTP responses
+func (s *Server) submitErrorResponse(rule config.Rule, err error) (int, interface{}) {
+	if errors.Is(err, pipeline.ErrFull) {
+		s.logger.Warn("Publish queue is full, rejecting request",
+			zap.String("rule_id", rule.ID))
+		return http.StatusTooManyRequests, ErrorResponse{Error: "Publish queue is full"}
+	}
+	s.logger.Error("Failed to queue message",
+		zap.Error(err),
+		zap.String("rule_id", rule.ID))
+	return http.StatusServiceUnavailable, ErrorResponse{Error: "Failed to publish message"}
+}
+
+// handleMessageStatus returns a handler that reports the status of an
+// asynchronously published message
+func (s *Server) handleMessageStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bw, done := s.bufferedWriter(w)
+		defer done()
+
+		status, ok := s.pipeline.Status(chi.URLParam(r, "id"))
+		if !ok {
+			SendError(bw, http.StatusNotFound, "Message not found")
+			return
+		}
+		JSONResponse(bw, http.StatusOK, status)
+	}
+}
@@ -0,0 +1,162 @@
+//file: internal/api/batch.go
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+)
+
+const contentTypeNDJSON = "application/x-ndjson"
+
+// batchItemResponse reports the outcome of a single batch element with the
+// status code and body it would have had as a request of its own
+type batchItemResponse struct {
+	Index  int         `json:"index"`
+	Code   int         `json:"code"`
+	Result interface{} `json:"result"`
+}
+
+// batchResponse reports the outcome of every element of a batch
+type batchResponse struct {
+	Status string              `json:"status"`
+	RuleID string              `json:"rule_id"`
+	Count  int                 `json:"count"`
+	Failed []int               `json:"failed"`
+	Items  []batchItemResponse `json:"items"`
+}
+
+// handleBatch handles a request for a batch rule. JSON arrays and
+// newline-delimited JSON are split into elements that are each validated,
+// transformed and published as if sent on their own; any other JSON body is
+// processed as a single message.
+func (s *Server) handleBatch(w ResponseWriter, r *http.Request, rule config.Rule) {
+	limit := rule.Batch.SizeLimit()
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		s.logger.Error("Failed to read request body",
+			zap.Error(err),
+			zap.String("rule_id", rule.ID))
+		SendError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	defer r.Body.Close()
+
+	if int64(len(body)) > limit {
+		SendError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Request body exceeds %d bytes", limit))
+		return
+	}
+
+	var items []json.RawMessage
+	switch {
+	case isNDJSON(r):
+		items, err = splitNDJSON(body)
+	case isJSONArray(body):
+		err = json.Unmarshal(body, &items)
+	default:
+		if !json.Valid(body) {
+			err = fmt.Errorf("invalid JSON")
+			break
+		}
+		code, resp := s.process(r.Context(), rule, body, transformRequest(r))
+		sendResult(w, code, resp)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Invalid JSON in batch request body",
+			zap.Error(err),
+			zap.String("rule_id", rule.ID))
+		SendError(w, http.StatusBadRequest, "Invalid JSON in request body")
+		return
+	}
+
+	if len(items) == 0 {
+		SendError(w, http.StatusBadRequest, "Batch contains no messages")
+		return
+	}
+	if max := rule.Batch.ItemLimit(); len(items) > max {
+		SendError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Batch exceeds %d messages", max))
+		return
+	}
+
+	resp := batchResponse{
+		RuleID: rule.ID,
+		Count:  len(items),
+		Failed: []int{},
+		Items:  make([]batchItemResponse, len(items)),
+	}
+	req := transformRequest(r)
+	accepted := false
+	for i, item := range items {
+		code, result := s.process(r.Context(), rule, item, req)
+		resp.Items[i] = batchItemResponse{Index: i, Code: code, Result: result}
+		switch code {
+		case http.StatusOK:
+		case http.StatusAccepted:
+			accepted = true
+		default:
+			resp.Failed = append(resp.Failed, i)
+		}
+	}
+
+	s.logger.Debug("Processed batch",
+		zap.String("rule_id", rule.ID),
+		zap.Int("count", len(items)),
+		zap.Int("failed", len(resp.Failed)))
+
+	// Queued and asynchronously published messages are only accepted
+	code := http.StatusOK
+	switch {
+	case len(resp.Failed) == len(items):
+		resp.Status = targetFailed
+		code = http.StatusUnprocessableEntity
+	case len(resp.Failed) > 0:
+		resp.Status = targetsPartial
+		code = http.StatusMultiStatus
+	case accepted:
+		resp.Status = "accepted"
+		code = http.StatusAccepted
+	default:
+		resp.Status = targetPublished
+	}
+	JSONResponse(w, code, resp)
+}
+
+// isNDJSON reports whether a request body is newline-delimited JSON
+func isNDJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == contentTypeNDJSON
+}
+
+// isJSONArray reports whether a JSON body holds an array
+func isJSONArray(body []byte) bool {
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// splitNDJSON splits newline-delimited JSON into its values, skipping blank
+// lines
+func splitNDJSON(body []byte) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	for i, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, fmt.Errorf("line %d is not valid JSON", i+1)
+		}
+		items = append(items, json.RawMessage(line))
+	}
+	return items, nil
+}
@@ -0,0 +1,226 @@
+//file: internal/api/batch_test.go
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"message-transformer/internal/config"
+)
+
+func TestSplitNDJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "lines", body: "{\"a\":1}\n{\"a\":2}\n", want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "no trailing newline", body: "{\"a\":1}\n{\"a\":2}", want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "crlf", body: "{\"a\":1}\r\n{\"a\":2}\r\n", want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "blank lines", body: "\n{\"a\":1}\n\n  \n{\"a\":2}\n", want: []string{`{"a":1}`, `{"a":2}`}},
+		{name: "scalars and arrays", body: "1\n\"text\"\n[1,2]\n", want: []string{`1`, `"text"`, `[1,2]`}},
+		{name: "empty", body: "", want: nil},
+		{name: "only blank lines", body: "\n \n", want: nil},
+		{name: "invalid line", body: "{\"a\":1}\n{\"a\":\n", wantErr: true},
+		{name: "value across lines", body: "{\n\"a\": 1\n}\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := splitNDJSON([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitNDJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, item := range items {
+				got = append(got, string(item))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitNDJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsJSONArray(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{name: "array", body: `[{"a":1}]`, want: true},
+		{name: "leading whitespace", body: " \r\n\t[1]", want: true},
+		{name: "object", body: `{"a":[1]}`},
+		{name: "string", body: `"[1]"`},
+		{name: "empty", body: ""},
+		{name: "whitespace", body: "  \n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isJSONArray([]byte(tt.body)); got != tt.want {
+				t.Errorf("isJSONArray(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsNDJSON(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{contentType: "application/x-ndjson", want: true},
+		{contentType: "application/x-ndjson; charset=utf-8", want: true},
+		{contentType: "Application/X-NDJSON", want: true},
+		{contentType: "application/json"},
+		{contentType: ""},
+		{contentType: "application/x-ndjson; ="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("Content-Type", tt.contentType)
+			if got := isNDJSON(r); got != tt.want {
+				t.Errorf("isNDJSON(%q) = %v, want %v", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantCode    int
+		wantFailed  []int
+		// wantValues are the values published to the sink, in order
+		wantValues []float64
+	}{
+		{
+			name:        "array",
+			contentType: "application/json",
+			body:        `[{"value": 1}, {"value": 2}]`,
+			wantCode:    http.StatusOK,
+			wantFailed:  []int{},
+			wantValues:  []float64{1, 2},
+		},
+		{
+			name:        "ndjson",
+			contentType: contentTypeNDJSON,
+			body:        "{\"value\": 1}\n\n{\"value\": 2}\n{\"value\": 3}\n",
+			wantCode:    http.StatusOK,
+			wantFailed:  []int{},
+			wantValues:  []float64{1, 2, 3},
+		},
+		{
+			name:        "single object",
+			contentType: "application/json",
+			body:        `{"value": 7}`,
+			wantCode:    http.StatusOK,
+			wantValues:  []float64{7},
+		},
+		{
+			name:        "some invalid",
+			contentType: "application/json",
+			body:        `[{"value": 1}, {"other": 2}, {"value": 3}]`,
+			wantCode:    http.StatusMultiStatus,
+			wantFailed:  []int{1},
+			wantValues:  []float64{1, 3},
+		},
+		{
+			name:        "all invalid",
+			contentType: "application/json",
+			body:        `[{"other": 1}, {"other": 2}]`,
+			wantCode:    http.StatusUnprocessableEntity,
+			wantFailed:  []int{0, 1},
+		},
+		{name: "empty array", contentType: "application/json", body: `[]`, wantCode: http.StatusBadRequest},
+		{name: "invalid json", contentType: "application/json", body: `[{"value": 1}`, wantCode: http.StatusBadRequest},
+		{name: "invalid ndjson", contentType: contentTypeNDJSON, body: "{\"value\": 1}\n{", wantCode: http.StatusBadRequest},
+		{
+			name:        "too many items",
+			contentType: "application/json",
+			body:        `[{"value": 1}, {"value": 2}, {"value": 3}, {"value": 4}]`,
+			wantCode:    http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:        "too large",
+			contentType: "application/json",
+			body:        `[{"value": 1, "padding": "` + strings.Repeat("x", 256) + `"}]`,
+			wantCode:    http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out.ndjson")
+			s := newTestServer(t, []config.SinkConfig{{Name: "out", Type: config.SinkFile, Path: output}}, nil, `{
+				"id": "readings",
+				"api": {"method": "POST", "path": "/api/v1/readings"},
+				"batch": {"maxItems": 3, "maxBytes": 256},
+				"schema": {"input": {"inline": {"type": "object", "required": ["value"]}}},
+				"transform": {"template": "{\"value\": {{.value}}}"},
+				"target": {"topic": "readings", "sink": "out"}
+			}`)
+
+			rec := post(s, "/api/v1/readings", tt.contentType, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantFailed != nil {
+				var resp batchResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(resp.Failed, tt.wantFailed) {
+					t.Errorf("failed = %v, want %v", resp.Failed, tt.wantFailed)
+				}
+			}
+
+			if got := publishedValues(t, output); !reflect.DeepEqual(got, tt.wantValues) {
+				t.Errorf("published values = %v, want %v", got, tt.wantValues)
+			}
+		})
+	}
+}
+
+// publishedValues reads the value field of the messages a file sink wrote
+func publishedValues(t *testing.T, path string) []float64 {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var values []float64
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var record struct {
+			Payload struct {
+				Value float64 `json:"value"`
+			} `json:"payload"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid sink record %q: %v", line, err)
+		}
+		values = append(values, record.Payload.Value)
+	}
+	return values
+}
@@ -3,47 +3,63 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
 
 	"message-transformer/internal/config"
+	"message-transformer/internal/sink"
 	"message-transformer/internal/transformer"
+	"message-transformer/internal/validator"
 )
 
 const (
 	maxRequestSize = 1 << 20 // 1MB
 )
 
+// bufferedWriter returns w as a ResponseWriter, wrapping it in a pooled
+// buffer if needed. The returned func must be called once the handler is done.
+func (s *Server) bufferedWriter(w http.ResponseWriter) (ResponseWriter, func()) {
+	if buffered, ok := w.(ResponseWriter); ok {
+		return buffered, func() {}
+	}
+
+	buffer := s.bufferPool.Get().([]byte)
+	buffered := newBufferedResponseWriter(w, buffer)
+	return buffered, func() {
+		buffered.Flush()
+		s.bufferPool.Put(buffer)
+	}
+}
+
 // handleHealth returns a handler for health check requests
 func (s *Server) handleHealth() http.HandlerFunc {
 	type healthResponse struct {
-		Status    string `json:"status"`
-		MQTTConn bool   `json:"mqtt_connected"`
+		Status   string                       `json:"status"`
+		MQTTConn bool                         `json:"mqtt_connected"`
+		Brokers  map[string]sink.BrokerStatus `json:"mqtt_brokers"`
+		Sinks    map[string]sink.Health       `json:"sinks"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get or create buffered writer
-		var bw ResponseWriter
-		if buffered, ok := w.(ResponseWriter); ok {
-			bw = buffered
-		} else {
-			buffer := s.bufferPool.Get().([]byte)
-			buffered := newBufferedResponseWriter(w, buffer)
-			defer func() {
-				buffered.Flush()
-				s.bufferPool.Put(buffer)
-			}()
-			bw = buffered
-		}
+		bw, done := s.bufferedWriter(w)
+		defer done()
 
 		resp := healthResponse{
-			Status:    "ok",
+			Status:   "ok",
 			MQTTConn: s.mqtt.IsConnected(),
+			Brokers:  s.sinks.Brokers(),
+			Sinks:    s.sinks.Health(),
 		}
 		JSONResponse(bw, http.StatusOK, resp)
 	}
@@ -53,17 +69,13 @@ func (s *Server) handleHealth() http.HandlerFunc {
 func (s *Server) handleTransform(rule config.Rule) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Get or create buffered writer
-		var bw ResponseWriter
-		if buffered, ok := w.(ResponseWriter); ok {
-			bw = buffered
-		} else {
-			buffer := s.bufferPool.Get().([]byte)
-			buffered := newBufferedResponseWriter(w, buffer)
-			defer func() {
-				buffered.Flush()
-				s.bufferPool.Put(buffer)
-			}()
-			bw = buffered
+		bw, done := s.bufferedWriter(w)
+		defer done()
+
+		// Batch rules accept several messages and larger bodies
+		if rule.Batch != nil {
+			s.handleBatch(bw, r, rule)
+			return
 		}
 
 		// Read request body with size limit
@@ -85,60 +97,264 @@ func (s *Server) handleTransform(rule config.Rule) http.HandlerFunc {
 			return
 		}
 
-		// Transform message using pre-compiled template
-		transformed, err := s.transformer.Transform(rule.ID, body)
-		if err != nil {
-			var transformErr *transformer.TransformError
-			if errors.As(err, &transformErr) {
-				s.logger.Error("Transform error",
-					zap.Error(transformErr.Err),
-					zap.String("message", transformErr.Message),
-					zap.String("rule_id", rule.ID))
-				SendError(bw, http.StatusUnprocessableEntity,
-					fmt.Sprintf("Transform error: %s", transformErr.Message))
-				return
+		// Reply rules answer with the reply instead of the published message
+		if rule.Reply != nil {
+			s.handleReply(bw, r, rule, body)
+			return
+		}
+
+		code, resp := s.process(r.Context(), rule, body, transformRequest(r))
+		sendResult(bw, code, resp)
+	}
+}
+
+// sendResult writes the response returned by process, asking the client to
+// retry later when the publish queue is full
+func sendResult(w http.ResponseWriter, code int, resp interface{}) {
+	if code == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+	JSONResponse(w, code, resp)
+}
+
+// transformRequest returns the details of an HTTP request that transforms
+// can use
+func transformRequest(r *http.Request) *transformer.Request {
+	req := &transformer.Request{
+		Headers:  r.Header,
+		Query:    r.URL.Query(),
+		RemoteIP: r.RemoteAddr,
+		ID:       middleware.GetReqID(r.Context()),
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req.RemoteIP = host
+	}
+
+	// Skip the catch-all parameter of the route serving the rules. Routing
+	// matches the escaped path, so values are unescaped here.
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		for i, key := range rctx.URLParams.Keys {
+			if key == "*" {
+				continue
+			}
+			if req.Params == nil {
+				req.Params = make(map[string]string)
+			}
+			value := rctx.URLParams.Values[i]
+			if unescaped, err := url.PathUnescape(value); err == nil {
+				value = unescaped
 			}
-			s.logger.Error("Unexpected transform error",
+			req.Params[key] = value
+		}
+	}
+	return req
+}
+
+// statusResponse reports a message that was accepted but not published
+type statusResponse struct {
+	Status string `json:"status"`
+	RuleID string `json:"rule_id"`
+	Route  string `json:"route,omitempty"`
+}
+
+// publishedResponse reports the messages published for a single target
+type publishedResponse struct {
+	Status      string      `json:"status"`
+	RuleID      string      `json:"rule_id"`
+	Route       string      `json:"route,omitempty"`
+	Topic       string      `json:"topic,omitempty"`
+	Transformed interface{} `json:"transformed"`
+}
+
+// process validates, transforms and publishes a single JSON payload and
+// returns the status code and body of the response
+func (s *Server) process(ctx context.Context, rule config.Rule, body []byte, req *transformer.Request) (int, interface{}) {
+	result, code, errResp := s.transformInput(ctx, rule, body, req)
+	if result == nil {
+		return code, errResp
+	}
+	if resp, unpublished := unpublishedResponse(rule, result); unpublished {
+		return http.StatusOK, resp
+	}
+
+	if len(rule.Targets) > 0 {
+		if s.pipeline != nil {
+			return s.submitTargets(rule, result.Targets)
+		}
+		return s.publishTargets(ctx, rule, result.Targets)
+	}
+
+	// Single target rules and routed rules publish to one target
+	target := result.Targets[0]
+	transformed := target.Messages
+	if err := target.Err; err != nil {
+		return s.transformErrorResponse(rule, err)
+	}
+
+	// In async mode messages are published by the pipeline's workers
+	if s.pipeline != nil {
+		return s.submitMessages(rule, result.Route, target)
+	}
+
+	queued, err := s.publishMessages(ctx, rule, transformed)
+	if err != nil {
+		return http.StatusServiceUnavailable, ErrorResponse{Error: "Failed to publish message"}
+	}
+
+	// Parse transformed data for response
+	preview, err := decodeMessages(transformed, target.Target.Transform.Fanout())
+	if err != nil {
+		s.logger.Error("Failed to parse transformed data for response",
+			zap.Error(err),
+			zap.String("rule_id", rule.ID))
+		return http.StatusInternalServerError, ErrorResponse{Error: "Internal server error"}
+	}
+
+	// Return success response with transformed data preview; queued
+	// messages are accepted for later delivery
+	status, code := "published", http.StatusOK
+	if queued {
+		status, code = "queued", http.StatusAccepted
+	}
+	return code, publishedResponse{
+		Status:      status,
+		RuleID:      rule.ID,
+		Route:       result.Route,
+		Topic:       messagesTopic(transformed),
+		Transformed: preview,
+	}
+}
+
+// handleReply transforms the payload of a reply rule, publishes it and
+// answers with the reply
+func (s *Server) handleReply(w ResponseWriter, r *http.Request, rule config.Rule, body []byte) {
+	result, code, errResp := s.transformInput(r.Context(), rule, body, transformRequest(r))
+	if result == nil {
+		JSONResponse(w, code, errResp)
+		return
+	}
+	if resp, unpublished := unpublishedResponse(rule, result); unpublished {
+		JSONResponse(w, http.StatusOK, resp)
+		return
+	}
+
+	target := result.Targets[0]
+	if err := target.Err; err != nil {
+		code, resp := s.transformErrorResponse(rule, err)
+		JSONResponse(w, code, resp)
+		return
+	}
+	s.requestReply(w, r, rule, target.Messages)
+}
+
+// transformInput validates a payload against the rule's input schema and
+// transforms it for every target using the pre-compiled transforms. If
+// either fails it returns no result but the error response.
+func (s *Server) transformInput(ctx context.Context, rule config.Rule, body []byte, req *transformer.Request) (*transformer.Result, int, interface{}) {
+	if err := s.validator.ValidatePayload(body, rule); err != nil {
+		var schemaErr *validator.SchemaError
+		if errors.As(err, &schemaErr) {
+			s.logger.Debug("Payload failed schema validation",
 				zap.Error(err),
 				zap.String("rule_id", rule.ID))
-			SendError(bw, http.StatusInternalServerError, "Internal server error")
-			return
+			return nil, http.StatusBadRequest, ErrorResponse{
+				Error:   "Payload does not match schema",
+				Details: schemaErr.Violations,
+			}
 		}
+		s.logger.Error("Payload validation error",
+			zap.Error(err),
+			zap.String("rule_id", rule.ID))
+		return nil, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"}
+	}
+
+	result, err := s.compiledRules(ctx).TransformRequest(rule.ID, body, req)
+	if err != nil {
+		code, resp := s.transformErrorResponse(rule, err)
+		return nil, code, resp
+	}
+	return result, 0, nil
+}
+
+// unpublishedResponse returns the response for filtered messages and
+// messages matching a drop route, which are accepted but not published
+func unpublishedResponse(rule config.Rule, result *transformer.Result) (statusResponse, bool) {
+	switch {
+	case result.Filtered:
+		return statusResponse{Status: "filtered", RuleID: rule.ID}, true
+	case result.Dropped:
+		return statusResponse{Status: "dropped", RuleID: rule.ID, Route: result.Route}, true
+	default:
+		return statusResponse{}, false
+	}
+}
+
+// transformErrorResponse logs a transform error and returns the error
+// response
+func (s *Server) transformErrorResponse(rule config.Rule, err error) (int, ErrorResponse) {
+	var transformErr *transformer.TransformError
+	if !errors.As(err, &transformErr) {
+		s.logger.Error("Unexpected transform error",
+			zap.Error(err),
+			zap.String("rule_id", rule.ID))
+		return http.StatusInternalServerError, ErrorResponse{Error: "Internal server error"}
+	}
 
-		// Publish to MQTT
-		if err := s.mqtt.Publish(
-			rule.Target.Topic,
-			rule.Target.QoS,
-			rule.Target.Retain,
-			transformed,
-		); err != nil {
-			s.logger.Error("Failed to publish to MQTT",
+	s.logger.Error("Transform error",
+		zap.Error(transformErr.Err),
+		zap.String("message", transformErr.Message),
+		zap.String("rule_id", rule.ID))
+	resp := ErrorResponse{Error: fmt.Sprintf("Transform error: %s", transformErr.Message)}
+	var schemaErr *validator.SchemaError
+	if errors.As(transformErr.Err, &schemaErr) {
+		resp.Details = schemaErr.Violations
+	}
+	return http.StatusUnprocessableEntity, resp
+}
+
+// publishMessages publishes each message to its sink in order, stopping at
+// the first failure. It reports whether any message was queued for later
+// delivery instead of published.
+func (s *Server) publishMessages(ctx context.Context, rule config.Rule, messages []transformer.Message) (bool, error) {
+	queued := false
+	for i, msg := range messages {
+		q, err := s.sinks.Publish(ctx, rule.ID, msg)
+		if err != nil {
+			s.logger.Error("Failed to publish message",
 				zap.Error(err),
 				zap.String("rule_id", rule.ID),
-				zap.String("topic", rule.Target.Topic))
-			SendError(bw, http.StatusServiceUnavailable, "Failed to publish message")
-			return
+				zap.String("sink", msg.Sink),
+				zap.String("topic", msg.Topic),
+				zap.Int("published", i),
+				zap.Int("total", len(messages)))
+			return queued, err
 		}
+		queued = queued || q
+	}
+	return queued, nil
+}
 
-		// Parse transformed data for response
-		var preview interface{}
-		if err := json.Unmarshal(transformed, &preview); err != nil {
-			s.logger.Error("Failed to parse transformed data for response",
-				zap.Error(err),
-				zap.String("rule_id", rule.ID))
-			SendError(bw, http.StatusInternalServerError, "Internal server error")
-			return
+// decodeMessages parses transformed messages for a response. Fan-out
+// transforms report every message as an array.
+func decodeMessages(messages []transformer.Message, fanout bool) (interface{}, error) {
+	previews := make([]interface{}, len(messages))
+	for i, msg := range messages {
+		if err := json.Unmarshal(msg.Payload, &previews[i]); err != nil {
+			return nil, err
 		}
+	}
+
+	if fanout {
+		return previews, nil
+	}
+	return previews[0], nil
+}
 
-		// Return success response with transformed data preview
-		JSONResponse(bw, http.StatusOK, struct {
-			Status      string      `json:"status"`
-			RuleID      string      `json:"rule_id"`
-			Transformed interface{} `json:"transformed"`
-		}{
-			Status:      "published",
-			RuleID:      rule.ID,
-			Transformed: preview,
-		})
+// messagesTopic returns the topic rendered for a set of messages, which all
+// share the topic rendered from the request
+func messagesTopic(messages []transformer.Message) string {
+	if len(messages) == 0 {
+		return ""
 	}
+	return messages[0].Topic
 }
@@ -0,0 +1,234 @@
+//file: internal/api/handler_test.go
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/pipeline"
+	"message-transformer/internal/sink"
+	"message-transformer/internal/transformer"
+)
+
+// newTestServer creates a server for the rules, given as JSON, publishing
+// to the sinks and through the pipeline if set
+func newTestServer(t *testing.T, sinks []config.SinkConfig, p *pipeline.Pipeline, rules ...string) *Server {
+	t.Helper()
+	return NewServer(testServerConfig(t, sinks, p, rules...))
+}
+
+// testServerConfig returns the configuration of a test server
+func testServerConfig(t *testing.T, sinks []config.SinkConfig, p *pipeline.Pipeline, rules ...string) ServerConfig {
+	t.Helper()
+
+	logger := zap.NewNop()
+	var parsed []config.Rule
+	for _, data := range rules {
+		rule, err := config.ParseRule([]byte(data), t.TempDir())
+		if err != nil {
+			t.Fatalf("ParseRule() error = %v", err)
+		}
+		parsed = append(parsed, rule)
+	}
+
+	tr, err := transformer.New(logger, parsed, nil)
+	if err != nil {
+		t.Fatalf("transformer.New() error = %v", err)
+	}
+	registry, err := sink.New(sinks, nil, nil, logger, nil)
+	if err != nil {
+		t.Fatalf("sink.New() error = %v", err)
+	}
+	t.Cleanup(func() { registry.Close() })
+
+	return ServerConfig{
+		Logger:      logger,
+		Rules:       parsed,
+		Transformer: tr,
+		Sinks:       registry,
+		Pipeline:    p,
+	}
+}
+
+// post sends a request to the server and returns the recorded response
+func post(s *Server, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAsyncPublishQueueFull(t *testing.T) {
+	// Without workers nothing leaves the queue, so it fills up
+	p := pipeline.New(pipeline.Config{Workers: 0, QueueSize: 2, StatusTTL: time.Minute}, zap.NewNop(), nil)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		p.Close(ctx)
+	})
+	s := newTestServer(t, []config.SinkConfig{{Name: "out", Type: config.SinkNull}}, p, `{
+		"id": "telemetry",
+		"api": {"method": "POST", "path": "/api/v1/telemetry"},
+		"transform": {"template": "{{toJSON .}}"},
+		"target": {"topic": "telemetry", "sink": "out"}
+	}`)
+
+	tests := []struct {
+		name           string
+		wantCode       int
+		wantRetryAfter string
+	}{
+		{name: "first accepted", wantCode: http.StatusAccepted},
+		{name: "second accepted", wantCode: http.StatusAccepted},
+		{name: "queue full", wantCode: http.StatusTooManyRequests, wantRetryAfter: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(s, "/api/v1/telemetry", "application/json", `{"value": 1}`)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if rec.Code != http.StatusAccepted {
+				return
+			}
+
+			var resp acceptedResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			status, ok := p.Status(resp.MessageID)
+			if !ok || status.Status != pipeline.StatusPending {
+				t.Errorf("message status = %+v, %v, want %s", status, ok, pipeline.StatusPending)
+			}
+		})
+	}
+}
+
+func TestPathParamRouting(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.ndjson")
+	s := newTestServer(t, []config.SinkConfig{{Name: "out", Type: config.SinkFile, Path: output}}, nil, `{
+		"id": "telemetry",
+		"api": {"method": "POST", "path": "/api/v1/devices/{deviceId}/telemetry/{seq:[0-9]+}"},
+		"transform": {"template": "{\"seq\": {{param \"seq\"}}}"},
+		"target": {"topic": "devices/{{param \"deviceId\"}}/telemetry", "sink": "out"}
+	}`)
+
+	tests := []struct {
+		name      string
+		path      string
+		wantCode  int
+		wantTopic string
+	}{
+		{name: "matching", path: "/api/v1/devices/d1/telemetry/7", wantCode: http.StatusOK, wantTopic: "devices/d1/telemetry"},
+		{name: "pattern mismatch", path: "/api/v1/devices/d1/telemetry/x", wantCode: http.StatusNotFound},
+		{name: "escaped value", path: "/api/v1/devices/pump%201/telemetry/7", wantCode: http.StatusOK, wantTopic: "devices/pump 1/telemetry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(s, tt.path, "application/json", `{}`)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantTopic == "" {
+				return
+			}
+
+			var resp struct {
+				Topic string `json:"topic"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Topic != tt.wantTopic {
+				t.Errorf("topic = %q, want %q", resp.Topic, tt.wantTopic)
+			}
+		})
+	}
+}
+
+func TestRouteResponses(t *testing.T) {
+	s := newTestServer(t, []config.SinkConfig{{Name: "out", Type: config.SinkNull}}, nil, `{
+		"id": "alerts",
+		"api": {"method": "POST", "path": "/alerts"},
+		"transform": {"template": "{{toJSON .}}"},
+		"routes": [
+			{"name": "heartbeat", "condition": ".type == \"heartbeat\"", "action": "drop"},
+			{"name": "battery", "condition": ".battery < 20", "topic": "alerts/battery", "sink": "out"}
+		]
+	}`)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   int
+		wantStatus string
+		wantRoute  string
+	}{
+		{name: "matching route", body: `{"battery": 15}`, wantCode: http.StatusOK, wantStatus: "published", wantRoute: "battery"},
+		{name: "drop route", body: `{"type": "heartbeat"}`, wantCode: http.StatusOK, wantStatus: "dropped", wantRoute: "heartbeat"},
+		{name: "no matching route", body: `{"battery": 80}`, wantCode: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(s, "/alerts", "application/json", tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantStatus == "" {
+				return
+			}
+
+			var resp statusResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.wantStatus || resp.Route != tt.wantRoute {
+				t.Errorf("response = %+v, want status %s and route %s", resp, tt.wantStatus, tt.wantRoute)
+			}
+		})
+	}
+}
+
+func TestFilteredResponse(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.ndjson")
+	s := newTestServer(t, []config.SinkConfig{{Name: "out", Type: config.SinkFile, Path: output}}, nil, `{
+		"id": "events",
+		"api": {"method": "POST", "path": "/events"},
+		"filter": ".type != \"heartbeat\"",
+		"transform": {"template": "{{toJSON .}}"},
+		"target": {"topic": "events", "sink": "out"}
+	}`)
+
+	rec := post(s, "/events", "application/json", `{"type": "heartbeat"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp statusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "filtered" || resp.RuleID != "events" {
+		t.Errorf("response = %+v, want status filtered", resp)
+	}
+	if data, err := os.ReadFile(output); err == nil && len(data) > 0 {
+		t.Errorf("filtered message was published: %s", data)
+	}
+}
@@ -3,8 +3,10 @@
 package api
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
@@ -75,6 +77,21 @@ func MetricsMiddleware(recorder metrics.Recorder) func(next http.Handler) http.H
 	}
 }
 
+// AdminAuth creates middleware that requires a bearer token for admin endpoints
+func AdminAuth(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				SendError(w, http.StatusUnauthorized, "Unauthorized")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // PrometheusMetricsHandler returns the Prometheus metrics HTTP handler
 func PrometheusMetricsHandler() http.Handler {
 	return promhttp.Handler()
@@ -89,10 +106,16 @@ func JSONResponse(w http.ResponseWriter, status int, data interface{}) {
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error   string      `json:"error"`
+	Details interface{} `json:"details,omitempty"`
 }
 
 // SendError sends an error response with the given status code
 func SendError(w http.ResponseWriter, status int, message string) {
 	JSONResponse(w, status, ErrorResponse{Error: message})
 }
+
+// SendErrorDetails sends an error response with structured details
+func SendErrorDetails(w http.ResponseWriter, status int, message string, details interface{}) {
+	JSONResponse(w, status, ErrorResponse{Error: message, Details: details})
+}
@@ -0,0 +1,295 @@
+//file: internal/api/preview.go
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/transformer"
+	"message-transformer/internal/validator"
+)
+
+// previewResponse describes what a transform would have published
+type previewResponse struct {
+	RuleID    string             `json:"rule_id,omitempty"`
+	Route     string             `json:"route,omitempty"`
+	Topic     string             `json:"topic,omitempty"`
+	Output    interface{}        `json:"output,omitempty"`
+	Outputs   []interface{}      `json:"outputs,omitempty"`
+	Target    *config.TargetMQTT `json:"target,omitempty"`
+	Published bool               `json:"published"`
+	Dropped   bool               `json:"dropped,omitempty"`
+	Filtered  bool               `json:"filtered,omitempty"`
+}
+
+// targetsPreviewResponse describes what each target of a rule would have
+// published
+type targetsPreviewResponse struct {
+	RuleID    string          `json:"rule_id"`
+	Targets   []targetPreview `json:"targets"`
+	Published bool            `json:"published"`
+}
+
+// targetPreview describes what a single target would have published
+type targetPreview struct {
+	Name    string               `json:"name"`
+	Topic   string               `json:"topic,omitempty"`
+	Output  interface{}          `json:"output,omitempty"`
+	Outputs []interface{}        `json:"outputs,omitempty"`
+	Target  config.TargetMQTT    `json:"target"`
+	Error   *templateErrorDetail `json:"error,omitempty"`
+}
+
+// templateErrorDetail locates a transform error for rule authors
+type templateErrorDetail struct {
+	Stage      string                      `json:"stage"`
+	Message    string                      `json:"message"`
+	Line       int                         `json:"line,omitempty"`
+	Column     int                         `json:"column,omitempty"`
+	Violations []validator.SchemaViolation `json:"violations,omitempty"`
+}
+
+// handlePreviewRule returns a handler that runs an existing rule against a
+// sample payload without publishing the result
+func (s *Server) handlePreviewRule() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bw, done := s.bufferedWriter(w)
+		defer done()
+
+		rule, ok := s.ruleByID(chi.URLParam(r, "id"))
+		if !ok {
+			SendError(bw, http.StatusNotFound, "Rule not found")
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+		if err != nil {
+			SendError(bw, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		defer r.Body.Close()
+
+		if !json.Valid(body) {
+			SendError(bw, http.StatusBadRequest, "Invalid JSON in request body")
+			return
+		}
+
+		s.sendPreview(bw, rule, body)
+	}
+}
+
+// handlePreviewTemplate returns a handler that runs an inline template or
+// transform against a sample payload without publishing the result
+func (s *Server) handlePreviewTemplate() http.HandlerFunc {
+	type previewRequest struct {
+		Template  string            `json:"template"`
+		Escape    string            `json:"escape"`
+		Transform *config.Transform `json:"transform"`
+		Target    config.TargetMQTT `json:"target"`
+		Payload   json.RawMessage   `json:"payload"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		bw, done := s.bufferedWriter(w)
+		defer done()
+
+		var req previewRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&req); err != nil {
+			SendError(bw, http.StatusBadRequest, "Invalid JSON in request body")
+			return
+		}
+		defer r.Body.Close()
+
+		transform := config.Transform{Template: req.Template, Escape: req.Escape}
+		if req.Transform != nil {
+			transform = *req.Transform
+		}
+		if transform.Template == "" && len(transform.Mapping) == 0 && transform.Expression == "" {
+			SendError(bw, http.StatusBadRequest, "template or transform is required")
+			return
+		}
+		if len(req.Payload) == 0 {
+			SendError(bw, http.StatusBadRequest, "payload is required")
+			return
+		}
+
+		rule := config.Rule{
+			ID:        "preview",
+			API:       config.RuleAPI{Method: http.MethodPost, Path: "/preview"},
+			Transform: transform,
+			Target:    req.Target,
+		}
+		if errs := validatePreviewRule(rule); len(errs) > 0 {
+			SendErrorDetails(bw, http.StatusBadRequest, "Rule validation failed", errs)
+			return
+		}
+		s.sendPreview(bw, rule, req.Payload)
+	}
+}
+
+// validatePreviewRule checks an inline preview like a rule being created,
+// except for its transform: the preview reports transform errors itself,
+// along with where they occur
+func validatePreviewRule(rule config.Rule) config.ValidationErrors {
+	var errs config.ValidationErrors
+	if !errors.As(rule.Validate(), &errs) {
+		return nil
+	}
+
+	var remaining config.ValidationErrors
+	for _, err := range errs {
+		if err.Field != "transform" && !strings.HasPrefix(err.Field, "transform.") {
+			remaining = append(remaining, err)
+		}
+	}
+	return remaining
+}
+
+// sendPreview transforms the payload with the rule and writes the result
+func (s *Server) sendPreview(w http.ResponseWriter, rule config.Rule, payload []byte) {
+	result, err := s.transformer.Preview(rule, payload)
+	if err != nil {
+		s.sendPreviewError(w, rule, err)
+		return
+	}
+
+	if result.Filtered {
+		JSONResponse(w, http.StatusOK, previewResponse{
+			RuleID:   rule.ID,
+			Filtered: true,
+		})
+		return
+	}
+
+	if len(rule.Targets) > 0 {
+		s.sendTargetsPreview(w, rule, result.Targets)
+		return
+	}
+
+	if result.Dropped {
+		JSONResponse(w, http.StatusOK, previewResponse{
+			RuleID:  rule.ID,
+			Route:   result.Route,
+			Dropped: true,
+		})
+		return
+	}
+
+	target := result.Targets[0]
+	if target.Err != nil {
+		s.sendPreviewError(w, rule, target.Err)
+		return
+	}
+
+	fanout := target.Target.Transform.Fanout()
+	output, err := decodeMessages(target.Messages, fanout)
+	if err != nil {
+		SendError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	resp := previewResponse{
+		RuleID:    rule.ID,
+		Route:     result.Route,
+		Topic:     messagesTopic(target.Messages),
+		Target:    &target.Target.TargetMQTT,
+		Published: false,
+	}
+	if fanout {
+		resp.Outputs = output.([]interface{})
+	} else {
+		resp.Output = output
+	}
+	JSONResponse(w, http.StatusOK, resp)
+}
+
+// sendTargetsPreview writes the preview of every target of a multi-target
+// rule, failing with 422 if any target failed to transform
+func (s *Server) sendTargetsPreview(w http.ResponseWriter, rule config.Rule, results []transformer.TargetResult) {
+	resp := targetsPreviewResponse{
+		RuleID:  rule.ID,
+		Targets: make([]targetPreview, len(results)),
+	}
+
+	status := http.StatusOK
+	for i, result := range results {
+		target := targetPreview{
+			Name:   result.Target.Name,
+			Topic:  messagesTopic(result.Messages),
+			Target: result.Target.TargetMQTT,
+		}
+		if result.Err != nil {
+			status = http.StatusUnprocessableEntity
+			detail, ok := transformErrorDetail(result.Err)
+			if !ok {
+				s.logger.Error("Unexpected preview error",
+					zap.Error(result.Err),
+					zap.String("rule_id", rule.ID),
+					zap.String("target", result.Target.Name))
+				SendError(w, http.StatusInternalServerError, "Internal server error")
+				return
+			}
+			target.Error = &detail
+			resp.Targets[i] = target
+			continue
+		}
+
+		fanout := result.Target.Transform.Fanout()
+		output, err := decodeMessages(result.Messages, fanout)
+		if err != nil {
+			SendError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if fanout {
+			target.Outputs = output.([]interface{})
+		} else {
+			target.Output = output
+		}
+		resp.Targets[i] = target
+	}
+
+	JSONResponse(w, status, resp)
+}
+
+// sendPreviewError writes a transform error with its location for rule authors
+func (s *Server) sendPreviewError(w http.ResponseWriter, rule config.Rule, err error) {
+	detail, ok := transformErrorDetail(err)
+	if !ok {
+		s.logger.Error("Unexpected preview error",
+			zap.Error(err),
+			zap.String("rule_id", rule.ID))
+		SendError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	SendErrorDetails(w, http.StatusUnprocessableEntity,
+		"Transform error: "+detail.Stage, detail)
+}
+
+// transformErrorDetail describes a transform error, reporting false if err
+// is not a transform error
+func transformErrorDetail(err error) (templateErrorDetail, bool) {
+	var transformErr *transformer.TransformError
+	if !errors.As(err, &transformErr) {
+		return templateErrorDetail{}, false
+	}
+
+	detail := templateErrorDetail{
+		Stage:   transformErr.Message,
+		Message: transformErr.Err.Error(),
+		Line:    transformErr.Line,
+		Column:  transformErr.Column,
+	}
+	var schemaErr *validator.SchemaError
+	if errors.As(transformErr.Err, &schemaErr) {
+		detail.Violations = schemaErr.Violations
+	}
+	return detail, true
+}
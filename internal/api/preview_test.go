@@ -0,0 +1,147 @@
+//file: internal/api/preview_test.go
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPreviewRule(t *testing.T) {
+	s := newAdminServer(t, t.TempDir(), `{
+		"id": "status",
+		"api": {"method": "POST", "path": "/status"},
+		"transform": {"template": "{\"state\": {{jsonString .state}}}"},
+		"target": {"topic": "devices/{{.id}}/status", "qos": 1, "sink": "out"}
+	}`)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantCode   int
+		wantTopic  string
+		wantOutput map[string]interface{}
+	}{
+		{
+			name:       "rule",
+			path:       "/admin/rules/status/preview",
+			body:       `{"id": "d1", "state": "on"}`,
+			wantCode:   http.StatusOK,
+			wantTopic:  "devices/d1/status",
+			wantOutput: map[string]interface{}{"state": "on"},
+		},
+		{name: "transform error", path: "/admin/rules/status/preview", body: `{"state": "on"}`, wantCode: http.StatusUnprocessableEntity},
+		{name: "invalid JSON", path: "/admin/rules/status/preview", body: `{"id":`, wantCode: http.StatusBadRequest},
+		{name: "unknown rule", path: "/admin/rules/missing/preview", body: `{}`, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := adminRequest(s, http.MethodPost, tt.path, tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var resp previewResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Published || resp.Topic != tt.wantTopic || !reflect.DeepEqual(resp.Output, tt.wantOutput) {
+				t.Errorf("preview = %+v, want topic %s and output %v", resp, tt.wantTopic, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestPreviewTemplate(t *testing.T) {
+	s := newAdminServer(t, t.TempDir())
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		// wantError is the stage of transform errors or the field of
+		// validation errors
+		wantError string
+	}{
+		{
+			name:     "template",
+			body:     `{"template": "{\"v\": {{.v}}}", "target": {"topic": "out"}, "payload": {"v": 1}}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "transform",
+			body:     `{"transform": {"type": "mapping", "mapping": {"v": "$.v"}}, "target": {"topic": "out"}, "payload": {"v": 1}}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:      "template syntax error",
+			body:      `{"template": "{{.v", "target": {"topic": "out"}, "payload": {"v": 1}}`,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "failed to parse template",
+		},
+		{
+			name:      "execution error",
+			body:      `{"template": "{{index .v 5}}", "target": {"topic": "out"}, "payload": {"v": [1]}}`,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "failed to execute template",
+		},
+		{
+			name:      "invalid topic",
+			body:      `{"template": "{}", "target": {"topic": "out/#"}, "payload": {}}`,
+			wantCode:  http.StatusBadRequest,
+			wantError: "target.topic",
+		},
+		{
+			name:      "missing topic",
+			body:      `{"template": "{}", "payload": {}}`,
+			wantCode:  http.StatusBadRequest,
+			wantError: "target.topic",
+		},
+		{
+			name:      "invalid QoS",
+			body:      `{"template": "{}", "target": {"topic": "out", "qos": 3}, "payload": {}}`,
+			wantCode:  http.StatusBadRequest,
+			wantError: "target.qos",
+		},
+		{name: "no template", body: `{"target": {"topic": "out"}, "payload": {}}`, wantCode: http.StatusBadRequest},
+		{name: "no payload", body: `{"template": "{}", "target": {"topic": "out"}}`, wantCode: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{"template": `, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := adminRequest(s, http.MethodPost, "/admin/preview", tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body)
+			}
+			if tt.wantError == "" {
+				return
+			}
+
+			var resp struct {
+				Details json.RawMessage `json:"details"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			var detail templateErrorDetail
+			var fields []struct {
+				Field string `json:"field"`
+			}
+			if json.Unmarshal(resp.Details, &detail) == nil && detail.Stage == tt.wantError {
+				return
+			}
+			if json.Unmarshal(resp.Details, &fields) == nil && len(fields) == 1 && fields[0].Field == tt.wantError {
+				return
+			}
+			t.Errorf("error details = %s, want %s", resp.Details, tt.wantError)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+//file: internal/api/reply.go
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/metrics"
+	"message-transformer/internal/mqtt"
+	"message-transformer/internal/transformer"
+)
+
+// requestReply publishes the message of a reply rule, waits for the reply
+// and writes it, transformed by the rule's reply transform, as the response
+func (s *Server) requestReply(w ResponseWriter, r *http.Request, rule config.Rule, messages []transformer.Message) {
+	if len(messages) != 1 {
+		s.logger.Error("Reply rule produced several messages",
+			zap.String("rule_id", rule.ID),
+			zap.Int("messages", len(messages)))
+		SendError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	msg := messages[0]
+
+	ctx, cancel := context.WithTimeout(r.Context(), rule.Reply.WaitTimeout())
+	defer cancel()
+
+	reply, err := s.mqtt.Request(ctx, msg.MQTT(), rule.Reply.Topic)
+	if err != nil {
+		logger := s.logger.With(
+			zap.Error(err),
+			zap.String("rule_id", rule.ID),
+			zap.String("topic", msg.Topic),
+			zap.String("reply_topic", rule.Reply.Topic))
+		switch {
+		case errors.Is(err, mqtt.ErrRequestTimeout):
+			s.metrics.IncMQTTRequests(rule.ID, metrics.RequestTimeout)
+			logger.Warn("Timed out waiting for MQTT reply")
+			SendError(w, http.StatusGatewayTimeout, "Timed out waiting for reply")
+		case errors.Is(err, context.Canceled):
+			// The caller went away; there is nobody to answer
+			s.metrics.IncMQTTRequests(rule.ID, metrics.RequestFailed)
+			logger.Debug("Request cancelled while waiting for MQTT reply")
+		case errors.Is(err, mqtt.ErrRequestUnsupported):
+			s.metrics.IncMQTTRequests(rule.ID, metrics.RequestFailed)
+			logger.Error("Reply rules need an MQTT v5 connection")
+			SendError(w, http.StatusNotImplemented, "Reply rules require MQTT v5")
+		default:
+			s.metrics.IncMQTTRequests(rule.ID, metrics.RequestFailed)
+			logger.Error("Failed to send MQTT request")
+			SendError(w, http.StatusServiceUnavailable, "Failed to publish message")
+		}
+		return
+	}
+
+	body, err := s.compiledRules(r.Context()).TransformReply(rule.ID, reply.Payload)
+	if err != nil {
+		s.metrics.IncMQTTRequests(rule.ID, metrics.RequestFailed)
+		s.logger.Error("Failed to transform MQTT reply",
+			zap.Error(err),
+			zap.String("rule_id", rule.ID),
+			zap.String("reply_topic", reply.Topic))
+		SendError(w, http.StatusBadGateway, "Invalid reply")
+		return
+	}
+	s.metrics.IncMQTTRequests(rule.ID, metrics.RequestReplied)
+
+	// Replies are returned as they are; non-JSON replies keep the content
+	// type they were published with
+	contentType := "application/json"
+	if !json.Valid(body) {
+		contentType = "application/octet-stream"
+		if reply.Properties != nil && reply.Properties.ContentType != "" {
+			contentType = reply.Properties.ContentType
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
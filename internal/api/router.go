@@ -3,6 +3,8 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
@@ -14,7 +16,10 @@ import (
 	"message-transformer/internal/config"
 	"message-transformer/internal/metrics"
 	"message-transformer/internal/mqtt"
+	"message-transformer/internal/pipeline"
+	"message-transformer/internal/sink"
 	"message-transformer/internal/transformer"
+	"message-transformer/internal/validator"
 )
 
 // ServerConfig holds the configuration for the HTTP server
@@ -22,30 +27,52 @@ type ServerConfig struct {
 	Logger      *zap.Logger
 	Rules       []config.Rule
 	Transformer *transformer.Transformer
-	MQTT        *mqtt.Client
+	Sinks       *sink.Registry
 	Metrics     metrics.Recorder
+
+	// MQTT sends the requests of reply rules
+	MQTT *mqtt.Client
+	// Pipeline publishes messages asynchronously when set
+	Pipeline *pipeline.Pipeline
+
+	// RulesDirectory is where rules created through the admin API are stored
+	RulesDirectory string
+	// AdminToken enables the admin API when set
+	AdminToken string
+	// OnRulesApplied is called with the new rule set after every reload
+	OnRulesApplied func(rules []config.Rule)
 }
 
 // Server represents the HTTP server
 type Server struct {
 	router      *chi.Mux
 	logger      *zap.Logger
-	rules       []config.Rule
-	ruleMap     map[string]config.Rule
 	transformer *transformer.Transformer
+	validator   *validator.Validator
+	sinks       *sink.Registry
 	mqtt        *mqtt.Client
+	pipeline    *pipeline.Pipeline
 	metrics     metrics.Recorder
 	bufferPool  *sync.Pool
+	rulesDir    string
+	adminToken  string
+	onApplied   func(rules []config.Rule)
+
+	// Rule routing state, swapped atomically on reload
+	reloadMu   sync.Mutex
+	mu         sync.RWMutex
+	rules      []config.Rule
+	ruleMap    map[string]config.Rule
+	ruleRouter *chi.Mux
+	compiled   *transformer.Rules
 }
 
+// compiledRulesKey is the context key of the compiled rule set serving a
+// request
+type compiledRulesKey struct{}
+
 // NewServer creates a new HTTP server instance
 func NewServer(cfg ServerConfig) *Server {
-	// Initialize rule map for O(1) lookups
-	ruleMap := make(map[string]config.Rule, len(cfg.Rules))
-	for _, rule := range cfg.Rules {
-		ruleMap[rule.API.Path] = rule
-	}
-
 	if cfg.Metrics == nil {
 		cfg.Metrics = metrics.NewNoOpRecorder()
 	}
@@ -53,11 +80,15 @@ func NewServer(cfg ServerConfig) *Server {
 	s := &Server{
 		router:      chi.NewRouter(),
 		logger:      cfg.Logger,
-		rules:       cfg.Rules,
-		ruleMap:     ruleMap,
 		transformer: cfg.Transformer,
+		validator:   validator.New(cfg.Logger),
+		sinks:       cfg.Sinks,
 		mqtt:        cfg.MQTT,
+		pipeline:    cfg.Pipeline,
 		metrics:     cfg.Metrics,
+		rulesDir:    cfg.RulesDirectory,
+		adminToken:  cfg.AdminToken,
+		onApplied:   cfg.OnRulesApplied,
 		bufferPool: &sync.Pool{
 			New: func() interface{} {
 				return make([]byte, 32*1024) // 32KB initial buffer
@@ -68,6 +99,15 @@ func NewServer(cfg ServerConfig) *Server {
 	s.setupMiddleware()
 	s.setupRoutes()
 
+	ruleRouter, ruleMap, err := s.buildRuleRouter(cfg.Rules)
+	if err != nil {
+		s.logger.Fatal("Failed to register rule routes", zap.Error(err))
+	}
+	s.rules = cfg.Rules
+	s.ruleMap = ruleMap
+	s.ruleRouter = ruleRouter
+	s.compiled = cfg.Transformer.Rules()
+
 	// Set service as up
 	s.metrics.SetUp(true)
 
@@ -82,7 +122,7 @@ func (s *Server) setupMiddleware() {
 	s.router.Use(MetricsMiddleware(s.metrics))
 	s.router.Use(middleware.Recoverer)
 	s.router.Use(middleware.Timeout(30 * time.Second))
-	s.router.Use(middleware.AllowContentType("application/json"))
+	s.router.Use(middleware.AllowContentType("application/json", contentTypeNDJSON))
 }
 
 // setupRoutes configures the route handlers
@@ -93,16 +133,131 @@ func (s *Server) setupRoutes() {
 	// Health check endpoint
 	s.router.Get("/health", s.handleHealth())
 
-	// Dynamic rule-based endpoints using pre-built rule map
-	for path, rule := range s.ruleMap {
+	// Status of asynchronously published messages
+	if s.pipeline != nil {
+		s.router.Get("/messages/{id}", s.handleMessageStatus())
+	}
+
+	// Admin API, only available when a token is configured
+	if s.adminToken != "" {
+		s.router.Route("/admin", func(r chi.Router) {
+			r.Use(AdminAuth(s.adminToken))
+			r.Get("/rules", s.handleListRules())
+			r.Post("/rules", s.handleCreateRule())
+			r.Get("/rules/{id}", s.handleGetRule())
+			r.Put("/rules/{id}", s.handleUpdateRule())
+			r.Delete("/rules/{id}", s.handleDeleteRule())
+			r.Post("/rules/{id}/preview", s.handlePreviewRule())
+			r.Post("/preview", s.handlePreviewTemplate())
+		})
+	}
+
+	// Dynamic rule-based endpoints are served from a swappable sub-router
+	s.router.Handle("/*", http.HandlerFunc(s.serveRules))
+}
+
+// buildRuleRouter builds a router and rule map for the given rule set
+func (s *Server) buildRuleRouter(rules []config.Rule) (router *chi.Mux, ruleMap map[string]config.Rule, err error) {
+	// chi panics on invalid or conflicting patterns; surface that as an error
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("failed to register rule routes: %v", rec)
+		}
+	}()
+
+	router = chi.NewRouter()
+	ruleMap = make(map[string]config.Rule, len(rules))
+	for _, rule := range rules {
+		if rule.SourceType() != config.SourceHTTP {
+			continue
+		}
+
 		// Capture rule in local variable for closure
 		r := rule
-		s.router.Method(r.API.Method, path, s.handleTransform(r))
+		router.Method(r.API.Method, r.API.Path, s.handleTransform(r))
+		ruleMap[ruleKey(r.API.Method, r.API.Path)] = r
 		s.logger.Debug("Registered route",
 			zap.String("method", r.API.Method),
-			zap.String("path", path),
+			zap.String("path", r.API.Path),
 			zap.String("rule_id", r.ID))
 	}
+
+	return router, ruleMap, nil
+}
+
+// serveRules dispatches a request to the currently active rule router. The
+// request is transformed with the transforms compiled along with the router,
+// even if the rules are reloaded while it is served.
+func (s *Server) serveRules(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	router := s.ruleRouter
+	compiled := s.compiled
+	s.mu.RUnlock()
+
+	ctx := context.WithValue(r.Context(), compiledRulesKey{}, compiled)
+	router.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// compiledRules returns the compiled rule set serving a request
+func (s *Server) compiledRules(ctx context.Context) *transformer.Rules {
+	if compiled, ok := ctx.Value(compiledRulesKey{}).(*transformer.Rules); ok {
+		return compiled
+	}
+	return s.transformer.Rules()
+}
+
+// ReloadRules replaces the active rule set. Templates for new and changed
+// rules are compiled before anything is swapped; on failure the current rule
+// set stays live.
+func (s *Server) ReloadRules(rules []config.Rule) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	return s.applyRules(rules)
+}
+
+// applyRules swaps in a new rule set; callers must hold reloadMu
+func (s *Server) applyRules(rules []config.Rule) error {
+	if err := config.ValidateRuleSet(rules); err != nil {
+		return err
+	}
+	if err := s.sinks.ValidateRules(rules); err != nil {
+		return err
+	}
+
+	router, ruleMap, err := s.buildRuleRouter(rules)
+	if err != nil {
+		return err
+	}
+
+	// Compile every transform first, so that a failure leaves the current
+	// rule set live, then swap them in along with the route table
+	compiled, err := s.transformer.Compile(rules)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.rules = rules
+	s.ruleMap = ruleMap
+	s.ruleRouter = router
+	s.compiled = compiled
+	s.transformer.Swap(compiled)
+	s.mu.Unlock()
+
+	if s.onApplied != nil {
+		s.onApplied(rules)
+	}
+
+	return nil
+}
+
+// Rules returns a copy of the active rule set
+func (s *Server) Rules() []config.Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rules := make([]config.Rule, len(s.rules))
+	copy(rules, s.rules)
+	return rules
 }
 
 // ServeHTTP implements the http.Handler interface
@@ -110,12 +265,24 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
 
-// GetRule retrieves a rule by path with O(1) complexity
-func (s *Server) GetRule(path string) (config.Rule, bool) {
-	rule, exists := s.ruleMap[path]
+// GetRule retrieves the rule serving requests with the given method and
+// path, matching the path against the rules' path patterns
+func (s *Server) GetRule(method, path string) (config.Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pattern := s.ruleRouter.Find(chi.NewRouteContext(), method, path)
+	if pattern == "" {
+		return config.Rule{}, false
+	}
+	rule, exists := s.ruleMap[ruleKey(method, pattern)]
 	return rule, exists
 }
 
+// ruleKey identifies the rule serving a method and path pattern
+func ruleKey(method, pattern string) string {
+	return method + " " + pattern
+}
+
 // Shutdown updates metrics for graceful shutdown
 func (s *Server) Shutdown() {
 	s.metrics.SetUp(false)
@@ -0,0 +1,171 @@
+//file: internal/api/router_test.go
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"message-transformer/internal/config"
+)
+
+// reloadRule returns a rule serving the path with the template
+func reloadRule(t *testing.T, id, path, template string) config.Rule {
+	t.Helper()
+
+	rule, err := config.ParseRule([]byte(fmt.Sprintf(`{
+		"id": %q,
+		"api": {"method": "POST", "path": %q},
+		"transform": {"template": %q},
+		"target": {"topic": "out", "sink": "out"}
+	}`, id, path, template)), t.TempDir())
+	if err != nil {
+		t.Fatalf("ParseRule() error = %v", err)
+	}
+	return rule
+}
+
+// withTemplate replaces the template of a parsed rule, bypassing its
+// validation
+func withTemplate(rule config.Rule, template string) config.Rule {
+	rule.Transform.Template = template
+	return rule
+}
+
+// withSink replaces the sink of a rule's target
+func withSink(rule config.Rule, sink string) config.Rule {
+	rule.Target.Sink = sink
+	return rule
+}
+
+// transformed posts an empty object to the path and returns the status
+// code and the transformed message of the response
+func transformed(t *testing.T, s *Server, path string) (int, string) {
+	t.Helper()
+
+	rec := post(s, path, "application/json", `{}`)
+	var resp struct {
+		Transformed json.RawMessage `json:"transformed"`
+	}
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, string(resp.Transformed)
+}
+
+func TestReloadRules(t *testing.T) {
+	s := newTestServer(t, []config.SinkConfig{{Name: "out", Type: config.SinkNull}}, nil, `{
+		"id": "a",
+		"api": {"method": "POST", "path": "/a"},
+		"transform": {"template": "{\"v\": 1}"},
+		"target": {"topic": "out", "sink": "out"}
+	}`)
+
+	// Each step reloads the rules left by the previous one
+	tests := []struct {
+		name    string
+		rules   []config.Rule
+		wantErr bool
+		// want maps paths to the message they transform to, empty for
+		// paths that are not served
+		want map[string]string
+	}{
+		{
+			name:  "changed template",
+			rules: []config.Rule{reloadRule(t, "a", "/a", `{"v": 2}`)},
+			want:  map[string]string{"/a": `{"v":2}`},
+		},
+		{
+			name:    "invalid template",
+			rules:   []config.Rule{reloadRule(t, "a", "/a", `{"v": 3}`), withTemplate(reloadRule(t, "b", "/b", `{}`), `{"v": {{.missing`)},
+			wantErr: true,
+			want:    map[string]string{"/a": `{"v":2}`, "/b": ""},
+		},
+		{
+			name:    "unknown sink",
+			rules:   []config.Rule{withSink(reloadRule(t, "a", "/a", `{"v": 3}`), "missing")},
+			wantErr: true,
+			want:    map[string]string{"/a": `{"v":2}`},
+		},
+		{
+			name:    "route conflict",
+			rules:   []config.Rule{reloadRule(t, "a", "/a", `{"v": 3}`), reloadRule(t, "b", "/a", `{"v": 4}`)},
+			wantErr: true,
+			want:    map[string]string{"/a": `{"v":2}`},
+		},
+		{
+			name:  "replaced rule",
+			rules: []config.Rule{reloadRule(t, "b", "/b", `{"v": 4}`)},
+			want:  map[string]string{"/a": "", "/b": `{"v":4}`},
+		},
+		{
+			name:  "rule moved to another path",
+			rules: []config.Rule{reloadRule(t, "b", "/c", `{"v": 4}`)},
+			want:  map[string]string{"/b": "", "/c": `{"v":4}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ReloadRules(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReloadRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for path, want := range tt.want {
+				code, got := transformed(t, s, path)
+				if want == "" {
+					if code != http.StatusNotFound {
+						t.Errorf("POST %s status = %d, want %d", path, code, http.StatusNotFound)
+					}
+					continue
+				}
+				if code != http.StatusOK || got != want {
+					t.Errorf("POST %s = %d %s, want %s", path, code, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadKeepsTransformsOfServedRequests(t *testing.T) {
+	s := newTestServer(t, []config.SinkConfig{{Name: "out", Type: config.SinkNull}}, nil, `{
+		"id": "a",
+		"api": {"method": "POST", "path": "/a"},
+		"transform": {"template": "{\"v\": 1}"},
+		"target": {"topic": "out", "sink": "out"}
+	}`)
+
+	// A request routed before a reload carries the transforms compiled with
+	// the rule that routed it
+	ctx := context.WithValue(context.Background(), compiledRulesKey{}, s.transformer.Rules())
+	if err := s.ReloadRules([]config.Rule{reloadRule(t, "a", "/a", `{"v": 2}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "routed before reload", ctx: ctx, want: `{"v": 1}`},
+		{name: "routed after reload", ctx: context.Background(), want: `{"v": 2}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.compiledRules(tt.ctx).TransformRequest("a", []byte(`{}`), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(result.Targets[0].Messages[0].Payload); got != tt.want {
+				t.Errorf("payload = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
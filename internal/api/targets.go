@@ -0,0 +1,172 @@
+//file: internal/api/targets.go
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/transformer"
+	"message-transformer/internal/validator"
+)
+
+// Per-target and overall delivery statuses
+const (
+	targetPublished = "published"
+	targetQueued    = "queued"
+	targetFailed    = "failed"
+	targetSkipped   = "skipped"
+	targetsPartial  = "partial"
+)
+
+// targetResponse reports the outcome of a single target
+type targetResponse struct {
+	Name        string      `json:"name"`
+	Topic       string      `json:"topic,omitempty"`
+	Status      string      `json:"status"`
+	Transformed interface{} `json:"transformed,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	Details     interface{} `json:"details,omitempty"`
+}
+
+// targetsResponse reports the outcome of every target of a rule
+type targetsResponse struct {
+	Status  string           `json:"status"`
+	RuleID  string           `json:"rule_id"`
+	Targets []targetResponse `json:"targets"`
+}
+
+// publishTargets publishes the transformed messages of a multi-target rule
+// according to its partial failure policy and returns the per-target results.
+//
+// With the all-or-nothing policy nothing is published unless every target
+// transformed successfully, and publishing stops at the first failure;
+// publishes cannot be withdrawn, so targets published before the failure
+// stay published. With the best-effort policy every target is transformed
+// and published independently.
+func (s *Server) publishTargets(ctx context.Context, rule config.Rule, results []transformer.TargetResult) (int, interface{}) {
+	resp, ok := s.transformedTargets(rule, results)
+	if !ok {
+		return http.StatusUnprocessableEntity, resp
+	}
+
+	code := s.publishTransformedTargets(ctx, rule, results, &resp)
+	return code, resp
+}
+
+// transformedTargets reports the transform errors of a multi-target rule's
+// targets. It returns false if nothing may be published because a target
+// of an all-or-nothing rule failed to transform.
+func (s *Server) transformedTargets(rule config.Rule, results []transformer.TargetResult) (targetsResponse, bool) {
+	resp := targetsResponse{
+		RuleID:  rule.ID,
+		Targets: make([]targetResponse, len(results)),
+	}
+
+	transformFailed := false
+	for i, result := range results {
+		resp.Targets[i] = targetResponse{
+			Name:  result.Target.Name,
+			Topic: messagesTopic(result.Messages),
+		}
+		if result.Err != nil {
+			transformFailed = true
+			s.logger.Error("Transform error",
+				zap.Error(result.Err),
+				zap.String("rule_id", rule.ID),
+				zap.String("target", result.Target.Name))
+			resp.Targets[i].Status = targetFailed
+			resp.Targets[i].Error, resp.Targets[i].Details = targetError(result.Err)
+		}
+	}
+
+	// All-or-nothing rules publish nothing if any target failed to transform
+	if transformFailed && !rule.BestEffort() {
+		for i := range resp.Targets {
+			if resp.Targets[i].Status == "" {
+				resp.Targets[i].Status = targetSkipped
+			}
+		}
+		resp.Status = targetFailed
+		return resp, false
+	}
+	return resp, true
+}
+
+// publishTransformedTargets publishes the targets that transformed
+// successfully, recording each outcome and the overall status in resp, and
+// returns the HTTP status code for the result
+func (s *Server) publishTransformedTargets(ctx context.Context, rule config.Rule, results []transformer.TargetResult, resp *targetsResponse) int {
+	bestEffort := rule.BestEffort()
+	published, queued, publishFailed := 0, 0, false
+	for i, result := range results {
+		target := &resp.Targets[i]
+		if target.Status != "" {
+			continue
+		}
+		if publishFailed && !bestEffort {
+			target.Status = targetSkipped
+			continue
+		}
+
+		wasQueued, err := s.publishMessages(ctx, rule, result.Messages)
+		if err != nil {
+			publishFailed = true
+			target.Status = targetFailed
+			target.Error = "Failed to publish message"
+			continue
+		}
+
+		preview, err := decodeMessages(result.Messages, result.Target.Transform.Fanout())
+		if err != nil {
+			s.logger.Error("Failed to parse transformed data for response",
+				zap.Error(err),
+				zap.String("rule_id", rule.ID),
+				zap.String("target", result.Target.Name))
+		}
+		target.Status = targetPublished
+		target.Transformed = preview
+		published++
+		if wasQueued {
+			target.Status = targetQueued
+			queued++
+		}
+	}
+
+	// Queued targets count as delivered, but the request is only accepted
+	switch {
+	case published == len(results) && queued > 0:
+		resp.Status = targetQueued
+		return http.StatusAccepted
+	case published == len(results):
+		resp.Status = targetPublished
+		return http.StatusOK
+	case published > 0:
+		resp.Status = targetsPartial
+		return http.StatusMultiStatus
+	case publishFailed:
+		resp.Status = targetFailed
+		return http.StatusServiceUnavailable
+	default:
+		resp.Status = targetFailed
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// targetError describes a target's transform error for a response
+func targetError(err error) (string, interface{}) {
+	var transformErr *transformer.TransformError
+	if !errors.As(err, &transformErr) {
+		return "Internal server error", nil
+	}
+
+	var schemaErr *validator.SchemaError
+	if errors.As(transformErr.Err, &schemaErr) {
+		return "Transform error: " + transformErr.Message, schemaErr.Violations
+	}
+	return "Transform error: " + transformErr.Message, nil
+}
@@ -0,0 +1,323 @@
+//file: internal/bridge/bridge.go
+
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/mqtt"
+	"message-transformer/internal/sink"
+	"message-transformer/internal/transformer"
+	"message-transformer/internal/validator"
+	"message-transformer/internal/webhook"
+)
+
+// Webhook delivery settings. Deliveries are queued per worker, and every
+// delivery of a rule goes to the same worker so that its messages arrive in
+// order.
+const (
+	webhookWorkers   = 4
+	webhookQueueSize = 256
+)
+
+// Bridge subscribes to the topic filters of MQTT source rules and publishes
+// each incoming message through the rule's transform, or queues it for
+// delivery to the rule's webhook
+type Bridge struct {
+	logger      *zap.Logger
+	transformer *transformer.Transformer
+	validator   *validator.Validator
+	sinks       *sink.Registry
+	webhooks    *webhook.Client
+
+	mu      sync.RWMutex
+	filters map[subscription]*filterRules // subscription to the rules using it
+
+	// deliveries are the webhook queues of the delivery workers; ctx is
+	// cancelled to abandon retries when closing takes too long
+	deliveries []chan delivery
+	deliverMu  sync.RWMutex
+	closed     bool
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// delivery is a transformed message waiting for webhook delivery
+type delivery struct {
+	logger *zap.Logger
+	rule   config.Rule
+	target transformer.TargetResult
+}
+
+// subscription is a topic filter subscribed on a named broker
+type subscription struct {
+	broker string
+	filter string
+}
+
+// filterRules is a subscribed topic filter and the rules it feeds
+type filterRules struct {
+	qos   int
+	rules []config.Rule
+}
+
+// New creates a bridge with no subscriptions that subscribes on and publishes
+// through the brokers and sinks of the registry, and starts its webhook
+// delivery workers
+func New(logger *zap.Logger, t *transformer.Transformer, sinks *sink.Registry, webhooks *webhook.Client) *Bridge {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bridge{
+		logger:      logger,
+		transformer: t,
+		validator:   validator.New(logger),
+		sinks:       sinks,
+		webhooks:    webhooks,
+		filters:     make(map[subscription]*filterRules),
+		deliveries:  make([]chan delivery, webhookWorkers),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	b.wg.Add(webhookWorkers)
+	for i := range b.deliveries {
+		b.deliveries[i] = make(chan delivery, webhookQueueSize)
+		go b.deliverWorker(b.deliveries[i])
+	}
+	return b
+}
+
+// Close stops accepting webhook deliveries and waits for the queued ones to
+// finish. Deliveries still running when the context ends are cancelled.
+func (b *Bridge) Close(ctx context.Context) error {
+	b.deliverMu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, queue := range b.deliveries {
+			close(queue)
+		}
+	}
+	b.deliverMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		b.cancel()
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// ApplyRules updates the subscriptions to match the MQTT source rules in the
+// rule set, each on the broker the rule names. Transforms must already be
+// compiled for the rules and their brokers validated against the registry.
+// Subscriptions that fail are logged and retried when the client reconnects.
+func (b *Bridge) ApplyRules(rules []config.Rule) {
+	filters := make(map[subscription]*filterRules)
+	for _, rule := range rules {
+		if rule.SourceType() != config.SourceMQTT {
+			continue
+		}
+		sub := subscription{broker: rule.Source.BrokerName(), filter: rule.Source.Topic}
+		f, exists := filters[sub]
+		if !exists {
+			f = &filterRules{}
+			filters[sub] = f
+		}
+		if rule.Source.QoS > f.qos {
+			f.qos = rule.Source.QoS
+		}
+		f.rules = append(f.rules, rule)
+	}
+
+	b.mu.Lock()
+	previous := b.filters
+	b.filters = filters
+	b.mu.Unlock()
+
+	for sub := range previous {
+		if _, exists := filters[sub]; exists {
+			continue
+		}
+		client, exists := b.sinks.Broker(sub.broker)
+		if !exists {
+			continue
+		}
+		if err := client.Unsubscribe(sub.filter); err != nil {
+			b.logger.Error("Failed to unsubscribe from MQTT topic",
+				zap.Error(err),
+				zap.String("broker", sub.broker),
+				zap.String("topic", sub.filter))
+			continue
+		}
+		b.logger.Info("Unsubscribed from MQTT topic",
+			zap.String("broker", sub.broker),
+			zap.String("topic", sub.filter))
+	}
+
+	for sub, f := range filters {
+		if old, exists := previous[sub]; exists && old.qos == f.qos {
+			continue
+		}
+		client, exists := b.sinks.Broker(sub.broker)
+		if !exists {
+			b.logger.Error("Cannot subscribe on unknown MQTT broker",
+				zap.String("broker", sub.broker),
+				zap.String("topic", sub.filter))
+			continue
+		}
+		if err := client.Subscribe(sub.filter, f.qos, b.handler(sub)); err != nil {
+			b.logger.Error("Failed to subscribe to MQTT topic",
+				zap.Error(err),
+				zap.String("broker", sub.broker),
+				zap.String("topic", sub.filter))
+			continue
+		}
+		b.logger.Info("Subscribed to MQTT topic",
+			zap.String("broker", sub.broker),
+			zap.String("topic", sub.filter),
+			zap.Int("qos", f.qos),
+			zap.Int("rules", len(f.rules)))
+	}
+}
+
+// handler dispatches messages on a subscription to the rules currently
+// using it
+func (b *Bridge) handler(sub subscription) mqtt.MessageHandler {
+	return func(msg mqtt.Message) {
+		b.mu.RLock()
+		f, exists := b.filters[sub]
+		b.mu.RUnlock()
+		if !exists {
+			return
+		}
+
+		for _, rule := range f.rules {
+			b.process(rule, msg.Topic, msg.Payload)
+		}
+	}
+}
+
+// process transforms a message for a rule and publishes the results,
+// following the rule's partial failure policy
+func (b *Bridge) process(rule config.Rule, topic string, payload []byte) {
+	logger := b.logger.With(
+		zap.String("rule_id", rule.ID),
+		zap.String("source_topic", topic))
+
+	if !json.Valid(payload) {
+		logger.Warn("Ignoring MQTT message with invalid JSON")
+		return
+	}
+	if err := b.validator.ValidatePayload(payload, rule); err != nil {
+		logger.Warn("Ignoring MQTT message that failed validation", zap.Error(err))
+		return
+	}
+
+	result, err := b.transformer.TransformRule(rule.ID, payload)
+	if err != nil {
+		logger.Error("Transform error", zap.Error(err))
+		return
+	}
+	if result.Filtered || result.Dropped {
+		return
+	}
+
+	// All-or-nothing rules publish nothing if any target failed to transform
+	failed := false
+	for _, target := range result.Targets {
+		if target.Err != nil {
+			failed = true
+			logger.Error("Transform error",
+				zap.Error(target.Err),
+				zap.String("target", target.Target.Name))
+		}
+	}
+	if failed && !rule.BestEffort() {
+		return
+	}
+
+	if rule.Webhook != nil {
+		b.enqueue(delivery{logger: logger, rule: rule, target: result.Targets[0]})
+		return
+	}
+
+	for _, target := range result.Targets {
+		if target.Err != nil {
+			continue
+		}
+		for _, msg := range target.Messages {
+			if _, err := b.sinks.Publish(context.Background(), rule.ID, msg); err != nil {
+				logger.Error("Failed to publish message",
+					zap.Error(err),
+					zap.String("target", target.Target.Name),
+					zap.String("sink", msg.Sink),
+					zap.String("topic", msg.Topic))
+				if !rule.BestEffort() {
+					return
+				}
+				break
+			}
+		}
+	}
+}
+
+// enqueue hands a webhook delivery to the worker of its rule without
+// waiting, so that slow endpoints and retries do not hold up the MQTT
+// client. Deliveries are dropped when the worker's queue is full.
+func (b *Bridge) enqueue(d delivery) {
+	if d.target.Err != nil {
+		return
+	}
+
+	b.deliverMu.RLock()
+	defer b.deliverMu.RUnlock()
+	if b.closed {
+		d.logger.Warn("Dropping webhook delivery, bridge is closed")
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(d.rule.ID))
+	select {
+	case b.deliveries[h.Sum32()%uint32(len(b.deliveries))] <- d:
+	default:
+		d.logger.Error("Dropping webhook delivery, queue is full",
+			zap.String("url", d.rule.Webhook.URL))
+	}
+}
+
+// deliverWorker delivers queued webhooks until its queue is closed
+func (b *Bridge) deliverWorker(queue <-chan delivery) {
+	defer b.wg.Done()
+	for d := range queue {
+		b.deliver(d.logger, d.rule, d.target)
+	}
+}
+
+// deliver sends each transformed message of a webhook rule to its endpoint,
+// stopping at the first message that could not be delivered
+func (b *Bridge) deliver(logger *zap.Logger, rule config.Rule, target transformer.TargetResult) {
+	for _, msg := range target.Messages {
+		if err := b.webhooks.Deliver(b.ctx, rule.ID, rule.Webhook, msg.Payload); err != nil {
+			logger.Error("Failed to deliver webhook",
+				zap.Error(err),
+				zap.String("url", rule.Webhook.URL))
+			return
+		}
+	}
+}
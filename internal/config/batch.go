@@ -0,0 +1,54 @@
+//file: internal/config/batch.go
+
+package config
+
+import (
+	"fmt"
+)
+
+// Batch defaults
+const (
+	DefaultBatchMaxItems = 1000
+	DefaultBatchMaxBytes = 10 << 20 // 10MB
+)
+
+// Batch lets an HTTP rule accept a JSON array or newline-delimited JSON
+// request whose elements are transformed and published individually
+type Batch struct {
+	// MaxItems is the largest number of elements accepted in a request
+	MaxItems int `json:"maxItems,omitempty"`
+	// MaxBytes is the largest request body accepted, in bytes
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+}
+
+// ItemLimit returns the largest number of elements accepted in a request
+func (b *Batch) ItemLimit() int {
+	if b.MaxItems == 0 {
+		return DefaultBatchMaxItems
+	}
+	return b.MaxItems
+}
+
+// SizeLimit returns the largest request body accepted, in bytes
+func (b *Batch) SizeLimit() int64 {
+	if b.MaxBytes == 0 {
+		return DefaultBatchMaxBytes
+	}
+	return b.MaxBytes
+}
+
+// validateBatch checks the batch configuration
+func (r *Rule) validateBatch(errs *ValidationErrors) {
+	if r.SourceType() != SourceHTTP {
+		errs.add("batch", fmt.Errorf("batch requires an %s source", SourceHTTP))
+	}
+	if r.Reply != nil {
+		errs.add("batch", fmt.Errorf("batch cannot be combined with reply"))
+	}
+	if r.Batch.MaxItems < 0 {
+		errs.add("batch.maxItems", fmt.Errorf("batch item limit cannot be negative"))
+	}
+	if r.Batch.MaxBytes < 0 {
+		errs.add("batch.maxBytes", fmt.Errorf("batch size limit cannot be negative"))
+	}
+}
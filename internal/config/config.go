@@ -28,6 +28,14 @@ type AppConfig struct {
 	API    APIConfig    `json:"api"`
 	Rules  RulesConfig  `json:"rules"`
 	Logger LoggerConfig `json:"logger"`
+	Admin  AdminConfig  `json:"admin"`
+	Queue  QueueConfig  `json:"queue"`
+	Async  AsyncConfig  `json:"async"`
+	Sinks  []SinkConfig `json:"sinks"`
+
+	// Brokers are additional MQTT connections by name, which targets
+	// publish to by naming them as their sink
+	Brokers map[string]MQTTConfig `json:"brokers"`
 }
 
 // MQTTConfig holds MQTT connection configuration
@@ -36,7 +44,14 @@ type MQTTConfig struct {
 	ClientID string `json:"clientId"`
 	Username string `json:"username"`
 	Password string `json:"password"`
-	TLS      struct {
+	// Failover lists brokers tried in order when Broker is unreachable
+	Failover []string `json:"failover"`
+	// Failback is how often, in seconds, a connection using a failover
+	// broker checks whether Broker is reachable again; 0 disables it
+	Failback int `json:"failback"`
+	// ProtocolVersion selects MQTT 3.1.1 (4, the default) or MQTT 5 (5)
+	ProtocolVersion int `json:"protocolVersion"`
+	TLS             struct {
 		Enabled bool   `json:"enabled"`
 		CACert  string `json:"caCert"`
 		Cert    string `json:"cert"`
@@ -58,6 +73,62 @@ type APIConfig struct {
 // RulesConfig holds rules directory configuration
 type RulesConfig struct {
 	Directory string `json:"directory"`
+	Watch     bool   `json:"watch"`
+}
+
+// AdminConfig holds admin API configuration
+type AdminConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`
+}
+
+// QueueConfig holds the store-and-forward queue configuration. Zero limits
+// are unlimited.
+type QueueConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Directory   string `json:"directory"`
+	MaxMessages int    `json:"maxMessages"`
+	MaxBytes    int64  `json:"maxBytes"`
+	MaxAge      int    `json:"maxAge"` // seconds
+}
+
+// AsyncConfig holds the asynchronous publish pipeline configuration
+type AsyncConfig struct {
+	Enabled   bool `json:"enabled"`
+	Workers   int  `json:"workers"`
+	QueueSize int  `json:"queueSize"`
+	StatusTTL int  `json:"statusTTL"` // seconds
+}
+
+// Async pipeline defaults
+const (
+	DefaultAsyncWorkers   = 4
+	DefaultAsyncQueueSize = 1000
+	DefaultAsyncStatusTTL = 300
+)
+
+// WorkerCount returns the number of publish workers
+func (a AsyncConfig) WorkerCount() int {
+	if a.Workers == 0 {
+		return DefaultAsyncWorkers
+	}
+	return a.Workers
+}
+
+// QueueCapacity returns the number of jobs that can wait for a worker
+func (a AsyncConfig) QueueCapacity() int {
+	if a.QueueSize == 0 {
+		return DefaultAsyncQueueSize
+	}
+	return a.QueueSize
+}
+
+// StatusRetention returns how long job statuses are kept, in seconds
+func (a AsyncConfig) StatusRetention() int {
+	if a.StatusTTL == 0 {
+		return DefaultAsyncStatusTTL
+	}
+	return a.StatusTTL
 }
 
 // LoggerConfig holds logging configuration
@@ -91,6 +162,14 @@ func LoadConfig(configPath string) (*AppConfig, error) {
 	if !filepath.IsAbs(config.Rules.Directory) {
 		config.Rules.Directory = filepath.Join(filepath.Dir(configPath), config.Rules.Directory)
 	}
+	if config.Queue.Enabled && !filepath.IsAbs(config.Queue.Directory) {
+		config.Queue.Directory = filepath.Join(filepath.Dir(configPath), config.Queue.Directory)
+	}
+	for i, sink := range config.Sinks {
+		if sink.Type == SinkFile && !filepath.IsAbs(sink.Path) {
+			config.Sinks[i].Path = filepath.Join(filepath.Dir(configPath), sink.Path)
+		}
+	}
 
 	return &config, nil
 }
@@ -98,11 +177,8 @@ func LoadConfig(configPath string) (*AppConfig, error) {
 // Validate validates the application configuration
 func (c *AppConfig) Validate() error {
 	// Validate MQTT configuration
-	if c.MQTT.Broker == "" {
-		return fmt.Errorf("MQTT broker URL is required")
-	}
-	if c.MQTT.ClientID == "" {
-		return fmt.Errorf("MQTT client ID is required")
+	if err := c.MQTT.validate(); err != nil {
+		return err
 	}
 
 	// Validate API configuration
@@ -110,13 +186,91 @@ func (c *AppConfig) Validate() error {
 		return fmt.Errorf("invalid API port number")
 	}
 
+	// Validate admin API configuration if enabled
+	if c.Admin.Enabled && c.Admin.Token == "" {
+		return fmt.Errorf("admin token is required when the admin API is enabled")
+	}
+
+	// Validate queue configuration if enabled
+	if c.Queue.Enabled {
+		if c.Queue.Directory == "" {
+			return fmt.Errorf("queue directory is required when the queue is enabled")
+		}
+		if c.Queue.MaxMessages < 0 || c.Queue.MaxBytes < 0 || c.Queue.MaxAge < 0 {
+			return fmt.Errorf("queue limits cannot be negative")
+		}
+	}
+
+	// Validate async publishing configuration if enabled
+	if c.Async.Enabled && (c.Async.Workers < 0 || c.Async.QueueSize < 0 || c.Async.StatusTTL < 0) {
+		return fmt.Errorf("async settings cannot be negative")
+	}
+
+	if err := validateSinks(c.Sinks); err != nil {
+		return err
+	}
+	if err := c.validateBrokers(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validate checks the settings of a broker connection
+func (m *MQTTConfig) validate() error {
+	if m.Broker == "" {
+		return fmt.Errorf("MQTT broker URL is required")
+	}
+	if m.ClientID == "" {
+		return fmt.Errorf("MQTT client ID is required")
+	}
+	if v := m.ProtocolVersion; v != 0 && v != 4 && v != 5 {
+		return fmt.Errorf("MQTT protocol version must be 4 (3.1.1) or 5")
+	}
+	for i, broker := range m.Failover {
+		if broker == "" {
+			return fmt.Errorf("MQTT failover broker %d URL cannot be empty", i)
+		}
+	}
+	if m.Failback < 0 {
+		return fmt.Errorf("MQTT failback interval cannot be negative")
+	}
+
 	// Validate TLS configuration if enabled
-	if c.MQTT.TLS.Enabled {
-		if c.MQTT.TLS.CACert == "" {
+	if m.TLS.Enabled {
+		if m.TLS.CACert == "" {
 			return fmt.Errorf("CA certificate is required when TLS is enabled")
 		}
 	}
+	return nil
+}
+
+// validateBrokers checks the named broker connections. Brokers share their
+// names with sinks, and each needs its own client ID since brokers
+// disconnect clients that reuse one.
+func (c *AppConfig) validateBrokers() error {
+	sinks := make(map[string]bool, len(c.Sinks))
+	for _, sink := range c.Sinks {
+		sinks[sink.Name] = true
+	}
 
+	for name, broker := range c.Brokers {
+		if !sinkNameRegex.MatchString(name) {
+			return fmt.Errorf("broker %s: broker name may only contain letters, digits, '.', '_' and '-'", name)
+		}
+		if name == SinkMQTT {
+			return fmt.Errorf("broker %s: the name %q is reserved for the default broker", name, SinkMQTT)
+		}
+		if sinks[name] {
+			return fmt.Errorf("broker %s: name is already used by a sink", name)
+		}
+		if err := broker.validate(); err != nil {
+			return fmt.Errorf("broker %s: %w", name, err)
+		}
+		if broker.Broker == c.MQTT.Broker && broker.ClientID == c.MQTT.ClientID {
+			return fmt.Errorf("broker %s: client ID %s is already used for the same broker", name, broker.ClientID)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,125 @@
+//file: internal/config/escape.go
+
+package config
+
+import (
+	"fmt"
+	"text/template"
+	"text/template/parse"
+)
+
+// EscapeFuncName is the template function appended to actions that print
+// inside a JSON string literal when JSON escaping is enabled
+const EscapeFuncName = "jsonEscape"
+
+// EscapeJSONStrings rewrites the parse trees of tmpl so that every action
+// printed inside a JSON string literal is piped through jsonEscape. Actions
+// outside string literals (e.g. {{num .x}} or {{toJSON .x}}) are untouched.
+//
+// The position is tracked by scanning the literal text between actions, so
+// branches of if/range/with blocks are assumed to leave the string context
+// the way they found it. Every associated template is rewritten as if it
+// started outside a string, so invoking one with {{template}} or {{block}}
+// inside a string literal is rejected.
+func EscapeJSONStrings(tmpl *template.Template) error {
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		if _, err := escapeList(t.Tree.Root, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeList escapes the actions in a list node and returns whether the
+// output is inside a string literal after the list
+func escapeList(list *parse.ListNode, inString bool) (bool, error) {
+	if list == nil {
+		return inString, nil
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			inString = scanJSONString(n.Text, inString)
+		case *parse.ActionNode:
+			if inString && len(n.Pipe.Decl) == 0 && !endsWithEscape(n.Pipe) {
+				n.Pipe.Cmds = append(n.Pipe.Cmds, escapeCommand(n.Pos))
+			}
+		case *parse.TemplateNode:
+			if inString {
+				return inString, fmt.Errorf("template %q cannot be invoked inside a JSON string when escaping", n.Name)
+			}
+		case *parse.IfNode:
+			after, err := escapeBranch(&n.BranchNode, inString)
+			if err != nil {
+				return inString, err
+			}
+			inString = after
+		case *parse.RangeNode:
+			after, err := escapeBranch(&n.BranchNode, inString)
+			if err != nil {
+				return inString, err
+			}
+			inString = after
+		case *parse.WithNode:
+			after, err := escapeBranch(&n.BranchNode, inString)
+			if err != nil {
+				return inString, err
+			}
+			inString = after
+		}
+	}
+
+	return inString, nil
+}
+
+// escapeBranch escapes both arms of a control structure
+func escapeBranch(branch *parse.BranchNode, inString bool) (bool, error) {
+	after, err := escapeList(branch.List, inString)
+	if err != nil {
+		return inString, err
+	}
+	if _, err := escapeList(branch.ElseList, inString); err != nil {
+		return inString, err
+	}
+	return after, nil
+}
+
+// scanJSONString reports whether text leaves the output inside a JSON string
+// literal, given whether it started inside one
+func scanJSONString(text []byte, inString bool) bool {
+	for i := 0; i < len(text); i++ {
+		switch {
+		case inString && text[i] == '\\':
+			i++
+		case text[i] == '"':
+			inString = !inString
+		}
+	}
+	return inString
+}
+
+// endsWithEscape reports whether a pipeline already ends in jsonEscape
+func endsWithEscape(pipe *parse.PipeNode) bool {
+	if len(pipe.Cmds) == 0 {
+		return false
+	}
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	if len(last.Args) == 0 {
+		return false
+	}
+	ident, ok := last.Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == EscapeFuncName
+}
+
+// escapeCommand builds a pipeline command that calls jsonEscape
+func escapeCommand(pos parse.Pos) *parse.CommandNode {
+	return &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      pos,
+		Args:     []parse.Node{parse.NewIdentifier(EscapeFuncName).SetPos(pos)},
+	}
+}
@@ -0,0 +1,144 @@
+//file: internal/config/escape_test.go
+
+package config
+
+import (
+	"testing"
+	"text/template"
+)
+
+func TestEscapeJSONStrings(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		// want is the rewritten template, ignored when an error is expected
+		want    string
+		wantErr bool
+	}{
+		{
+			name:     "action inside string",
+			template: `{"name": "{{.name}}"}`,
+			want:     `{"name": "{{.name | jsonEscape}}"}`,
+		},
+		{
+			name:     "action outside string",
+			template: `{"count": {{num .count}}, "meta": {{toJSON .meta}}}`,
+			want:     `{"count": {{num .count}}, "meta": {{toJSON .meta}}}`,
+		},
+		{
+			name:     "action after a string",
+			template: `{"a": "x", "b": {{.b}}}`,
+			want:     `{"a": "x", "b": {{.b}}}`,
+		},
+		{
+			name:     "pipeline inside string",
+			template: `{"id": "dev-{{.id | printf "%03v"}}"}`,
+			want:     `{"id": "dev-{{.id | printf "%03v" | jsonEscape}}"}`,
+		},
+		{
+			name:     "escaped quote keeps the string open",
+			template: `{"label": "say \"{{.word}}\""}`,
+			want:     `{"label": "say \"{{.word | jsonEscape}}\""}`,
+		},
+		{
+			name:     "escaped backslash closes the string",
+			template: `{"path": "C:\\", "size": {{.size}}}`,
+			want:     `{"path": "C:\\", "size": {{.size}}}`,
+		},
+		{
+			name:     "if inside string",
+			template: `{"state": "{{if .on}}{{.on}}{{else}}{{.off}}{{end}}", "n": {{.n}}}`,
+			want:     `{"state": "{{if .on}}{{.on | jsonEscape}}{{else}}{{.off | jsonEscape}}{{end}}", "n": {{.n}}}`,
+		},
+		{
+			name:     "range inside string",
+			template: `{"tags": "{{range .tags}}{{.}},{{end}}", "n": {{.n}}}`,
+			want:     `{"tags": "{{range .tags}}{{. | jsonEscape}},{{end}}", "n": {{.n}}}`,
+		},
+		{
+			name:     "strings inside range",
+			template: `[{{range .items}}"{{.}}",{{end}}{{.last}}]`,
+			want:     `[{{range .items}}"{{. | jsonEscape}}",{{end}}{{.last}}]`,
+		},
+		{
+			name:     "pipeline already escaped",
+			template: `{"name": "{{.name | jsonEscape}}", "alias": "{{jsonEscape .alias}}"}`,
+			want:     `{"name": "{{.name | jsonEscape}}", "alias": "{{jsonEscape .alias}}"}`,
+		},
+		{
+			name:     "variable declaration",
+			template: `{"name": "{{$n := .name}}{{$n}}"}`,
+			want:     `{"name": "{{$n := .name}}{{$n | jsonEscape}}"}`,
+		},
+		{
+			name:     "template invoked outside string",
+			template: `{{define "name"}}"{{.}}"{{end}}{"name": {{template "name" .name}}}`,
+			want:     `{"name": {{template "name" .name}}}`,
+		},
+		{
+			name:     "template invoked inside string",
+			template: `{{define "name"}}{{.}}{{end}}{"name": "{{template "name" .name}}"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "template invoked inside string in a branch",
+			template: `{{define "name"}}{{.}}{{end}}{"name": "{{if .name}}{{template "name" .name}}{{end}}"}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New("test").Funcs(templateFuncStubs()).Parse(tt.template)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			err = EscapeJSONStrings(tmpl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EscapeJSONStrings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := tmpl.Tree.Root.String(); got != tt.want {
+				t.Errorf("escaped template = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformValidateEscape(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform Transform
+		wantErr   bool
+	}{
+		{
+			name:      "escaped template",
+			transform: Transform{Template: `{"name": "{{.name}}"}`, Escape: EscapeJSON},
+		},
+		{
+			name:      "template invoked inside string without escaping",
+			transform: Transform{Template: `{{define "n"}}{{.}}{{end}}{"name": "{{template "n" .name}}"}`},
+		},
+		{
+			name:      "template invoked inside escaped string",
+			transform: Transform{Template: `{{define "n"}}{{.}}{{end}}{"name": "{{template "n" .name}}"}`, Escape: EscapeJSON},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs ValidationErrors
+			tt.transform.validate("transform", &errs)
+			if (len(errs) > 0) != tt.wantErr {
+				t.Fatalf("validate() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+			if tt.wantErr && (len(errs) != 1 || errs[0].Field != "transform.template") {
+				t.Errorf("validate() errors = %v, want one error for transform.template", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+//file: internal/config/expression.go
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/itchyny/gojq"
+)
+
+// CompileExpression parses and compiles a jq expression
+func CompileExpression(expr string) (*gojq.Code, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq expression: %w", err)
+	}
+
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jq expression: %w", err)
+	}
+
+	return code, nil
+}
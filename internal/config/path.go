@@ -0,0 +1,224 @@
+//file: internal/config/path.go
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// ParamFuncName is the template function that reads a URL parameter of the
+// rule's API path
+const ParamFuncName = "param"
+
+// paramNameRegex matches valid path parameter names
+var paramNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PathParams returns the names of the parameters in an API path such as
+// /api/v1/devices/{deviceId}/telemetry, in order. A parameter spans a whole
+// path segment and may restrict its values with a regular expression, as in
+// {id:[0-9]+}.
+func PathParams(path string) ([]string, error) {
+	var params []string
+	seen := make(map[string]bool)
+	for _, segment := range strings.Split(path, "/") {
+		if !strings.ContainsAny(segment, "{}") {
+			continue
+		}
+
+		name, pattern, err := parseParamSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+		if !paramNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid path parameter name %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate path parameter %q", name)
+		}
+		if pattern != "" {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern for path parameter %q: %w", name, err)
+			}
+		}
+		seen[name] = true
+		params = append(params, name)
+	}
+	return params, nil
+}
+
+// parseParamSegment splits a {name} or {name:pattern} path segment
+func parseParamSegment(segment string) (name, pattern string, err error) {
+	if len(segment) < 2 || segment[0] != '{' || segment[len(segment)-1] != '}' {
+		return "", "", fmt.Errorf("path parameter %q must span a whole path segment", segment)
+	}
+
+	// Patterns may contain braces of their own, which must be balanced so
+	// that the router finds the end of the parameter
+	depth := 0
+	for i, c := range segment {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+		if depth == 0 && i < len(segment)-1 {
+			return "", "", fmt.Errorf("path parameter %q must span a whole path segment", segment)
+		}
+	}
+	if depth != 0 {
+		return "", "", fmt.Errorf("path parameter %q has unbalanced braces", segment)
+	}
+
+	name = segment[1 : len(segment)-1]
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name, pattern = name[:i], name[i+1:]
+	}
+	return name, pattern, nil
+}
+
+// routePattern returns an API path with its parameter names removed, so
+// that paths matching the same requests compare equal
+func routePattern(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, pattern, err := parseParamSegment(segment); err == nil && name != "" {
+			segments[i] = "{:" + pattern + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// validatePathParams checks the parameters of the rule's API path and that
+// its templates only read parameters the path defines. Rules without an
+// HTTP source have no parameters.
+func (r *Rule) validatePathParams(errs *ValidationErrors) {
+	defined := make(map[string]bool)
+	if r.SourceType() == SourceHTTP {
+		params, err := PathParams(r.API.Path)
+		if err != nil {
+			errs.add("api.path", err)
+			return
+		}
+		for _, name := range params {
+			defined[name] = true
+		}
+	}
+
+	templates := r.paramTemplates()
+	fields := make([]string, 0, len(templates))
+	for field := range templates {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		for _, name := range templateParams(templates[field]) {
+			if !defined[name] {
+				errs.add(field, fmt.Errorf("path parameter %q is not defined by api.path", name))
+			}
+		}
+	}
+}
+
+// paramTemplates returns the templates that can read path parameters by
+// field: transform templates, topics and property templates
+func (r *Rule) paramTemplates() map[string]string {
+	templates := make(map[string]string)
+	add := func(field string, transform *Transform, target TargetMQTT) {
+		if transform != nil && transform.EngineType() == TransformTemplate {
+			templates[field+"transform.template"] = transform.Template
+		}
+		templates[field+"topic"] = target.Topic
+		if p := target.Properties; p != nil {
+			templates[field+"properties.responseTopic"] = p.ResponseTopic
+			templates[field+"properties.correlationData"] = p.CorrelationData
+			for key, value := range p.UserProperties {
+				templates[field+"properties.userProperties."+key] = value
+			}
+		}
+	}
+
+	if r.Transform.EngineType() == TransformTemplate {
+		templates["transform.template"] = r.Transform.Template
+	}
+	add("target.", nil, r.Target)
+	for i, target := range r.Targets {
+		add(fmt.Sprintf("targets[%d].", i), target.Transform, target.TargetMQTT)
+	}
+	for i, route := range r.Routes {
+		add(fmt.Sprintf("routes[%d].", i), route.Transform, route.TargetMQTT)
+	}
+	return templates
+}
+
+// templateParams returns the parameter names a template passes to the param
+// function as string literals. Templates that do not parse are reported by
+// their own validation.
+func templateParams(text string) []string {
+	if !strings.Contains(text, ParamFuncName) {
+		return nil
+	}
+	tmpl, err := template.New("params").Funcs(propertyFuncStubs()).Parse(text)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) == 2 {
+				ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+				name, isString := n.Args[1].(*parse.StringNode)
+				if isIdent && isString && ident.Ident == ParamFuncName {
+					names = append(names, name.Text)
+				}
+			}
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+	return names
+}
@@ -0,0 +1,211 @@
+//file: internal/config/path_test.go
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPathParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "no parameters", path: "/api/v1/devices", want: nil},
+		{name: "one parameter", path: "/api/v1/devices/{deviceId}/telemetry", want: []string{"deviceId"}},
+		{name: "several in order", path: "/sites/{site}/devices/{id}", want: []string{"site", "id"}},
+		{name: "pattern", path: "/devices/{id:[0-9]+}", want: []string{"id"}},
+		{name: "pattern with braces", path: "/devices/{id:[a-f0-9]{8}}", want: []string{"id"}},
+		{name: "underscore name", path: "/devices/{_id2}", want: []string{"_id2"}},
+		{name: "partial segment", path: "/devices/id-{id}", wantErr: true},
+		{name: "suffix after parameter", path: "/devices/{id}.json", wantErr: true},
+		{name: "two in one segment", path: "/devices/{a}{b}", wantErr: true},
+		{name: "unbalanced braces", path: "/devices/{id:[0-9]{2}", wantErr: true},
+		{name: "stray closing brace", path: "/devices/id}", wantErr: true},
+		{name: "empty name", path: "/devices/{}", wantErr: true},
+		{name: "empty name with pattern", path: "/devices/{:[0-9]+}", wantErr: true},
+		{name: "invalid name", path: "/devices/{device-id}", wantErr: true},
+		{name: "name starting with digit", path: "/devices/{1id}", wantErr: true},
+		{name: "duplicate name", path: "/devices/{id}/parts/{id}", wantErr: true},
+		{name: "invalid pattern", path: "/devices/{id:[0-9}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PathParams(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PathParams(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PathParams(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "static", path: "/api/v1/devices", want: "/api/v1/devices"},
+		{name: "parameter", path: "/devices/{id}/status", want: "/devices/{:}/status"},
+		{name: "pattern kept", path: "/devices/{id:[0-9]+}", want: "/devices/{:[0-9]+}"},
+		{name: "several", path: "/{site}/{id}", want: "/{:}/{:}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routePattern(tt.path); got != tt.want {
+				t.Errorf("routePattern(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateParams(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "none", text: "devices/{{.id}}", want: nil},
+		{name: "action", text: `devices/{{param "id"}}`, want: []string{"id"}},
+		{name: "several", text: `{{param "site"}}/{{param "id"}}`, want: []string{"site", "id"}},
+		{name: "pipeline", text: `{{param "id" | printf "%s"}}`, want: []string{"id"}},
+		{name: "nested command", text: `{{printf "%s" (param "id")}}`, want: []string{"id"}},
+		{name: "if", text: `{{if param "id"}}{{param "id"}}{{else}}{{param "fallback"}}{{end}}`, want: []string{"id", "id", "fallback"}},
+		{name: "range and with", text: `{{range .items}}{{param "a"}}{{end}}{{with .x}}{{param "b"}}{{end}}`, want: []string{"a", "b"}},
+		{name: "defined template", text: `{{define "t"}}{{param "inner"}}{{end}}{{template "t"}}`, want: []string{"inner"}},
+		{name: "non-literal name", text: `{{param .name}}`, want: nil},
+		{name: "unparsable", text: `{{param "id"`, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := templateParams(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("templateParams(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePathParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr string
+	}{
+		{
+			name: "defined parameters",
+			rule: Rule{
+				API:       RuleAPI{Method: "POST", Path: "/devices/{id}"},
+				Transform: Transform{Template: `{"id": "{{param "id"}}"}`},
+				Target:    TargetMQTT{Topic: `devices/{{param "id"}}`},
+			},
+		},
+		{
+			name: "invalid path",
+			rule: Rule{
+				API:    RuleAPI{Method: "POST", Path: "/devices/{device-id}"},
+				Target: TargetMQTT{Topic: "devices"},
+			},
+			wantErr: "api.path",
+		},
+		{
+			name: "undefined in topic",
+			rule: Rule{
+				API:    RuleAPI{Method: "POST", Path: "/devices/{id}"},
+				Target: TargetMQTT{Topic: `sites/{{param "site"}}`},
+			},
+			wantErr: "target.topic",
+		},
+		{
+			name: "undefined in transform",
+			rule: Rule{
+				API:       RuleAPI{Method: "POST", Path: "/devices"},
+				Transform: Transform{Template: `{"id": "{{param "id"}}"}`},
+				Target:    TargetMQTT{Topic: "devices"},
+			},
+			wantErr: "transform.template",
+		},
+		{
+			name: "undefined in property",
+			rule: Rule{
+				API: RuleAPI{Method: "POST", Path: "/devices/{id}"},
+				Target: TargetMQTT{Topic: "devices", Properties: &PublishProperties{
+					UserProperties: map[string]string{"site": `{{param "site"}}`},
+				}},
+			},
+			wantErr: "target.properties.userProperties.site",
+		},
+		{
+			name: "undefined in fan-out target",
+			rule: Rule{
+				API:     RuleAPI{Method: "POST", Path: "/devices/{id}"},
+				Targets: []Target{{TargetMQTT: TargetMQTT{Topic: `a/{{param "id"}}`}}, {TargetMQTT: TargetMQTT{Topic: `b/{{param "x"}}`}}},
+			},
+			wantErr: "targets[1].topic",
+		},
+		{
+			name: "undefined in route",
+			rule: Rule{
+				API:    RuleAPI{Method: "POST", Path: "/devices"},
+				Routes: []Route{{Target: Target{TargetMQTT: TargetMQTT{Topic: `r/{{param "id"}}`}}}},
+			},
+			wantErr: "routes[0].topic",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs ValidationErrors
+			tt.rule.validatePathParams(&errs)
+			err := errs.err()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validatePathParams() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validatePathParams() error = %v, want error for %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRuleSetRoutes(t *testing.T) {
+	rule := func(id, method, path string) Rule {
+		return Rule{ID: id, API: RuleAPI{Method: method, Path: path}}
+	}
+
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr bool
+	}{
+		{name: "distinct paths", rules: []Rule{rule("a", "POST", "/devices"), rule("b", "POST", "/sites")}},
+		{name: "same path other method", rules: []Rule{rule("a", "POST", "/devices/{id}"), rule("b", "PUT", "/devices/{id}")}},
+		{name: "different patterns", rules: []Rule{rule("a", "POST", "/devices/{id:[0-9]+}"), rule("b", "POST", "/devices/{name:[a-z]+}")}},
+		{name: "static beside parameter", rules: []Rule{rule("a", "POST", "/devices/all"), rule("b", "POST", "/devices/{id}")}},
+		{name: "same path", rules: []Rule{rule("a", "POST", "/devices"), rule("b", "POST", "/devices")}, wantErr: true},
+		{name: "parameter names differ", rules: []Rule{rule("a", "POST", "/devices/{id}"), rule("b", "POST", "/devices/{deviceId}")}, wantErr: true},
+		{name: "same pattern", rules: []Rule{rule("a", "POST", "/d/{id:[0-9]+}"), rule("b", "POST", "/d/{n:[0-9]+}")}, wantErr: true},
+		{name: "duplicate id", rules: []Rule{rule("a", "POST", "/devices"), rule("a", "POST", "/sites")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRuleSet(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRuleSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
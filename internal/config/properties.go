@@ -0,0 +1,66 @@
+//file: internal/config/properties.go
+
+package config
+
+import (
+	"fmt"
+	"math"
+	"text/template"
+)
+
+// PublishProperties are MQTT v5 properties set on published messages. The
+// response topic is a topic template like the target topic; correlation
+// data and user property values are templates over the payload that may
+// also read request headers with the header function.
+type PublishProperties struct {
+	ContentType string `json:"contentType,omitempty"`
+	// MessageExpiry is the message lifetime in seconds, 0 for none
+	MessageExpiry   int64             `json:"messageExpiry,omitempty"`
+	ResponseTopic   string            `json:"responseTopic,omitempty"`
+	CorrelationData string            `json:"correlationData,omitempty"`
+	UserProperties  map[string]string `json:"userProperties,omitempty"`
+}
+
+// propertyFuncStubs returns stand-ins for the functions available to
+// property templates so they can be parsed during validation
+func propertyFuncStubs() template.FuncMap {
+	funcs := templateFuncStubs()
+	funcs["header"] = func(name string) string { return "" }
+	return funcs
+}
+
+// validate checks the expiry, response topic and property templates
+func (p *PublishProperties) validate(field string, errs *ValidationErrors) {
+	if p == nil {
+		return
+	}
+
+	if p.MessageExpiry < 0 || p.MessageExpiry > math.MaxUint32 {
+		errs.add(field+".messageExpiry", fmt.Errorf("message expiry must be between 0 and %d seconds", uint32(math.MaxUint32)))
+	}
+	if p.ResponseTopic != "" {
+		if err := ValidateTopicTemplate(p.ResponseTopic); err != nil {
+			errs.add(field+".responseTopic", err)
+		}
+	}
+	if err := validatePropertyTemplate(p.CorrelationData); err != nil {
+		errs.add(field+".correlationData", err)
+	}
+	for key, value := range p.UserProperties {
+		if key == "" {
+			errs.add(field+".userProperties", fmt.Errorf("user property name cannot be empty"))
+			continue
+		}
+		if err := validatePropertyTemplate(value); err != nil {
+			errs.add(field+".userProperties."+key, err)
+		}
+	}
+}
+
+// validatePropertyTemplate checks the syntax of a property value template
+func validatePropertyTemplate(value string) error {
+	if _, err := template.New("property").Funcs(propertyFuncStubs()).Parse(value); err != nil {
+		return fmt.Errorf("invalid template syntax: %w", err)
+	}
+	return nil
+}
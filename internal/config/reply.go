@@ -0,0 +1,75 @@
+//file: internal/config/reply.go
+
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reply defaults
+const (
+	DefaultReplyTimeout = 10 // seconds
+	// maxReplyTimeout keeps the wait within the HTTP server's 30 second
+	// request timeout
+	maxReplyTimeout = 25
+)
+
+// Reply makes an HTTP rule wait for a reply to the message it publishes and
+// return it to the caller. The message is published with Topic as its MQTT
+// v5 response topic and a generated correlation ID as its correlation data;
+// the first message on Topic carrying the same correlation data is the reply.
+type Reply struct {
+	Topic string `json:"topic"`
+	// Timeout is how long to wait for the reply, in seconds
+	Timeout int `json:"timeout,omitempty"`
+	// Transform is applied to the reply before it is returned; replies are
+	// returned unchanged without one
+	Transform *Transform `json:"transform,omitempty"`
+}
+
+// WaitTimeout returns how long to wait for the reply
+func (r *Reply) WaitTimeout() time.Duration {
+	if r.Timeout == 0 {
+		return DefaultReplyTimeout * time.Second
+	}
+	return time.Duration(r.Timeout) * time.Second
+}
+
+// validateReply checks the reply configuration. A reply is only possible
+// when each request publishes a single message.
+func (r *Rule) validateReply(errs *ValidationErrors) {
+	if r.SourceType() != SourceHTTP {
+		errs.add("reply", fmt.Errorf("reply requires an %s source", SourceHTTP))
+	}
+	if len(r.Targets) > 0 {
+		errs.add("reply", fmt.Errorf("reply cannot be combined with targets"))
+	}
+	for _, sink := range r.SinkNames() {
+		if sink != "" && sink != SinkMQTT {
+			errs.add("reply", fmt.Errorf("reply rules must publish to the %s sink", SinkMQTT))
+			break
+		}
+	}
+	if r.Transform.Fanout() {
+		errs.add("transform.multiple", fmt.Errorf("reply rules must publish a single message"))
+	}
+	for i, route := range r.Routes {
+		if route.Transform != nil && route.Transform.Fanout() {
+			errs.add(fmt.Sprintf("routes[%d].transform.multiple", i), fmt.Errorf("reply rules must publish a single message"))
+		}
+	}
+
+	if err := ValidateTopic(r.Reply.Topic); err != nil {
+		errs.add("reply.topic", err)
+	}
+	if r.Reply.Timeout < 0 || r.Reply.Timeout > maxReplyTimeout {
+		errs.add("reply.timeout", fmt.Errorf("reply timeout must be between 0 and %d seconds", maxReplyTimeout))
+	}
+	if t := r.Reply.Transform; t != nil {
+		t.validate("reply.transform", errs)
+		if t.Fanout() {
+			errs.add("reply.transform.multiple", fmt.Errorf("reply transform must produce a single result"))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+//file: internal/config/route.go
+
+package config
+
+import (
+	"fmt"
+)
+
+// Route actions
+const (
+	RoutePublish = "publish"
+	RouteDrop    = "drop"
+)
+
+// Route sends messages matching its condition to its own target. Routes are
+// tried in order and the first match wins; a route without a condition is
+// the default and must come last. Drop routes accept the message without
+// publishing it.
+type Route struct {
+	// Condition is a jq expression evaluated against the input payload; the
+	// route matches when its first result is neither false nor null
+	Condition string `json:"condition,omitempty"`
+	Action    string `json:"action,omitempty"`
+	Target
+}
+
+// IsDefault reports whether the route matches every message
+func (r *Route) IsDefault() bool {
+	return r.Condition == ""
+}
+
+// Drops reports whether the route discards matching messages
+func (r *Route) Drops() bool {
+	return r.Action == RouteDrop
+}
+
+// validateRoutes checks the routes list
+func (r *Rule) validateRoutes(errs *ValidationErrors) {
+	if r.Target.Topic != "" {
+		errs.add("target", fmt.Errorf("target cannot be combined with routes"))
+	}
+	if len(r.Targets) > 0 {
+		errs.add("targets", fmt.Errorf("targets cannot be combined with routes"))
+	}
+	if r.Policy != "" {
+		errs.add("policy", fmt.Errorf("policy is only allowed with targets"))
+	}
+
+	// The rule transform is the default for routes without their own
+	useRuleTransform := !r.Transform.isZero()
+	names := make(map[string]int, len(r.Routes))
+	for i, route := range r.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+
+		if route.Name == "" {
+			errs.add(field+".name", fmt.Errorf("route name is required"))
+		} else if prev, exists := names[route.Name]; exists {
+			errs.add(field+".name", fmt.Errorf("duplicate route name %s (also used by routes[%d])", route.Name, prev))
+		} else {
+			names[route.Name] = i
+		}
+
+		if route.IsDefault() {
+			if i != len(r.Routes)-1 {
+				errs.add(field+".condition", fmt.Errorf("only the last route may omit its condition"))
+			}
+		} else if _, err := CompileExpression(route.Condition); err != nil {
+			errs.add(field+".condition", err)
+		}
+
+		switch route.Action {
+		case RouteDrop:
+			if route.Topic != "" || route.Transform != nil || route.Schema != nil {
+				errs.add(field, fmt.Errorf("drop routes cannot have a topic, transform or schema"))
+			}
+			continue
+		case "", RoutePublish:
+		default:
+			errs.add(field+".action", fmt.Errorf("invalid action: %s, must be %q or %q", route.Action, RoutePublish, RouteDrop))
+			continue
+		}
+
+		if route.Transform == nil {
+			useRuleTransform = true
+		}
+		route.validate(field, errs)
+	}
+
+	if useRuleTransform {
+		r.Transform.validate("transform", errs)
+	}
+}
@@ -7,41 +7,123 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strconv"
-	"text/template"
-	"time"
+	"regexp"
+	"strings"
 
 	"go.uber.org/zap"
 )
 
+// ruleFileRegex restricts the IDs that can be turned into rule file names
+var ruleFileRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
 // Rule represents a single message transformation rule
 type Rule struct {
-	ID          string     `json:"id"`
-	Description string     `json:"description"`
-	API         RuleAPI    `json:"api"`
-	Transform   Transform  `json:"transform"`
-	Target      TargetMQTT `json:"target"`
+	ID          string      `json:"id"`
+	Description string      `json:"description"`
+	API         RuleAPI     `json:"api"`
+	Transform   Transform   `json:"transform"`
+	Target      TargetMQTT  `json:"target"`
+	Schema      *RuleSchema `json:"schema,omitempty"`
+
+	// Targets publishes to several destinations instead of Target, with
+	// Policy ("all_or_nothing" or "best_effort") governing partial failures
+	Targets []Target `json:"targets,omitempty"`
+	Policy  string   `json:"policy,omitempty"`
+
+	// Routes sends each message to the target of the first route whose
+	// condition matches, instead of Target
+	Routes []Route `json:"routes,omitempty"`
+
+	// Filter is a jq expression; messages for which it yields false or null
+	// are accepted but not published
+	Filter string `json:"filter,omitempty"`
+
+	// Source selects where input messages come from, defaulting to HTTP
+	Source *RuleSource `json:"source,omitempty"`
+
+	// Webhook delivers messages of MQTT source rules to an HTTP endpoint
+	// instead of Target
+	Webhook *Webhook `json:"webhook,omitempty"`
+
+	// Reply waits for a reply to the published message and returns it as
+	// the HTTP response
+	Reply *Reply `json:"reply,omitempty"`
+
+	// Batch accepts requests holding several messages, each transformed
+	// and published on its own
+	Batch *Batch `json:"batch,omitempty"`
+
+	// File is the name of the file the rule was loaded from
+	File string `json:"-"`
 }
 
 // RuleAPI holds the API configuration for a rule
 type RuleAPI struct {
 	Method string `json:"method"`
 	Path   string `json:"path"`
-}
-
-// Transform holds the message transformation configuration
-type Transform struct {
-	Template string `json:"template"`
+	// RequestContext passes transforms the request details with the
+	// payload under body, instead of the payload itself
+	RequestContext bool `json:"requestContext,omitempty"`
 }
 
 // TargetMQTT holds the target MQTT configuration for transformed messages
 type TargetMQTT struct {
-	Topic   string `json:"topic"`
-	QoS     int    `json:"qos"`
-	Retain  bool   `json:"retain"`
+	Topic      string             `json:"topic"`
+	QoS        int                `json:"qos"`
+	Retain     bool               `json:"retain"`
+	Properties *PublishProperties `json:"properties,omitempty"`
+	// Sink names the output messages are published to, defaulting to the
+	// MQTT broker
+	Sink string `json:"sink,omitempty"`
 }
 
-// LoadRules loads and validates all rules from the specified directory
+// ValidationError describes a single invalid field in a rule
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects all problems found while validating rules
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, ve := range e {
+		msgs[i] = fmt.Sprintf("%s: %s", ve.Field, ve.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// add records a validation error for the given field
+func (e *ValidationErrors) add(field string, err error) {
+	*e = append(*e, ValidationError{Field: field, Message: err.Error()})
+}
+
+// err returns the collected errors, or nil if there are none
+func (e ValidationErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ParseRule decodes, validates and compiles a single rule from JSON
+func ParseRule(data []byte, rulesDir string) (Rule, error) {
+	var rule Rule
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return Rule{}, fmt.Errorf("failed to parse rule: %w", err)
+	}
+	if err := rule.Validate(); err != nil {
+		return Rule{}, err
+	}
+	if err := rule.Compile(rulesDir); err != nil {
+		return Rule{}, err
+	}
+	return rule, nil
+}
+
+// LoadRules loads and validates all rules from the specified directory.
+// Schema files, named with SchemaFileSuffix, are skipped.
 func LoadRules(rulesDir string, logger *zap.Logger) ([]Rule, error) {
 	files, err := os.ReadDir(rulesDir)
 	if err != nil {
@@ -50,7 +132,7 @@ func LoadRules(rulesDir string, logger *zap.Logger) ([]Rule, error) {
 
 	var rules []Rule
 	for _, file := range files {
-		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+		if !isRuleFile(file) {
 			continue
 		}
 
@@ -64,12 +146,18 @@ func LoadRules(rulesDir string, logger *zap.Logger) ([]Rule, error) {
 		if err := json.Unmarshal(data, &rule); err != nil {
 			return nil, fmt.Errorf("failed to parse rule file %s: %w", file.Name(), err)
 		}
+		rule.File = file.Name()
 
 		// Validate the rule
 		if err := rule.Validate(); err != nil {
 			return nil, fmt.Errorf("invalid rule in file %s: %w", file.Name(), err)
 		}
 
+		// Compile the rule's schemas
+		if err := rule.Compile(rulesDir); err != nil {
+			return nil, fmt.Errorf("invalid rule in file %s: %w", file.Name(), err)
+		}
+
 		logger.Info("Loaded rule",
 			zap.String("id", rule.ID),
 			zap.String("file", file.Name()))
@@ -77,101 +165,190 @@ func LoadRules(rulesDir string, logger *zap.Logger) ([]Rule, error) {
 		rules = append(rules, rule)
 	}
 
+	// Validate the rule set as a whole
+	if err := ValidateRuleSet(rules); err != nil {
+		return nil, fmt.Errorf("invalid rule set: %w", err)
+	}
+
 	return rules, nil
 }
 
-// Validate validates a rule configuration
-func (r *Rule) Validate() error {
-	if r.ID == "" {
-		return fmt.Errorf("rule ID is required")
+// isRuleFile reports whether a directory entry holds a rule
+func isRuleFile(file os.DirEntry) bool {
+	name := file.Name()
+	return !file.IsDir() && filepath.Ext(name) == ".json" && !strings.HasSuffix(name, SchemaFileSuffix)
+}
+
+// ValidateRuleSet checks that rules do not clash with each other
+func ValidateRuleSet(rules []Rule) error {
+	var errs ValidationErrors
+	ids := make(map[string]Rule, len(rules))
+	routes := make(map[string]Rule, len(rules))
+
+	for _, rule := range rules {
+		if other, exists := ids[rule.ID]; exists {
+			errs.add("id", fmt.Errorf("duplicate rule ID %s (also defined in %s)", rule.ID, other.File))
+			continue
+		}
+		ids[rule.ID] = rule
+
+		// Only HTTP rules are served at their API path
+		if rule.SourceType() != SourceHTTP {
+			continue
+		}
+		// Paths differing only in parameter names match the same requests
+		route := rule.API.Method + " " + routePattern(rule.API.Path)
+		if other, exists := routes[route]; exists {
+			if other.API.Path == rule.API.Path {
+				errs.add("api", fmt.Errorf("route %s %s of rule %s is already used by rule %s", rule.API.Method, rule.API.Path, rule.ID, other.ID))
+			} else {
+				errs.add("api", fmt.Errorf("route %s %s of rule %s conflicts with %s of rule %s", rule.API.Method, rule.API.Path, rule.ID, other.API.Path, other.ID))
+			}
+			continue
+		}
+		routes[route] = rule
 	}
 
-	// Validate API configuration
-	if err := ValidateHTTPMethod(r.API.Method); err != nil {
-		return fmt.Errorf("invalid API configuration: %w", err)
+	return errs.err()
+}
+
+// RuleFileName returns the file name used to persist a new rule
+func RuleFileName(id string) (string, error) {
+	if !ruleFileRegex.MatchString(id) {
+		return "", ValidationErrors{{
+			Field:   "id",
+			Message: "rule ID may only contain letters, digits, '.', '_' and '-'",
+		}}
 	}
-	if r.API.Path == "" || r.API.Path[0] != '/' {
-		return fmt.Errorf("API path must start with /")
+	name := id + ".json"
+	if strings.HasSuffix(name, SchemaFileSuffix) {
+		return "", ValidationErrors{{
+			Field:   "id",
+			Message: fmt.Sprintf("rule ID would give a schema file name ending in %s", SchemaFileSuffix),
+		}}
 	}
+	return name, nil
+}
 
-	// Validate template
-	if r.Transform.Template == "" {
-		return fmt.Errorf("transformation template is required")
+// SaveRule atomically writes a rule to its file in the rules directory
+func SaveRule(rulesDir string, rule Rule) error {
+	if rule.File == "" {
+		return fmt.Errorf("rule %s has no backing file", rule.ID)
 	}
 
-	// Create template with all supported functions for validation
-	tmpl := template.New("validator").Funcs(template.FuncMap{
-		"toJSON": func(v interface{}) string {
-			b, err := json.Marshal(v)
-			if err != nil {
-				return ""
-			}
-			return string(b)
-		},
-		"fromJSON": func(s string) interface{} {
-			var v interface{}
-			if err := json.Unmarshal([]byte(s), &v); err != nil {
-				return nil
-			}
-			return v
-		},
-		"now": func() string {
-			return time.Now().UTC().Format(time.RFC3339)
-		},
-		"uuid7": func() string {
-			return "00000000-0000-7000-0000-000000000000"
-		},
-		"num": func(v interface{}) string {
-			switch n := v.(type) {
-			case float64:
-				return strconv.FormatFloat(n, 'f', -1, 64)
-			case float32:
-				return strconv.FormatFloat(float64(n), 'f', -1, 32)
-			case int:
-				return strconv.Itoa(n)
-			case int64:
-				return strconv.FormatInt(n, 10)
-			case int32:
-				return strconv.FormatInt(int64(n), 10)
-			case string:
-				if _, err := strconv.ParseFloat(n, 64); err == nil {
-					return n
-				}
-				return "0"
-			default:
-				return "0"
-			}
-		},
-		"bool": func(v interface{}) string {
-			switch b := v.(type) {
-			case bool:
-				return strconv.FormatBool(b)
-			case string:
-				if b == "true" || b == "false" {
-					return b
-				}
-				return "false"
-			case int, int64, float64:
-				return "true"
-			case nil:
-				return "false"
-			default:
-				return "false"
-			}
-		},
-	})
+	data, err := json.MarshalIndent(rule, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode rule: %w", err)
+	}
+	data = append(data, '\n')
 
-	if _, err := tmpl.Parse(r.Transform.Template); err != nil {
-		return fmt.Errorf("invalid template syntax: %w", err)
+	// Write to a temporary file first so watchers never see a partial rule
+	tmp, err := os.CreateTemp(rulesDir, ".rule-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create rule file: %w", err)
 	}
+	defer os.Remove(tmp.Name())
 
-	// Validate MQTT configuration
-	if err := ValidateTopic(r.Target.Topic); err != nil {
-		return fmt.Errorf("invalid target configuration: %w", err)
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write rule file: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write rule file: %w", err)
 	}
-	if err := ValidateQoS(r.Target.QoS); err != nil {
-		return fmt.Errorf("invalid target configuration: %w", err)
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write rule file: %w", err)
 	}
+	if err := os.Rename(tmp.Name(), filepath.Join(rulesDir, rule.File)); err != nil {
+		return fmt.Errorf("failed to write rule file: %w", err)
+	}
+
+	return nil
+}
 
+// DeleteRule removes the file backing a rule from the rules directory
+func DeleteRule(rulesDir string, rule Rule) error {
+	if rule.File == "" {
+		return fmt.Errorf("rule %s has no backing file", rule.ID)
+	}
+	if err := os.Remove(filepath.Join(rulesDir, rule.File)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete rule file: %w", err)
+	}
 	return nil
 }
+
+// Validate validates a rule configuration, reporting every invalid field
+func (r *Rule) Validate() error {
+	var errs ValidationErrors
+
+	if r.ID == "" {
+		errs.add("id", fmt.Errorf("rule ID is required"))
+	}
+
+	// Validate the message source
+	switch r.SourceType() {
+	case SourceHTTP:
+		if err := ValidateHTTPMethod(r.API.Method); err != nil {
+			errs.add("api.method", err)
+		}
+		if r.API.Path == "" || r.API.Path[0] != '/' {
+			errs.add("api.path", fmt.Errorf("API path must start with /"))
+		}
+	case SourceMQTT:
+		r.validateSource(&errs)
+		if r.API.RequestContext {
+			errs.add("api.requestContext", fmt.Errorf("request context requires an %s source", SourceHTTP))
+		}
+	default:
+		errs.add("source.type", fmt.Errorf("invalid source type: %s, must be %q or %q", r.Source.Type, SourceHTTP, SourceMQTT))
+	}
+	r.validatePathParams(&errs)
+
+	switch {
+	case r.Webhook != nil:
+		r.validateWebhook(&errs)
+	case len(r.Routes) > 0:
+		r.validateRoutes(&errs)
+	case len(r.Targets) > 0:
+		r.validateTargets(&errs)
+	default:
+		// Validate transformation
+		r.Transform.validate("transform", &errs)
+
+		// Validate MQTT configuration
+		if err := ValidateTopicTemplate(r.Target.Topic); err != nil {
+			errs.add("target.topic", err)
+		}
+		if err := ValidateQoS(r.Target.QoS); err != nil {
+			errs.add("target.qos", err)
+		}
+		r.Target.Properties.validate("target.properties", &errs)
+		validateSink("target.sink", r.Target.Sink, &errs)
+		if r.Policy != "" {
+			errs.add("policy", fmt.Errorf("policy is only allowed with targets"))
+		}
+	}
+
+	if r.Reply != nil {
+		r.validateReply(&errs)
+	}
+
+	if r.Batch != nil {
+		r.validateBatch(&errs)
+	}
+
+	if r.Filter != "" {
+		if _, err := CompileExpression(r.Filter); err != nil {
+			errs.add("filter", err)
+		}
+	}
+
+	// Validate schema references
+	if r.Schema != nil {
+		r.Schema.Input.validate("schema.input", &errs)
+		r.Schema.Output.validate("schema.output", &errs)
+	}
+
+	return errs.err()
+}
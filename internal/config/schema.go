@@ -0,0 +1,186 @@
+//file: internal/config/schema.go
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// RuleSchema references the JSON Schemas used to validate a rule's messages
+type RuleSchema struct {
+	Input  *SchemaRef `json:"input,omitempty"`
+	Output *SchemaRef `json:"output,omitempty"`
+}
+
+// SchemaRef points to a JSON Schema defined inline or in a file. Relative
+// file paths are resolved against the rules directory.
+type SchemaRef struct {
+	File   string      `json:"file,omitempty"`
+	Inline interface{} `json:"inline,omitempty"`
+
+	compiled *jsonschema.Schema
+	// document is the schema the compiled schema was built from, so that
+	// edits to schema files can be detected
+	document []byte
+}
+
+// Compiled returns the compiled schema, or nil if it has not been compiled
+func (s *SchemaRef) Compiled() *jsonschema.Schema {
+	if s == nil {
+		return nil
+	}
+	return s.compiled
+}
+
+// validate checks that exactly one schema source is set
+func (s *SchemaRef) validate(field string, errs *ValidationErrors) {
+	if s == nil {
+		return
+	}
+	if (s.File == "") == (s.Inline == nil) {
+		errs.add(field, fmt.Errorf("exactly one of file or inline must be set"))
+	}
+}
+
+// SchemaFileSuffix marks schema files, which are never loaded as rules even
+// when kept in the rules directory itself
+const SchemaFileSuffix = ".schema.json"
+
+// path returns the schema file path resolved against the rules directory
+func (s *SchemaRef) path(rulesDir string) string {
+	if filepath.IsAbs(s.File) {
+		return s.File
+	}
+	return filepath.Join(rulesDir, s.File)
+}
+
+// compile compiles the referenced schema
+func (s *SchemaRef) compile(rulesDir, name string) error {
+	compiler := jsonschema.NewCompiler()
+
+	var url string
+	var data []byte
+	if s.File != "" {
+		url = s.path(rulesDir)
+		var err error
+		if data, err = os.ReadFile(url); err != nil {
+			return fmt.Errorf("failed to read schema: %w", err)
+		}
+	} else {
+		var err error
+		if data, err = json.Marshal(s.Inline); err != nil {
+			return fmt.Errorf("failed to encode inline schema: %w", err)
+		}
+		url = "inline://" + name + ".json"
+	}
+	if err := compiler.AddResource(url, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+	s.compiled = compiled
+	s.document = data
+	return nil
+}
+
+// schemaRefs returns the rule's schema references, including those of its
+// targets and routes, in a fixed order
+func (r *Rule) schemaRefs() []*SchemaRef {
+	var refs []*SchemaRef
+	if r.Schema != nil {
+		refs = append(refs, r.Schema.Input, r.Schema.Output)
+	}
+	for _, target := range r.Targets {
+		refs = append(refs, target.Schema)
+	}
+	for _, route := range r.Routes {
+		refs = append(refs, route.Schema)
+	}
+	return refs
+}
+
+// SchemaFiles returns the paths of the schema files the rule references,
+// resolved against the rules directory
+func (r *Rule) SchemaFiles(rulesDir string) []string {
+	var files []string
+	for _, ref := range r.schemaRefs() {
+		if ref != nil && ref.File != "" {
+			files = append(files, ref.path(rulesDir))
+		}
+	}
+	return files
+}
+
+// SameDefinition reports whether two rules are defined identically,
+// including the contents of the schema documents they were compiled from.
+// Compiled schemas are not compared since every load compiles new ones.
+func (r *Rule) SameDefinition(other *Rule) bool {
+	a, errA := json.Marshal(r)
+	b, errB := json.Marshal(other)
+	if errA != nil || errB != nil || !bytes.Equal(a, b) {
+		return false
+	}
+
+	refs, otherRefs := r.schemaRefs(), other.schemaRefs()
+	if len(refs) != len(otherRefs) {
+		return false
+	}
+	for i, ref := range refs {
+		if (ref == nil) != (otherRefs[i] == nil) {
+			return false
+		}
+		if ref != nil && !bytes.Equal(ref.document, otherRefs[i].document) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compile compiles the JSON Schemas referenced by the rule, its targets and
+// its routes, loading schema files relative to rulesDir
+func (r *Rule) Compile(rulesDir string) error {
+	var errs ValidationErrors
+	for i := range r.Targets {
+		target := &r.Targets[i]
+		if target.Schema == nil {
+			continue
+		}
+		if err := target.Schema.compile(rulesDir, fmt.Sprintf("%s/targets/%d", r.ID, i)); err != nil {
+			errs.add(fmt.Sprintf("targets[%d].schema", i), err)
+		}
+	}
+
+	for i := range r.Routes {
+		route := &r.Routes[i]
+		if route.Schema == nil {
+			continue
+		}
+		if err := route.Schema.compile(rulesDir, fmt.Sprintf("%s/routes/%d", r.ID, i)); err != nil {
+			errs.add(fmt.Sprintf("routes[%d].schema", i), err)
+		}
+	}
+
+	if r.Schema == nil {
+		return errs.err()
+	}
+	if r.Schema.Input != nil {
+		if err := r.Schema.Input.compile(rulesDir, r.ID+"/input"); err != nil {
+			errs.add("schema.input", err)
+		}
+	}
+	if r.Schema.Output != nil {
+		if err := r.Schema.Output.compile(rulesDir, r.ID+"/output"); err != nil {
+			errs.add("schema.output", err)
+		}
+	}
+	return errs.err()
+}
@@ -0,0 +1,151 @@
+//file: internal/config/sink.go
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+// Sink types. The default MQTT broker always exists as a sink under its own
+// type name, and named brokers exist under their names.
+const (
+	SinkMQTT    = "mqtt"
+	SinkNATS    = "nats"
+	SinkWebhook = "webhook"
+	SinkFile    = "file"
+	SinkStdout  = "stdout"
+	SinkNull    = "null"
+)
+
+// DefaultSinkTimeout is the NATS connect and publish timeout in seconds
+const DefaultSinkTimeout = 5
+
+// sinkNameRegex restricts sink names to those safe as metric labels
+var sinkNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// SinkConfig configures a named output that targets can publish to instead
+// of the MQTT broker
+type SinkConfig struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// NATS server URL (nats://host:port) and credentials
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+	// Timeout bounds NATS connects and publishes, in seconds
+	Timeout int `json:"timeout"`
+
+	// Path is the file NDJSON records are appended to
+	Path string `json:"path"`
+
+	// Webhook is the HTTP endpoint messages are delivered to
+	Webhook *Webhook `json:"webhook"`
+}
+
+// validateSinks checks the sink definitions
+func validateSinks(sinks []SinkConfig) error {
+	names := make(map[string]bool, len(sinks))
+	for i, sink := range sinks {
+		if !sinkNameRegex.MatchString(sink.Name) {
+			return fmt.Errorf("sinks[%d]: sink name may only contain letters, digits, '.', '_' and '-'", i)
+		}
+		if sink.Name == SinkMQTT {
+			return fmt.Errorf("sink %s: the name %q is reserved for the MQTT broker", sink.Name, SinkMQTT)
+		}
+		if names[sink.Name] {
+			return fmt.Errorf("sink %s: duplicate sink name", sink.Name)
+		}
+		names[sink.Name] = true
+
+		if err := sink.validate(); err != nil {
+			return fmt.Errorf("sink %s: %w", sink.Name, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the settings required by the sink's type
+func (s *SinkConfig) validate() error {
+	switch s.Type {
+	case SinkNATS:
+		u, err := url.Parse(s.URL)
+		if err != nil || u.Scheme != "nats" || u.Host == "" {
+			return fmt.Errorf("url must be a nats://host:port URL")
+		}
+		if s.Timeout < 0 {
+			return fmt.Errorf("timeout cannot be negative")
+		}
+	case SinkWebhook:
+		if s.Webhook == nil {
+			return fmt.Errorf("webhook is required for %s sinks", SinkWebhook)
+		}
+		var errs ValidationErrors
+		s.Webhook.validate("webhook", &errs)
+		if err := errs.err(); err != nil {
+			return err
+		}
+	case SinkFile:
+		if s.Path == "" {
+			return fmt.Errorf("path is required for %s sinks", SinkFile)
+		}
+	case SinkStdout, SinkNull:
+	default:
+		return fmt.Errorf("invalid sink type: %q, must be one of %s, %s, %s, %s or %s",
+			s.Type, SinkNATS, SinkWebhook, SinkFile, SinkStdout, SinkNull)
+	}
+	return nil
+}
+
+// ConnectTimeout returns the NATS connect and publish timeout in seconds
+func (s *SinkConfig) ConnectTimeout() int {
+	if s.Timeout == 0 {
+		return DefaultSinkTimeout
+	}
+	return s.Timeout
+}
+
+// validateSink checks the syntax of a target's sink name; whether the sink
+// exists is checked against the configured sinks when rules are applied
+func validateSink(field, sink string, errs *ValidationErrors) {
+	if sink != "" && !sinkNameRegex.MatchString(sink) {
+		errs.add(field, fmt.Errorf("invalid sink name: %s", sink))
+	}
+}
+
+// publishesTo reports whether the target publishes to the named sink, with
+// "" standing for the MQTT broker
+func (t TargetMQTT) publishesTo(sink string) bool {
+	if t.Sink == "" {
+		return sink == SinkMQTT
+	}
+	return t.Sink == sink
+}
+
+// SinkNames returns the sink of every target a rule can publish to, with
+// "" standing for the MQTT broker
+func (r *Rule) SinkNames() []string {
+	switch {
+	case r.Webhook != nil:
+		return nil
+	case len(r.Routes) > 0:
+		var sinks []string
+		for _, route := range r.Routes {
+			if !route.Drops() {
+				sinks = append(sinks, route.Sink)
+			}
+		}
+		return sinks
+	case len(r.Targets) > 0:
+		sinks := make([]string, len(r.Targets))
+		for i, target := range r.Targets {
+			sinks[i] = target.Sink
+		}
+		return sinks
+	default:
+		return []string{r.Target.Sink}
+	}
+}
@@ -0,0 +1,37 @@
+//file: internal/config/sink_test.go
+
+package config
+
+import "testing"
+
+func TestSinkConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		sink    SinkConfig
+		wantErr bool
+	}{
+		{name: "nats", sink: SinkConfig{Type: SinkNATS, URL: "nats://localhost:4222"}},
+		{name: "nats without port", sink: SinkConfig{Type: SinkNATS, URL: "nats://localhost"}},
+		{name: "nats empty url", sink: SinkConfig{Type: SinkNATS}, wantErr: true},
+		{name: "nats unparsable url", sink: SinkConfig{Type: SinkNATS, URL: "nats://%zz"}, wantErr: true},
+		{name: "nats bad port", sink: SinkConfig{Type: SinkNATS, URL: "nats://localhost:port"}, wantErr: true},
+		{name: "nats wrong scheme", sink: SinkConfig{Type: SinkNATS, URL: "tcp://localhost:4222"}, wantErr: true},
+		{name: "nats without host", sink: SinkConfig{Type: SinkNATS, URL: "nats:///path"}, wantErr: true},
+		{name: "nats negative timeout", sink: SinkConfig{Type: SinkNATS, URL: "nats://localhost", Timeout: -1}, wantErr: true},
+		{name: "file", sink: SinkConfig{Type: SinkFile, Path: "/tmp/out.ndjson"}},
+		{name: "file without path", sink: SinkConfig{Type: SinkFile}, wantErr: true},
+		{name: "webhook without endpoint", sink: SinkConfig{Type: SinkWebhook}, wantErr: true},
+		{name: "stdout", sink: SinkConfig{Type: SinkStdout}},
+		{name: "null", sink: SinkConfig{Type: SinkNull}},
+		{name: "unknown type", sink: SinkConfig{Type: "kafka"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sink.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+//file: internal/config/source.go
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rule source types
+const (
+	SourceHTTP = "http"
+	SourceMQTT = "mqtt"
+)
+
+// RuleSource selects where a rule's input messages come from. HTTP rules are
+// served at the rule's API path; MQTT rules subscribe to a topic filter.
+type RuleSource struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic,omitempty"`
+	QoS   int    `json:"qos,omitempty"`
+	// Broker names the MQTT broker to subscribe on, the default broker if
+	// empty
+	Broker string `json:"broker,omitempty"`
+}
+
+// BrokerName returns the name of the broker an MQTT source subscribes on
+func (s *RuleSource) BrokerName() string {
+	if s == nil || s.Broker == "" {
+		return SinkMQTT
+	}
+	return s.Broker
+}
+
+// SourceType returns the rule's source type, defaulting to HTTP
+func (r *Rule) SourceType() string {
+	if r.Source == nil || r.Source.Type == "" {
+		return SourceHTTP
+	}
+	return r.Source.Type
+}
+
+// validateSource checks the source of an MQTT rule. A rule whose targets
+// match its own topic filter would consume its own messages, so static
+// target topics are checked against the filter.
+func (r *Rule) validateSource(errs *ValidationErrors) {
+	if r.API != (RuleAPI{}) {
+		errs.add("api", fmt.Errorf("api is not used by %s sources", SourceMQTT))
+	}
+	if err := ValidateTopicFilter(r.Source.Topic); err != nil {
+		errs.add("source.topic", err)
+		return
+	}
+	if err := ValidateQoS(r.Source.QoS); err != nil {
+		errs.add("source.qos", err)
+	}
+	validateSink("source.broker", r.Source.Broker, errs)
+
+	for _, topic := range r.staticTopics(r.Source.BrokerName()) {
+		if TopicMatches(r.Source.Topic, topic) {
+			errs.add("source.topic", fmt.Errorf("topic filter %s matches target topic %s, which would loop", r.Source.Topic, topic))
+		}
+	}
+}
+
+// staticTopics returns the target topics of a rule on the named broker that
+// are not templates; targets publishing to other sinks cannot loop
+func (r *Rule) staticTopics(broker string) []string {
+	var topics []string
+	add := func(target TargetMQTT) {
+		if target.Topic != "" && !IsTopicTemplate(target.Topic) && target.publishesTo(broker) {
+			topics = append(topics, target.Topic)
+		}
+	}
+
+	add(r.Target)
+	for _, target := range r.Targets {
+		add(target.TargetMQTT)
+	}
+	for _, route := range r.Routes {
+		add(route.TargetMQTT)
+	}
+	return topics
+}
+
+// ValidateTopicFilter validates an MQTT subscription topic filter. The
+// multi-level wildcard # may only be the last level and the single-level
+// wildcard + must occupy a whole level.
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("topic filter cannot be empty")
+	}
+	if len(filter) > MaxTopicLength {
+		return fmt.Errorf("topic filter is longer than the maximum of %d bytes", MaxTopicLength)
+	}
+	if strings.ContainsRune(filter, 0) {
+		return fmt.Errorf("topic filter contains a null character")
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("invalid topic filter %s: # must be the last level on its own", filter)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("invalid topic filter %s: + must occupy a whole level", filter)
+		}
+	}
+	return nil
+}
+
+// TopicMatches reports whether a topic matches a subscription topic filter
+func TopicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
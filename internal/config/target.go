@@ -0,0 +1,110 @@
+//file: internal/config/target.go
+
+package config
+
+import (
+	"fmt"
+)
+
+// Partial failure policies for rules with several targets
+const (
+	PolicyAllOrNothing = "all_or_nothing"
+	PolicyBestEffort   = "best_effort"
+)
+
+// Target is one of several publish destinations of a rule. Targets without
+// their own transform or output schema use the rule's.
+type Target struct {
+	Name      string     `json:"name"`
+	Transform *Transform `json:"transform,omitempty"`
+	Schema    *SchemaRef `json:"schema,omitempty"`
+	TargetMQTT
+}
+
+// PublishTargets returns the targets a rule publishes to, with the rule's
+// transform and output schema filled in where a target has none. Rules
+// without a targets list publish to their single target.
+func (r *Rule) PublishTargets() []Target {
+	if len(r.Targets) == 0 {
+		return []Target{r.ResolveTarget(Target{TargetMQTT: r.Target})}
+	}
+
+	targets := make([]Target, len(r.Targets))
+	for i, target := range r.Targets {
+		targets[i] = r.ResolveTarget(target)
+	}
+	return targets
+}
+
+// ResolveTarget fills in the rule's transform and output schema where the
+// target has none
+func (r *Rule) ResolveTarget(target Target) Target {
+	if target.Transform == nil {
+		transform := r.Transform
+		target.Transform = &transform
+	}
+	if target.Schema == nil && r.Schema != nil {
+		target.Schema = r.Schema.Output
+	}
+	return target
+}
+
+// BestEffort reports whether targets are published independently of each
+// other's failures
+func (r *Rule) BestEffort() bool {
+	return r.Policy == PolicyBestEffort
+}
+
+// validateTargets checks the targets list and the partial failure policy
+func (r *Rule) validateTargets(errs *ValidationErrors) {
+	switch r.Policy {
+	case "", PolicyAllOrNothing, PolicyBestEffort:
+	default:
+		errs.add("policy", fmt.Errorf("invalid policy: %s, must be %q or %q", r.Policy, PolicyAllOrNothing, PolicyBestEffort))
+	}
+
+	if r.Target.Topic != "" {
+		errs.add("target", fmt.Errorf("target cannot be combined with targets"))
+	}
+
+	// The rule transform is the default for targets without their own
+	useRuleTransform := !r.Transform.isZero()
+	names := make(map[string]int, len(r.Targets))
+	for i, target := range r.Targets {
+		field := fmt.Sprintf("targets[%d]", i)
+
+		if target.Name == "" {
+			errs.add(field+".name", fmt.Errorf("target name is required"))
+		} else if prev, exists := names[target.Name]; exists {
+			errs.add(field+".name", fmt.Errorf("duplicate target name %s (also used by targets[%d])", target.Name, prev))
+		} else {
+			names[target.Name] = i
+		}
+
+		if target.Transform == nil {
+			useRuleTransform = true
+		}
+		target.validate(field, errs)
+	}
+
+	if useRuleTransform {
+		r.Transform.validate("transform", errs)
+	}
+}
+
+// validate checks a target's transform, topic, QoS, properties, sink and
+// schema reference
+func (t *Target) validate(field string, errs *ValidationErrors) {
+	if t.Transform != nil {
+		t.Transform.validate(field+".transform", errs)
+	}
+	if err := ValidateTopicTemplate(t.Topic); err != nil {
+		errs.add(field+".topic", err)
+	}
+	if err := ValidateQoS(t.QoS); err != nil {
+		errs.add(field+".qos", err)
+	}
+	t.Properties.validate(field+".properties", errs)
+	validateSink(field+".sink", t.Sink, errs)
+	t.Schema.validate(field+".schema", errs)
+}
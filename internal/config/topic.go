@@ -0,0 +1,75 @@
+//file: internal/config/topic.go
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// MaxTopicLength is the longest topic MQTT can carry, in bytes
+const MaxTopicLength = 65535
+
+// topicPlaceholder stands in for template actions when the static parts of
+// a topic template are validated
+const topicPlaceholder = "x"
+
+// IsTopicTemplate reports whether a target topic contains template actions
+func IsTopicTemplate(topic string) bool {
+	return strings.Contains(topic, "{{")
+}
+
+// ValidateTopicTemplate validates a target topic that may contain template
+// actions. The template must parse, and the topic with every action replaced
+// by a placeholder must pass ValidateTopic and have no empty levels, since
+// rendered topics may not have any.
+func ValidateTopicTemplate(topic string) error {
+	if !IsTopicTemplate(topic) {
+		return ValidateTopic(topic)
+	}
+
+	tmpl, err := template.New("topic").Funcs(templateFuncStubs()).Parse(topic)
+	if err != nil {
+		return fmt.Errorf("invalid topic template: %w", err)
+	}
+
+	var skeleton strings.Builder
+	for _, node := range tmpl.Tree.Root.Nodes {
+		if text, ok := node.(*parse.TextNode); ok {
+			skeleton.Write(text.Text)
+			continue
+		}
+		skeleton.WriteString(topicPlaceholder)
+	}
+	if err := ValidateTopic(skeleton.String()); err != nil {
+		return err
+	}
+	for _, level := range strings.Split(skeleton.String(), "/") {
+		if level == "" {
+			return fmt.Errorf("topic template %q has an empty level", topic)
+		}
+	}
+	return nil
+}
+
+// ValidateRenderedTopic checks a topic produced by a topic template before
+// it is published to
+func ValidateRenderedTopic(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("topic cannot be empty")
+	}
+	if len(topic) > MaxTopicLength {
+		return fmt.Errorf("topic is %d bytes, longer than the maximum of %d", len(topic), MaxTopicLength)
+	}
+	if strings.ContainsAny(topic, "+#\x00") {
+		return fmt.Errorf("topic %q contains a wildcard or null character", topic)
+	}
+	for _, level := range strings.Split(topic, "/") {
+		if level == "" {
+			return fmt.Errorf("topic %q has an empty level", topic)
+		}
+	}
+	return nil
+}
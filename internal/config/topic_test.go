@@ -0,0 +1,66 @@
+//file: internal/config/topic_test.go
+
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTopicTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		wantErr bool
+	}{
+		{name: "static topic", topic: "devices/status"},
+		{name: "template level", topic: "devices/{{.id}}/status"},
+		{name: "template within level", topic: "devices/site-{{.site}}/status"},
+		{name: "param function", topic: `devices/{{param "id"}}`},
+		{name: "conditional level", topic: `devices/{{if .id}}{{.id}}{{else}}unknown{{end}}`},
+		{name: "empty topic", topic: "", wantErr: true},
+		{name: "static wildcard", topic: "devices/+/status", wantErr: true},
+		{name: "template with wildcard", topic: "devices/{{.id}}/#", wantErr: true},
+		{name: "empty level", topic: "devices//{{.id}}", wantErr: true},
+		{name: "trailing separator", topic: "devices/{{.id}}/", wantErr: true},
+		{name: "unparsable template", topic: "devices/{{.id", wantErr: true},
+		{name: "unknown function", topic: "devices/{{nope .id}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTopicTemplate(tt.topic)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTopicTemplate(%q) error = %v, wantErr %v", tt.topic, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRenderedTopic(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		wantErr bool
+	}{
+		{name: "valid", topic: "devices/d1/status"},
+		{name: "single level", topic: "status"},
+		{name: "empty", topic: "", wantErr: true},
+		{name: "empty level", topic: "devices//status", wantErr: true},
+		{name: "leading separator", topic: "/devices", wantErr: true},
+		{name: "single level wildcard", topic: "devices/+/status", wantErr: true},
+		{name: "multi level wildcard", topic: "devices/#", wantErr: true},
+		{name: "null character", topic: "devices/d\x001", wantErr: true},
+		{name: "maximum length", topic: strings.Repeat("a", MaxTopicLength)},
+		{name: "too long", topic: strings.Repeat("a", MaxTopicLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRenderedTopic(tt.topic)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRenderedTopic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
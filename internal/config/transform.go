@@ -0,0 +1,292 @@
+//file: internal/config/transform.go
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"message-transformer/internal/jsonpath"
+)
+
+// Transform engine types
+const (
+	TransformTemplate = "template"
+	TransformMapping  = "mapping"
+	TransformJQ       = "jq"
+)
+
+// Handling of jq expressions that yield more than one result
+const (
+	MultipleReject = "reject"
+	MultipleFanout = "fanout"
+)
+
+// Escaping modes for template output
+const (
+	EscapeNone = "none"
+	EscapeJSON = "json"
+)
+
+// Field coercion types for mappings
+const (
+	CoerceNumber    = "number"
+	CoerceBool      = "bool"
+	CoerceString    = "string"
+	CoerceTimestamp = "timestamp"
+)
+
+// Transform holds the message transformation configuration
+type Transform struct {
+	// Type selects the transform engine: "template" (default), "mapping" or "jq"
+	Type     string `json:"type,omitempty"`
+	Template string `json:"template,omitempty"`
+	// Escape set to "json" escapes every value printed inside a JSON string
+	// literal in the template
+	Escape string `json:"escape,omitempty"`
+	// Mapping maps dotted output paths to input selectors
+	Mapping map[string]FieldMapping `json:"mapping,omitempty"`
+	// Expression is the jq filter for "jq" transforms
+	Expression string `json:"expression,omitempty"`
+	// Multiple selects how jq results beyond the first are handled:
+	// "reject" (default) fails the transform, "fanout" publishes each result
+	Multiple string `json:"multiple,omitempty"`
+}
+
+// FieldMapping selects, coerces and defaults a single output field. In rule
+// files it may be written as a bare selector string ("$.id") or as an object.
+type FieldMapping struct {
+	Path    string      `json:"path"`
+	Type    string      `json:"type,omitempty"`
+	Default interface{} `json:"default,omitempty"`
+}
+
+// UnmarshalJSON accepts either a selector string or a mapping object
+func (m *FieldMapping) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*m = FieldMapping{Path: path}
+		return nil
+	}
+
+	type fieldMapping FieldMapping
+	var fm fieldMapping
+	if err := json.Unmarshal(data, &fm); err != nil {
+		return err
+	}
+	*m = FieldMapping(fm)
+	return nil
+}
+
+// MarshalJSON writes plain selectors back in their short string form
+func (m FieldMapping) MarshalJSON() ([]byte, error) {
+	if m.Type == "" && m.Default == nil {
+		return json.Marshal(m.Path)
+	}
+	type fieldMapping FieldMapping
+	return json.Marshal(fieldMapping(m))
+}
+
+// EngineType returns the transform engine, defaulting to template
+func (t *Transform) EngineType() string {
+	if t.Type == "" {
+		return TransformTemplate
+	}
+	return t.Type
+}
+
+// isZero reports whether no transform is configured
+func (t *Transform) isZero() bool {
+	return t.Type == "" && t.Template == "" && len(t.Mapping) == 0 && t.Expression == ""
+}
+
+// Fanout reports whether every result of the transform is published
+func (t *Transform) Fanout() bool {
+	return t.EngineType() == TransformJQ && t.Multiple == MultipleFanout
+}
+
+// validate checks the transform configuration, recording errors under field
+func (t *Transform) validate(field string, errs *ValidationErrors) {
+	engineType := t.EngineType()
+	if engineType != TransformTemplate && t.Template != "" {
+		errs.add(field+".template", fmt.Errorf("template is only allowed for transform type %q", TransformTemplate))
+	}
+	if engineType != TransformMapping && len(t.Mapping) > 0 {
+		errs.add(field+".mapping", fmt.Errorf("mapping is only allowed for transform type %q", TransformMapping))
+	}
+	if engineType != TransformJQ && t.Expression != "" {
+		errs.add(field+".expression", fmt.Errorf("expression is only allowed for transform type %q", TransformJQ))
+	}
+	if engineType != TransformJQ && t.Multiple != "" {
+		errs.add(field+".multiple", fmt.Errorf("multiple is only allowed for transform type %q", TransformJQ))
+	}
+
+	switch engineType {
+	case TransformTemplate:
+		if t.Template == "" {
+			errs.add(field+".template", fmt.Errorf("transformation template is required"))
+		} else if err := validateTemplate(t.Template, t.Escape == EscapeJSON); err != nil {
+			errs.add(field+".template", err)
+		}
+		switch t.Escape {
+		case "", EscapeNone, EscapeJSON:
+		default:
+			errs.add(field+".escape", fmt.Errorf("invalid escape mode: %s, must be %q or %q", t.Escape, EscapeNone, EscapeJSON))
+		}
+
+	case TransformMapping:
+		if len(t.Mapping) == 0 {
+			errs.add(field+".mapping", fmt.Errorf("mapping requires at least one field"))
+		}
+		validateMapping(field+".mapping", t.Mapping, errs)
+
+	case TransformJQ:
+		if t.Expression == "" {
+			errs.add(field+".expression", fmt.Errorf("jq expression is required"))
+		} else if _, err := CompileExpression(t.Expression); err != nil {
+			errs.add(field+".expression", err)
+		}
+		switch t.Multiple {
+		case "", MultipleReject, MultipleFanout:
+		default:
+			errs.add(field+".multiple", fmt.Errorf("invalid multiple mode: %s, must be %q or %q", t.Multiple, MultipleReject, MultipleFanout))
+		}
+
+	default:
+		errs.add(field+".type", fmt.Errorf("invalid transform type: %s", t.Type))
+	}
+}
+
+// validateMapping checks selectors, coercion types and output paths
+func validateMapping(field string, mapping map[string]FieldMapping, errs *ValidationErrors) {
+	outputs := make([]string, 0, len(mapping))
+	for output := range mapping {
+		outputs = append(outputs, output)
+	}
+	sort.Strings(outputs)
+
+	for _, output := range outputs {
+		fm := mapping[output]
+		parts := strings.Split(output, ".")
+		for i, part := range parts {
+			if part == "" {
+				errs.add(field, fmt.Errorf("output path %q has an empty segment", output))
+				break
+			}
+			// A field cannot be both a value and the parent of other fields
+			if parent := strings.Join(parts[:i], "."); i > 0 {
+				if _, exists := mapping[parent]; exists {
+					errs.add(field, fmt.Errorf("output path %q conflicts with %q", output, parent))
+					break
+				}
+			}
+		}
+		if _, err := jsonpath.Compile(fm.Path); err != nil {
+			errs.add(field+"."+output+".path", err)
+		}
+		switch fm.Type {
+		case "", CoerceNumber, CoerceBool, CoerceString, CoerceTimestamp:
+		default:
+			errs.add(field+"."+output+".type", fmt.Errorf("invalid type: %s, must be one of %s, %s, %s, %s",
+				fm.Type, CoerceNumber, CoerceBool, CoerceString, CoerceTimestamp))
+		}
+	}
+}
+
+// validateTemplate checks template syntax using all supported functions and,
+// when escaping, that the template can be rewritten to escape its strings
+func validateTemplate(templateStr string, escape bool) error {
+	// Create template with all supported functions for validation
+	tmpl := template.New("validator").Funcs(templateFuncStubs())
+
+	if _, err := tmpl.Parse(templateStr); err != nil {
+		return fmt.Errorf("invalid template syntax: %w", err)
+	}
+
+	if escape {
+		if err := EscapeJSONStrings(tmpl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// templateFuncStubs returns stand-ins for the transformer's template
+// functions so templates can be parsed during validation
+func templateFuncStubs() template.FuncMap {
+	return template.FuncMap{
+		"toJSON": func(v interface{}) string {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return ""
+			}
+			return string(b)
+		},
+		"fromJSON": func(s string) interface{} {
+			var v interface{}
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				return nil
+			}
+			return v
+		},
+		"now": func() string {
+			return time.Now().UTC().Format(time.RFC3339)
+		},
+		"jsonString": func(v interface{}) string {
+			return `""`
+		},
+		EscapeFuncName: func(v interface{}) string {
+			return ""
+		},
+		"uuid7": func() string {
+			return "00000000-0000-7000-0000-000000000000"
+		},
+		ParamFuncName: func(name string) string {
+			return ""
+		},
+		"num": func(v interface{}) string {
+			switch n := v.(type) {
+			case float64:
+				return strconv.FormatFloat(n, 'f', -1, 64)
+			case float32:
+				return strconv.FormatFloat(float64(n), 'f', -1, 32)
+			case int:
+				return strconv.Itoa(n)
+			case int64:
+				return strconv.FormatInt(n, 10)
+			case int32:
+				return strconv.FormatInt(int64(n), 10)
+			case string:
+				if _, err := strconv.ParseFloat(n, 64); err == nil {
+					return n
+				}
+				return "0"
+			default:
+				return "0"
+			}
+		},
+		"bool": func(v interface{}) string {
+			switch b := v.(type) {
+			case bool:
+				return strconv.FormatBool(b)
+			case string:
+				if b == "true" || b == "false" {
+					return b
+				}
+				return "false"
+			case int, int64, float64:
+				return "true"
+			case nil:
+				return "false"
+			default:
+				return "false"
+			}
+		},
+	}
+}
@@ -0,0 +1,194 @@
+//file: internal/config/watcher.go
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+
+	"message-transformer/internal/metrics"
+)
+
+// reloadDebounce groups bursts of file events (editors often write a file
+// several times per save) into a single reload
+const reloadDebounce = 500 * time.Millisecond
+
+// ReloadFunc applies a freshly loaded and validated rule set
+type ReloadFunc func(rules []Rule) error
+
+// Watcher watches the rules directory, and the schema files its rules
+// reference, and reloads rules on change
+type Watcher struct {
+	dir      string
+	logger   *zap.Logger
+	metrics  metrics.Recorder
+	onReload ReloadFunc
+	watcher  *fsnotify.Watcher
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu sync.Mutex
+	// schemaFiles holds the schema files referenced by the current rules
+	schemaFiles map[string]bool
+	// schemaDirs holds the directories watched for schema files, besides
+	// the rules directory
+	schemaDirs map[string]bool
+}
+
+// NewWatcher creates a watcher for the given rules directory
+func NewWatcher(rulesDir string, logger *zap.Logger, metricsRecorder metrics.Recorder, onReload ReloadFunc) (*Watcher, error) {
+	if metricsRecorder == nil {
+		metricsRecorder = metrics.NewNoOpRecorder()
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	if err := fsw.Add(rulesDir); err != nil {
+		fsw.Close()
+		return nil, fmt.Errorf("failed to watch rules directory: %w", err)
+	}
+
+	return &Watcher{
+		dir:      rulesDir,
+		logger:   logger,
+		metrics:  metricsRecorder,
+		onReload: onReload,
+		watcher:  fsw,
+		done:     make(chan struct{}),
+
+		schemaFiles: make(map[string]bool),
+		schemaDirs:  make(map[string]bool),
+	}, nil
+}
+
+// WatchSchemas watches the schema files referenced by a rule set, replacing
+// those of the previous set. Directories are watched rather than files so
+// that editors replacing a file on save are noticed.
+func (w *Watcher) WatchSchemas(rules []Rule) {
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, rule := range rules {
+		for _, file := range rule.SchemaFiles(w.dir) {
+			file = filepath.Clean(file)
+			files[file] = true
+			if dir := filepath.Dir(file); dir != filepath.Clean(w.dir) {
+				dirs[dir] = true
+			}
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for dir := range dirs {
+		if w.schemaDirs[dir] {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			w.logger.Error("Failed to watch schema directory",
+				zap.String("directory", dir),
+				zap.Error(err))
+			delete(dirs, dir)
+		}
+	}
+	for dir := range w.schemaDirs {
+		if !dirs[dir] {
+			w.watcher.Remove(dir)
+		}
+	}
+	w.schemaFiles = files
+	w.schemaDirs = dirs
+}
+
+// relevant reports whether a file event may change the rule set: rule and
+// schema files in the rules directory, and referenced schema files elsewhere
+func (w *Watcher) relevant(event fsnotify.Event) bool {
+	if event.Has(fsnotify.Chmod) {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	if filepath.Dir(name) == filepath.Clean(w.dir) && filepath.Ext(name) == ".json" {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.schemaFiles[name]
+}
+
+// Start begins processing file events in the background
+func (w *Watcher) Start() {
+	w.wg.Add(1)
+	go w.run()
+	w.logger.Info("Watching rules directory for changes", zap.String("directory", w.dir))
+}
+
+// Close stops the watcher and waits for any in-flight reload to finish
+func (w *Watcher) Close() error {
+	close(w.done)
+	err := w.watcher.Close()
+	w.wg.Wait()
+	return err
+}
+
+// run is the event loop; it debounces rule file events and triggers reloads
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	timer := time.NewTimer(reloadDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			timer.Stop()
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.relevant(event) {
+				continue
+			}
+			w.logger.Debug("Rule file changed",
+				zap.String("file", event.Name),
+				zap.String("op", event.Op.String()))
+			timer.Reset(reloadDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Error("Rules watcher error", zap.Error(err))
+		case <-timer.C:
+			w.Reload()
+		}
+	}
+}
+
+// Reload loads the rules directory and applies it, keeping the current rule
+// set live if loading, validation or applying fails
+func (w *Watcher) Reload() {
+	rules, err := LoadRules(w.dir, w.logger)
+	if err != nil {
+		w.metrics.IncRuleReloads(false)
+		w.logger.Error("Rule reload failed, keeping current rules", zap.Error(err))
+		return
+	}
+
+	if err := w.onReload(rules); err != nil {
+		w.metrics.IncRuleReloads(false)
+		w.logger.Error("Failed to apply reloaded rules, keeping current rules", zap.Error(err))
+		return
+	}
+
+	w.WatchSchemas(rules)
+	w.metrics.IncRuleReloads(true)
+	w.logger.Info("Rules reloaded successfully", zap.Int("count", len(rules)))
+}
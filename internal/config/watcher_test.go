@@ -0,0 +1,200 @@
+//file: internal/config/watcher_test.go
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// testRule returns a valid rule definition serving the path
+func testRule(id, path string) string {
+	return fmt.Sprintf(`{
+		"id": %q,
+		"api": {"method": "POST", "path": %q},
+		"transform": {"template": "{{toJSON .}}"},
+		"target": {"topic": "out"}
+	}`, id, path)
+}
+
+// writeFile writes a file in the directory
+func writeFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reloadRecorder records the rule sets a watcher applies
+type reloadRecorder struct {
+	mu    sync.Mutex
+	loads [][]Rule
+	err   error
+}
+
+// reload is the watcher's ReloadFunc
+func (r *reloadRecorder) reload(rules []Rule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loads = append(r.loads, rules)
+	return r.err
+}
+
+// count returns the number of reloads
+func (r *reloadRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.loads)
+}
+
+// newTestWatcher creates a watcher for the directory, closed with the test
+func newTestWatcher(t *testing.T, dir string, onReload ReloadFunc) *Watcher {
+	t.Helper()
+
+	w, err := NewWatcher(dir, zap.NewNop(), nil, onReload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func TestWatcherRelevant(t *testing.T) {
+	dir := t.TempDir()
+	schemas := t.TempDir()
+	writeFile(t, schemas, "input.json", `{"type": "object"}`)
+	writeFile(t, dir, "rule.json", `{
+		"id": "rule",
+		"api": {"method": "POST", "path": "/rule"},
+		"schema": {"input": {"file": "`+filepath.Join(schemas, "input.json")+`"}},
+		"transform": {"template": "{{toJSON .}}"},
+		"target": {"topic": "out"}
+	}`)
+	rules, err := LoadRules(dir, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := newTestWatcher(t, dir, (&reloadRecorder{}).reload)
+	w.WatchSchemas(rules)
+
+	tests := []struct {
+		name  string
+		event fsnotify.Event
+		want  bool
+	}{
+		{name: "rule file written", event: fsnotify.Event{Name: filepath.Join(dir, "rule.json"), Op: fsnotify.Write}, want: true},
+		{name: "rule file created", event: fsnotify.Event{Name: filepath.Join(dir, "new.json"), Op: fsnotify.Create}, want: true},
+		{name: "rule file removed", event: fsnotify.Event{Name: filepath.Join(dir, "rule.json"), Op: fsnotify.Remove}, want: true},
+		{name: "schema file in rules directory", event: fsnotify.Event{Name: filepath.Join(dir, "input.schema.json"), Op: fsnotify.Write}, want: true},
+		{name: "referenced schema file", event: fsnotify.Event{Name: filepath.Join(schemas, "input.json"), Op: fsnotify.Write}, want: true},
+		{name: "unreferenced file beside schema", event: fsnotify.Event{Name: filepath.Join(schemas, "other.json"), Op: fsnotify.Write}},
+		{name: "chmod", event: fsnotify.Event{Name: filepath.Join(dir, "rule.json"), Op: fsnotify.Chmod}},
+		{name: "other extension", event: fsnotify.Event{Name: filepath.Join(dir, "rule.json.swp"), Op: fsnotify.Write}},
+		{name: "subdirectory", event: fsnotify.Event{Name: filepath.Join(dir, "sub", "rule.json"), Op: fsnotify.Write}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.relevant(tt.event); got != tt.want {
+				t.Errorf("relevant(%v) = %v, want %v", tt.event, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcherDebouncesReloads(t *testing.T) {
+	dir := t.TempDir()
+	recorder := &reloadRecorder{}
+	w := newTestWatcher(t, dir, recorder.reload)
+	w.Start()
+
+	// A burst of changes is applied by a single reload
+	for i := 0; i < 3; i++ {
+		writeFile(t, dir, fmt.Sprintf("rule%d.json", i), testRule(fmt.Sprintf("rule%d", i), fmt.Sprintf("/rule%d", i)))
+		time.Sleep(reloadDebounce / 5)
+	}
+	writeFile(t, dir, "notes.txt", "not a rule")
+
+	deadline := time.Now().Add(5 * reloadDebounce)
+	for recorder.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(2 * reloadDebounce)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.loads) != 1 {
+		t.Fatalf("reloads = %d, want 1", len(recorder.loads))
+	}
+	if got := len(recorder.loads[0]); got != 3 {
+		t.Errorf("reloaded rules = %d, want 3", got)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		reloadErr error
+		wantRules int
+		// wantApplied is whether the rule set reaches the reload function
+		wantApplied bool
+	}{
+		{
+			name:        "valid rules",
+			files:       map[string]string{"a.json": testRule("a", "/a"), "b.json": testRule("b", "/b")},
+			wantRules:   2,
+			wantApplied: true,
+		},
+		{
+			name:  "invalid rule",
+			files: map[string]string{"a.json": testRule("a", "/a"), "b.json": `{"id": "b"}`},
+		},
+		{
+			name:  "unparsable rule",
+			files: map[string]string{"a.json": `{"id": `},
+		},
+		{
+			name:  "conflicting rules",
+			files: map[string]string{"a.json": testRule("a", "/a"), "b.json": testRule("a", "/b")},
+		},
+		{
+			name:        "rejected by the server",
+			files:       map[string]string{"a.json": testRule("a", "/a")},
+			reloadErr:   errors.New("unknown sink"),
+			wantRules:   1,
+			wantApplied: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				writeFile(t, dir, name, data)
+			}
+			recorder := &reloadRecorder{err: tt.reloadErr}
+			w := newTestWatcher(t, dir, recorder.reload)
+
+			w.Reload()
+			if !tt.wantApplied {
+				if recorder.count() != 0 {
+					t.Errorf("invalid rules were applied")
+				}
+				return
+			}
+			if recorder.count() != 1 || len(recorder.loads[0]) != tt.wantRules {
+				t.Errorf("applied %v, want one set of %d rules", recorder.loads, tt.wantRules)
+			}
+		})
+	}
+}
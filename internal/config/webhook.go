@@ -0,0 +1,141 @@
+//file: internal/config/webhook.go
+
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Webhook defaults
+const (
+	DefaultWebhookMethod  = http.MethodPost
+	DefaultWebhookTimeout = 10 // seconds
+	defaultRetryInitial   = 1  // seconds
+	defaultRetryMaxDelay  = 30 // seconds
+)
+
+// Webhook delivers the transformed messages of an MQTT source rule to an HTTP
+// endpoint instead of publishing them to MQTT
+type Webhook struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout is the time allowed for each attempt, in seconds
+	Timeout int          `json:"timeout,omitempty"`
+	Retry   WebhookRetry `json:"retry"`
+	// SuccessCodes are the response statuses that count as delivered,
+	// defaulting to any 2xx status
+	SuccessCodes []int `json:"successCodes,omitempty"`
+}
+
+// WebhookRetry configures retries of failed deliveries with exponential
+// backoff, with delays in seconds
+type WebhookRetry struct {
+	MaxRetries int `json:"maxRetries"`
+	Initial    int `json:"initial,omitempty"`
+	MaxDelay   int `json:"maxDelay,omitempty"`
+}
+
+// RequestMethod returns the HTTP method used for deliveries
+func (w *Webhook) RequestMethod() string {
+	if w.Method == "" {
+		return DefaultWebhookMethod
+	}
+	return strings.ToUpper(w.Method)
+}
+
+// RequestTimeout returns the timeout of each delivery attempt in seconds
+func (w *Webhook) RequestTimeout() int {
+	if w.Timeout == 0 {
+		return DefaultWebhookTimeout
+	}
+	return w.Timeout
+}
+
+// IsSuccess reports whether a response status counts as delivered
+func (w *Webhook) IsSuccess(status int) bool {
+	if len(w.SuccessCodes) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, code := range w.SuccessCodes {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay in seconds before the given retry, starting at 1
+func (r *WebhookRetry) Backoff(retry int) int {
+	initial, maxDelay := r.Initial, r.MaxDelay
+	if initial == 0 {
+		initial = defaultRetryInitial
+	}
+	if maxDelay == 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+
+	delay := initial
+	for i := 1; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// validateWebhook checks the webhook of a rule. Webhooks replace the rule's
+// MQTT targets, so they only apply to rules fed from MQTT.
+func (r *Rule) validateWebhook(errs *ValidationErrors) {
+	if r.SourceType() != SourceMQTT {
+		errs.add("webhook", fmt.Errorf("webhook requires an %s source", SourceMQTT))
+	}
+	if r.Target != (TargetMQTT{}) {
+		errs.add("target", fmt.Errorf("target cannot be combined with webhook"))
+	}
+	if len(r.Targets) > 0 {
+		errs.add("targets", fmt.Errorf("targets cannot be combined with webhook"))
+	}
+	if len(r.Routes) > 0 {
+		errs.add("routes", fmt.Errorf("routes cannot be combined with webhook"))
+	}
+	if r.Policy != "" {
+		errs.add("policy", fmt.Errorf("policy is only allowed with targets"))
+	}
+
+	r.Transform.validate("transform", errs)
+	r.Webhook.validate("webhook", errs)
+}
+
+// validate checks the endpoint, method, timeout, retries and status codes
+func (w *Webhook) validate(field string, errs *ValidationErrors) {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add(field+".url", fmt.Errorf("webhook URL must be an absolute http or https URL"))
+	}
+	if w.Method != "" {
+		if err := ValidateHTTPMethod(strings.ToUpper(w.Method)); err != nil {
+			errs.add(field+".method", err)
+		}
+	}
+	if w.Timeout < 0 {
+		errs.add(field+".timeout", fmt.Errorf("timeout cannot be negative"))
+	}
+	if w.Retry.MaxRetries < 0 || w.Retry.Initial < 0 || w.Retry.MaxDelay < 0 {
+		errs.add(field+".retry", fmt.Errorf("retry settings cannot be negative"))
+	}
+	for name := range w.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") {
+			errs.add(field+".headers", fmt.Errorf("invalid header name %q", name))
+		}
+	}
+	for _, code := range w.SuccessCodes {
+		if code < 100 || code > 599 {
+			errs.add(field+".successCodes", fmt.Errorf("invalid status code: %d", code))
+		}
+	}
+}
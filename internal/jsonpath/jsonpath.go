@@ -0,0 +1,110 @@
+//file: internal/jsonpath/jsonpath.go
+
+package jsonpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled JSONPath-style selector such as $.device.readings[0].value.
+// Only child access by name or index is supported; wildcards, filters and
+// recursive descent are not.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// segment is a single step in a path: a field name or an array index
+type segment struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// Compile parses a selector. Selectors start with $ followed by any number
+// of .name, ['name'] or [index] steps.
+func Compile(expr string) (Path, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return Path{}, fmt.Errorf("path %q must start with $", expr)
+	}
+
+	p := Path{expr: expr}
+	rest := expr[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" {
+				return Path{}, fmt.Errorf("path %q has an empty field name", expr)
+			}
+			if name == "*" {
+				return Path{}, fmt.Errorf("path %q: wildcards are not supported", expr)
+			}
+			p.segments = append(p.segments, segment{name: name})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return Path{}, fmt.Errorf("path %q has an unclosed [", expr)
+			}
+			seg, err := parseBracket(rest[1:end])
+			if err != nil {
+				return Path{}, fmt.Errorf("path %q: %w", expr, err)
+			}
+			p.segments = append(p.segments, seg)
+			rest = rest[end+1:]
+		default:
+			return Path{}, fmt.Errorf("path %q: unexpected character %q", expr, rest[0])
+		}
+	}
+
+	return p, nil
+}
+
+// parseBracket parses the contents of a [...] step
+func parseBracket(s string) (segment, error) {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return segment{name: s[1 : len(s)-1]}, nil
+	}
+	index, err := strconv.Atoi(s)
+	if err != nil || index < 0 {
+		return segment{}, fmt.Errorf("invalid index [%s]", s)
+	}
+	return segment{index: index, isIndex: true}, nil
+}
+
+// String returns the original selector
+func (p Path) String() string {
+	return p.expr
+}
+
+// Get looks up the selected value in decoded JSON data. The second return
+// value is false if any step of the path does not exist.
+func (p Path) Get(data interface{}) (interface{}, bool) {
+	current := data
+	for _, seg := range p.segments {
+		if seg.isIndex {
+			arr, ok := current.([]interface{})
+			if !ok || seg.index >= len(arr) {
+				return nil, false
+			}
+			current = arr[seg.index]
+			continue
+		}
+
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[seg.name]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
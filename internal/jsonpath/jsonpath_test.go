@@ -0,0 +1,97 @@
+//file: internal/jsonpath/jsonpath_test.go
+
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		want    []segment
+		wantErr bool
+	}{
+		{name: "root", expr: "$"},
+		{name: "field", expr: "$.device", want: []segment{{name: "device"}}},
+		{name: "nested fields", expr: "$.device.id", want: []segment{{name: "device"}, {name: "id"}}},
+		{name: "index", expr: "$.readings[1]", want: []segment{{name: "readings"}, {index: 1, isIndex: true}}},
+		{name: "index then field", expr: "$.readings[0].value", want: []segment{{name: "readings"}, {index: 0, isIndex: true}, {name: "value"}}},
+		{name: "quoted name", expr: "$['device id']", want: []segment{{name: "device id"}}},
+		{name: "double quoted name", expr: `$["a.b"]`, want: []segment{{name: "a.b"}}},
+		{name: "top level index", expr: "$[2]", want: []segment{{index: 2, isIndex: true}}},
+		{name: "missing root", expr: "device.id", wantErr: true},
+		{name: "empty field name", expr: "$..id", wantErr: true},
+		{name: "trailing dot", expr: "$.device.", wantErr: true},
+		{name: "wildcard", expr: "$.*", wantErr: true},
+		{name: "unclosed bracket", expr: "$.readings[0", wantErr: true},
+		{name: "negative index", expr: "$.readings[-1]", wantErr: true},
+		{name: "invalid index", expr: "$.readings[x]", wantErr: true},
+		{name: "unexpected character", expr: "$device", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compile(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(p.segments, tt.want) {
+				t.Errorf("Compile(%q) segments = %+v, want %+v", tt.expr, p.segments, tt.want)
+			}
+			if p.String() != tt.expr {
+				t.Errorf("String() = %q, want %q", p.String(), tt.expr)
+			}
+		})
+	}
+}
+
+func TestPathGet(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{
+		"device": {"id": "d1", "tags": null},
+		"readings": [{"value": 1}, {"value": 2}],
+		"device id": "spaced"
+	}`), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		expr      string
+		data      interface{}
+		want      interface{}
+		wantFound bool
+	}{
+		{name: "field", expr: "$.device.id", data: data, want: "d1", wantFound: true},
+		{name: "index", expr: "$.readings[1].value", data: data, want: 2.0, wantFound: true},
+		{name: "quoted name", expr: "$['device id']", data: data, want: "spaced", wantFound: true},
+		{name: "null value", expr: "$.device.tags", data: data, want: nil, wantFound: true},
+		{name: "root", expr: "$", data: "scalar", want: "scalar", wantFound: true},
+		{name: "top level array", expr: "$[0]", data: []interface{}{"a"}, want: "a", wantFound: true},
+		{name: "missing field", expr: "$.device.name", data: data},
+		{name: "index out of range", expr: "$.readings[2]", data: data},
+		{name: "index into object", expr: "$.device[0]", data: data},
+		{name: "field of array", expr: "$.readings.value", data: data},
+		{name: "field of scalar", expr: "$.device.id.x", data: data},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, found := p.Get(tt.data)
+			if found != tt.wantFound || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() = %v, %v, want %v, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
@@ -7,30 +7,87 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// Transform status labels beyond success and error
+const (
+	StatusSchemaError = "schema_error"
+	StatusDropped     = "dropped"
+	StatusFiltered    = "filtered"
+)
+
+// Reasons for dropping queued messages
+const (
+	QueueDroppedFull    = "full"
+	QueueDroppedExpired = "expired"
+)
+
+// Outcomes of MQTT request/response exchanges
+const (
+	RequestReplied = "replied"
+	RequestTimeout = "timeout"
+	RequestFailed  = "error"
+)
+
+// Outcomes of asynchronous publish jobs
+const (
+	JobPublished = "published"
+	JobQueued    = "queued"
+	JobPartial   = "partial"
+	JobFailed    = "failed"
+	JobRejected  = "rejected"
+)
+
 // Recorder provides an interface for recording essential metrics
 type Recorder interface {
 	// Counter methods
 	IncRequests(success bool)
 	IncTransforms(ruleID string, success bool)
+	IncTransformsStatus(ruleID, status string)
 	IncPublishes(success bool)
+	IncRuleReloads(success bool)
+	IncWebhookDeliveries(ruleID string, success bool)
+	IncQueueDropped(reason string)
+	IncMQTTRequests(ruleID, status string)
+	IncSinkPublishes(sink string, success bool)
+	IncPublishJobs(status string)
+
+	// Histogram methods
+	ObservePublishLatency(seconds float64)
 
 	// Gauge methods
-	SetMQTTConnected(connected bool)
+	SetMQTTConnected(broker string, connected bool)
+	SetMQTTActiveBroker(broker, url string, active bool)
 	SetActiveRules(count int)
 	SetUp(up bool)
+	SetQueueDepth(messages int, bytes int64)
+	SetSinkHealthy(sink string, healthy bool)
+	SetPublishQueueLength(length int)
 }
 
 // PrometheusRecorder implements Recorder using Prometheus metrics
 type PrometheusRecorder struct {
 	// Counters
-	requests   *prometheus.CounterVec
-	transforms *prometheus.CounterVec
-	publishes  *prometheus.CounterVec
+	requests     *prometheus.CounterVec
+	transforms   *prometheus.CounterVec
+	publishes    *prometheus.CounterVec
+	reloads      *prometheus.CounterVec
+	webhooks     *prometheus.CounterVec
+	queueDrops   *prometheus.CounterVec
+	mqttRequests *prometheus.CounterVec
+	sinkPublish  *prometheus.CounterVec
+	publishJobs  *prometheus.CounterVec
+
+	// Histograms
+	publishLatency prometheus.Histogram
 
 	// Gauges
 	mqttConnected *prometheus.GaugeVec
+	mqttActive    *prometheus.GaugeVec
 	activeRules   prometheus.Gauge
 	up            prometheus.Gauge
+	queueDepth    prometheus.Gauge
+	queueBytes    prometheus.Gauge
+	sinkHealthy   *prometheus.GaugeVec
+	publishQueue  prometheus.Gauge
 }
 
 // NewPrometheusRecorder creates a new PrometheusRecorder
@@ -58,6 +115,57 @@ func NewPrometheusRecorder() *PrometheusRecorder {
 			},
 			[]string{"status"},
 		),
+		reloads: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "message_transformer_rule_reloads_total",
+				Help: "Total number of rule reload attempts",
+			},
+			[]string{"status"},
+		),
+		webhooks: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "message_transformer_webhook_deliveries_total",
+				Help: "Total number of webhook deliveries by rule, after retries",
+			},
+			[]string{"rule_id", "status"},
+		),
+		queueDrops: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "message_transformer_queue_dropped_total",
+				Help: "Total number of messages dropped from the publish queue",
+			},
+			[]string{"reason"},
+		),
+		mqttRequests: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "message_transformer_mqtt_requests_total",
+				Help: "Total number of MQTT request/response exchanges by rule and outcome",
+			},
+			[]string{"rule_id", "status"},
+		),
+		sinkPublish: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "message_transformer_sink_publishes_total",
+				Help: "Total number of messages published to each output sink",
+			},
+			[]string{"sink", "status"},
+		),
+		publishJobs: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "message_transformer_publish_jobs_total",
+				Help: "Total number of asynchronous publish jobs by outcome",
+			},
+			[]string{"status"},
+		),
+
+		// Initialize histograms
+		publishLatency: promauto.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "message_transformer_publish_latency_seconds",
+				Help:    "Time from submitting an asynchronous publish job to its completion",
+				Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+			},
+		),
 
 		// Initialize gauges
 		mqttConnected: promauto.NewGaugeVec(
@@ -67,6 +175,13 @@ func NewPrometheusRecorder() *PrometheusRecorder {
 			},
 			[]string{"broker"},
 		),
+		mqttActive: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "message_transformer_mqtt_active_broker",
+				Help: "Broker URL each MQTT connection is using (1=active, 0=standby)",
+			},
+			[]string{"broker", "url"},
+		),
 		activeRules: promauto.NewGauge(
 			prometheus.GaugeOpts{
 				Name: "message_transformer_active_rules",
@@ -79,6 +194,31 @@ func NewPrometheusRecorder() *PrometheusRecorder {
 				Help: "Whether the message transformer is up (1) or down (0)",
 			},
 		),
+		queueDepth: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "message_transformer_queue_messages",
+				Help: "Number of messages waiting in the publish queue",
+			},
+		),
+		queueBytes: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "message_transformer_queue_bytes",
+				Help: "Size of the messages waiting in the publish queue",
+			},
+		),
+		sinkHealthy: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "message_transformer_sink_healthy",
+				Help: "Output sink health as of the last health check (1=healthy, 0=unhealthy)",
+			},
+			[]string{"sink"},
+		),
+		publishQueue: promauto.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "message_transformer_publish_queue_length",
+				Help: "Number of asynchronous publish jobs waiting for a worker",
+			},
+		),
 	}
 }
 
@@ -93,18 +233,62 @@ func (r *PrometheusRecorder) IncTransforms(ruleID string, success bool) {
 	r.transforms.WithLabelValues(ruleID, status).Inc()
 }
 
+func (r *PrometheusRecorder) IncTransformsStatus(ruleID, status string) {
+	r.transforms.WithLabelValues(ruleID, status).Inc()
+}
+
 func (r *PrometheusRecorder) IncPublishes(success bool) {
 	status := statusLabel(success)
 	r.publishes.WithLabelValues(status).Inc()
 }
 
+func (r *PrometheusRecorder) IncRuleReloads(success bool) {
+	status := statusLabel(success)
+	r.reloads.WithLabelValues(status).Inc()
+}
+
+func (r *PrometheusRecorder) IncWebhookDeliveries(ruleID string, success bool) {
+	status := statusLabel(success)
+	r.webhooks.WithLabelValues(ruleID, status).Inc()
+}
+
+func (r *PrometheusRecorder) IncQueueDropped(reason string) {
+	r.queueDrops.WithLabelValues(reason).Inc()
+}
+
+func (r *PrometheusRecorder) IncMQTTRequests(ruleID, status string) {
+	r.mqttRequests.WithLabelValues(ruleID, status).Inc()
+}
+
+func (r *PrometheusRecorder) IncSinkPublishes(sink string, success bool) {
+	status := statusLabel(success)
+	r.sinkPublish.WithLabelValues(sink, status).Inc()
+}
+
+func (r *PrometheusRecorder) IncPublishJobs(status string) {
+	r.publishJobs.WithLabelValues(status).Inc()
+}
+
+// Histogram method implementations
+func (r *PrometheusRecorder) ObservePublishLatency(seconds float64) {
+	r.publishLatency.Observe(seconds)
+}
+
 // Gauge method implementations
-func (r *PrometheusRecorder) SetMQTTConnected(connected bool) {
+func (r *PrometheusRecorder) SetMQTTConnected(broker string, connected bool) {
 	value := 0.0
 	if connected {
 		value = 1.0
 	}
-	r.mqttConnected.WithLabelValues("broker").Set(value)
+	r.mqttConnected.WithLabelValues(broker).Set(value)
+}
+
+func (r *PrometheusRecorder) SetMQTTActiveBroker(broker, url string, active bool) {
+	value := 0.0
+	if active {
+		value = 1.0
+	}
+	r.mqttActive.WithLabelValues(broker, url).Set(value)
 }
 
 func (r *PrometheusRecorder) SetActiveRules(count int) {
@@ -119,6 +303,23 @@ func (r *PrometheusRecorder) SetUp(up bool) {
 	r.up.Set(value)
 }
 
+func (r *PrometheusRecorder) SetQueueDepth(messages int, bytes int64) {
+	r.queueDepth.Set(float64(messages))
+	r.queueBytes.Set(float64(bytes))
+}
+
+func (r *PrometheusRecorder) SetSinkHealthy(sink string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1.0
+	}
+	r.sinkHealthy.WithLabelValues(sink).Set(value)
+}
+
+func (r *PrometheusRecorder) SetPublishQueueLength(length int) {
+	r.publishQueue.Set(float64(length))
+}
+
 // Helper function for status labels
 func statusLabel(success bool) string {
 	if success {
@@ -135,9 +336,21 @@ func NewNoOpRecorder() *NoOpRecorder {
 }
 
 // NoOp implementations
-func (r *NoOpRecorder) IncRequests(success bool)                 {}
-func (r *NoOpRecorder) IncTransforms(ruleID string, success bool) {}
-func (r *NoOpRecorder) IncPublishes(success bool)                {}
-func (r *NoOpRecorder) SetMQTTConnected(connected bool)          {}
-func (r *NoOpRecorder) SetActiveRules(count int)                 {}
-func (r *NoOpRecorder) SetUp(up bool)                            {}
+func (r *NoOpRecorder) IncRequests(success bool)                            {}
+func (r *NoOpRecorder) IncTransforms(ruleID string, success bool)           {}
+func (r *NoOpRecorder) IncTransformsStatus(ruleID, status string)           {}
+func (r *NoOpRecorder) IncPublishes(success bool)                           {}
+func (r *NoOpRecorder) IncRuleReloads(success bool)                         {}
+func (r *NoOpRecorder) IncWebhookDeliveries(ruleID string, success bool)    {}
+func (r *NoOpRecorder) IncQueueDropped(reason string)                       {}
+func (r *NoOpRecorder) IncMQTTRequests(ruleID, status string)               {}
+func (r *NoOpRecorder) IncSinkPublishes(sink string, success bool)          {}
+func (r *NoOpRecorder) SetMQTTConnected(broker string, connected bool)      {}
+func (r *NoOpRecorder) SetMQTTActiveBroker(broker, url string, active bool) {}
+func (r *NoOpRecorder) SetActiveRules(count int)                            {}
+func (r *NoOpRecorder) SetUp(up bool)                                       {}
+func (r *NoOpRecorder) SetQueueDepth(messages int, bytes int64)             {}
+func (r *NoOpRecorder) SetSinkHealthy(sink string, healthy bool)            {}
+func (r *NoOpRecorder) IncPublishJobs(status string)                        {}
+func (r *NoOpRecorder) ObservePublishLatency(seconds float64)               {}
+func (r *NoOpRecorder) SetPublishQueueLength(length int)                    {}
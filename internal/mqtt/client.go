@@ -6,31 +6,116 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"net"
 	"os"
+	"sync"
 	"time"
 
-	paho "github.com/eclipse/paho.mqtt.golang"
 	"go.uber.org/zap"
 
 	"message-transformer/internal/metrics"
 )
 
+// Protocol versions
+const (
+	ProtocolV311 = 4
+	ProtocolV5   = 5
+)
+
+// operationTimeout bounds how long publishes and subscriptions wait for the
+// broker
+const operationTimeout = 10 * time.Second
+
 // Client wraps the MQTT client functionality
 type Client struct {
-	client  paho.Client
 	logger  *zap.Logger
 	metrics metrics.Recorder
-	broker  string
+	name    string
+	brokers []string
+	version int
+
+	// The connection is replaced when failing back to the primary broker
+	cfg    Config
+	tls    *tls.Config
+	connMu sync.RWMutex
+	conn   connection
+
+	// Subscriptions are restored after every reconnect since sessions are
+	// not persisted. Reply topics are kept apart from the subscriptions so
+	// a subscription on the same filter neither replaces nor removes them.
+	subMu         sync.Mutex
+	subscriptions map[string]subscription
+	replyTopics   map[string]bool
+
+	// Messages that could not be published wait in the queue, if enabled,
+	// and are forwarded in order once connected
+	queue Queue
+	wake  chan struct{}
+	done  chan struct{}
+
+	// Requests wait for replies correlated by MQTT v5 correlation data
+	requests requests
+}
+
+// connection is a broker connection for one protocol version. Connections
+// reconnect automatically once the initial connection succeeds.
+type connection interface {
+	Connect(timeout time.Duration) error
+	Publish(msg Message, timeout time.Duration) error
+	Subscribe(topic string, qos int, handler MessageHandler, timeout time.Duration) error
+	Unsubscribe(topic string, timeout time.Duration) error
+	IsConnected() bool
+	// Server returns the URL of the connected broker, empty if disconnected
+	Server() string
+	Disconnect()
+}
+
+// connectionHandlers are called on connection state changes
+type connectionHandlers struct {
+	onConnect        func()
+	onConnectionLost func(err error)
+	onReconnecting   func()
+}
+
+// Queue stores messages that could not be published, in order
+type Queue interface {
+	Push(msg Message) error
+	Peek() (Message, bool)
+	Pop()
+	Len() int
+}
+
+// subscription is a topic filter subscribed to by the client
+type subscription struct {
+	qos     int
+	handler MessageHandler
 }
 
 // Config holds the MQTT client configuration
 type Config struct {
-	Broker    string
-	ClientID  string
-	Username  string
-	Password  string
-	TLS       TLSConfig
-	Reconnect ReconnectConfig
+	// Name identifies the connection in logs and metrics
+	Name     string
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// Failover lists brokers tried in order when Broker is unreachable
+	Failover []string
+	// FailbackInterval is how often the connection checks whether Broker is
+	// reachable again while connected to a failover broker; zero disables
+	// failing back
+	FailbackInterval time.Duration
+	// ProtocolVersion selects MQTT 3.1.1 (4, the default) or MQTT v5 (5)
+	ProtocolVersion int
+	TLS             TLSConfig
+	Reconnect       ReconnectConfig
+	// Queue stores messages while the broker is unavailable; nil disables it
+	Queue Queue
+}
+
+// Brokers returns the broker URLs in the order they are tried
+func (c Config) Brokers() []string {
+	return append([]string{c.Broker}, c.Failover...)
 }
 
 // TLSConfig holds TLS configuration
@@ -54,87 +139,229 @@ func New(cfg Config, logger *zap.Logger, metricsRecorder metrics.Recorder) (*Cli
 		metricsRecorder = metrics.NewNoOpRecorder()
 	}
 
+	logger = logger.With(zap.String("broker", cfg.Name))
 	client := &Client{
-		logger:  logger,
-		metrics: metricsRecorder,
-		broker:  cfg.Broker,
-	}
-
-	opts := paho.NewClientOptions().
-		AddBroker(cfg.Broker).
-		SetClientID(cfg.ClientID).
-		SetUsername(cfg.Username).
-		SetPassword(cfg.Password).
-		SetOrderMatters(false).
-		SetCleanSession(true).
-		SetAutoReconnect(true).
-		SetConnectRetry(true).
-		SetConnectRetryInterval(time.Duration(cfg.Reconnect.Initial) * time.Second).
-		SetMaxReconnectInterval(time.Duration(cfg.Reconnect.MaxDelay) * time.Second)
+		logger:        logger,
+		metrics:       metricsRecorder,
+		name:          cfg.Name,
+		brokers:       cfg.Brokers(),
+		version:       cfg.ProtocolVersion,
+		cfg:           cfg,
+		subscriptions: make(map[string]subscription),
+		replyTopics:   make(map[string]bool),
+		queue:         cfg.Queue,
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		requests: requests{
+			pending: make(map[string]chan Message),
+		},
+	}
 
 	// Configure TLS if enabled
 	if cfg.TLS.Enabled {
-		tlsConfig, err := createTLSConfig(cfg.TLS)
+		var err error
+		client.tls, err = createTLSConfig(cfg.TLS)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create TLS config: %w", err)
 		}
-		opts.SetTLSConfig(tlsConfig)
 	}
 
-	// Configure connection callbacks with metrics
-	opts.SetConnectionLostHandler(func(c paho.Client, err error) {
-		logger.Warn("MQTT connection lost", zap.Error(err))
-		client.metrics.SetMQTTConnected(false)
-	})
-
-	opts.SetOnConnectHandler(func(c paho.Client) {
-		logger.Info("MQTT connected successfully")
-		client.metrics.SetMQTTConnected(true)
-	})
-
-	opts.SetReconnectingHandler(func(c paho.Client, opts *paho.ClientOptions) {
-		logger.Info("MQTT attempting reconnection")
-	})
-
-	mqttClient := paho.NewClient(opts)
-	client.client = mqttClient
+	conn, err := client.newConnection(false)
+	if err != nil {
+		return nil, err
+	}
+	client.conn = conn
 
 	// Initial connection with retry
 	retries := 0
 	for {
-		token := mqttClient.Connect()
-		if token.WaitTimeout(time.Duration(cfg.Reconnect.Initial) * time.Second) {
-			if token.Error() != nil {
-				if retries >= cfg.Reconnect.MaxRetries {
-					return nil, fmt.Errorf("failed to connect after %d retries: %w", retries, token.Error())
-				}
-				logger.Warn("Failed to connect, retrying...",
-					zap.Error(token.Error()),
-					zap.Int("retry", retries+1),
-					zap.Int("maxRetries", cfg.Reconnect.MaxRetries))
-				client.metrics.SetMQTTConnected(false)
-				retries++
-				time.Sleep(time.Duration(cfg.Reconnect.Initial) * time.Second)
-				continue
-			}
+		err := conn.Connect(time.Duration(cfg.Reconnect.Initial) * time.Second)
+		if err == nil {
 			break
 		}
-		return nil, fmt.Errorf("connection timeout")
+		if retries >= cfg.Reconnect.MaxRetries {
+			return nil, fmt.Errorf("failed to connect after %d retries: %w", retries, err)
+		}
+		logger.Warn("Failed to connect, retrying...",
+			zap.Error(err),
+			zap.Int("retry", retries+1),
+			zap.Int("maxRetries", cfg.Reconnect.MaxRetries))
+		client.metrics.SetMQTTConnected(client.name, false)
+		retries++
+		time.Sleep(time.Duration(cfg.Reconnect.Initial) * time.Second)
 	}
 
-	client.metrics.SetMQTTConnected(true)
+	client.metrics.SetMQTTConnected(client.name, true)
+
+	if client.queue != nil {
+		go client.forward()
+		client.wakeForwarder()
+	}
+	if cfg.FailbackInterval > 0 && len(cfg.Failover) > 0 {
+		go client.failback(cfg.FailbackInterval)
+	}
 	return client, nil
 }
 
+// newConnection creates a broker connection for the configured protocol
+// version. Its state changes are only handled while it is the client's
+// connection, so a connection made to fail back stays silent until it
+// replaces the current one.
+func (c *Client) newConnection(failback bool) (connection, error) {
+	var conn connection
+	handlers := connectionHandlers{
+		onConnectionLost: func(err error) {
+			if c.connection() != conn {
+				return
+			}
+			c.logger.Warn("MQTT connection lost", zap.Error(err))
+			c.metrics.SetMQTTConnected(c.name, false)
+		},
+		onConnect: func() {
+			if c.connection() != conn {
+				return
+			}
+			c.connected()
+			go c.resubscribe()
+		},
+		onReconnecting: func() {
+			if c.connection() != conn {
+				return
+			}
+			c.logger.Info("MQTT attempting reconnection")
+		},
+	}
+
+	switch c.cfg.ProtocolVersion {
+	case 0, ProtocolV311:
+		conn = newPahoConn(c.cfg, c.tls, handlers, failback)
+	case ProtocolV5:
+		v5, err := newV5Conn(c.cfg, c.tls, handlers, c.logger, failback)
+		if err != nil {
+			return nil, err
+		}
+		conn = v5
+	default:
+		return nil, fmt.Errorf("unsupported MQTT protocol version: %d", c.cfg.ProtocolVersion)
+	}
+	return conn, nil
+}
+
+// connection returns the current broker connection
+func (c *Client) connection() connection {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.conn
+}
+
+// connected records a new connection and resumes forwarding queued messages
+func (c *Client) connected() {
+	c.logger.Info("MQTT connected successfully", zap.String("url", c.connection().Server()))
+	c.metrics.SetMQTTConnected(c.name, true)
+	c.recordActiveBroker()
+	c.wakeForwarder()
+}
+
+// ActiveBroker returns the URL of the connected broker, empty if
+// disconnected
+func (c *Client) ActiveBroker() string {
+	return c.connection().Server()
+}
+
+// recordActiveBroker marks the connected broker as active in metrics
+func (c *Client) recordActiveBroker() {
+	active := c.connection().Server()
+	for _, broker := range c.brokers {
+		c.metrics.SetMQTTActiveBroker(c.name, broker, broker == active)
+	}
+}
+
+// failback periodically checks whether the primary broker is reachable while
+// connected to a failover broker, and switches to it once it is
+func (c *Client) failback(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		active := c.connection().Server()
+		if active == "" || active == c.brokers[0] {
+			continue
+		}
+		if err := probeBroker(c.brokers[0], operationTimeout); err != nil {
+			c.logger.Debug("Primary MQTT broker still unavailable",
+				zap.Error(err),
+				zap.String("url", c.brokers[0]))
+			continue
+		}
+
+		c.logger.Info("Primary MQTT broker is reachable, failing back",
+			zap.String("from", active),
+			zap.String("to", c.brokers[0]))
+		if err := c.switchToPrimary(); err != nil {
+			c.logger.Warn("Failed to fail back to the primary MQTT broker",
+				zap.Error(err),
+				zap.String("url", c.brokers[0]))
+		}
+	}
+}
+
+// switchToPrimary connects a new connection to the primary broker and makes
+// it the client's connection. The current connection keeps publishing and
+// receiving until the new one is connected and subscribed, and is kept if
+// connecting fails.
+func (c *Client) switchToPrimary() error {
+	conn, err := c.newConnection(true)
+	if err != nil {
+		return err
+	}
+	if err := conn.Connect(time.Duration(c.cfg.Reconnect.Initial) * time.Second); err != nil {
+		return err
+	}
+
+	c.connMu.Lock()
+	select {
+	case <-c.done:
+		c.connMu.Unlock()
+		conn.Disconnect()
+		return nil
+	default:
+	}
+	previous := c.conn
+	c.conn = conn
+	c.connMu.Unlock()
+
+	c.connected()
+	c.resubscribe()
+	previous.Disconnect()
+	return nil
+}
+
+// probeBroker checks that a TCP connection to a broker can be opened
+func probeBroker(broker string, timeout time.Duration) error {
+	address, _, err := brokerAddress(broker)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
 // Publish publishes a message to the specified topic
 func (c *Client) Publish(topic string, qos int, retain bool, payload []byte) error {
-	token := c.client.Publish(topic, byte(qos), retain, payload)
-	if !token.WaitTimeout(10 * time.Second) {
-		c.metrics.IncPublishes(false)
-		return fmt.Errorf("publish timeout")
-	}
+	return c.PublishMessage(Message{Topic: topic, QoS: qos, Retain: retain, Payload: payload})
+}
 
-	if err := token.Error(); err != nil {
+// PublishMessage publishes a message with its v5 properties
+func (c *Client) PublishMessage(msg Message) error {
+	if err := c.connection().Publish(msg, operationTimeout); err != nil {
 		c.metrics.IncPublishes(false)
 		return err
 	}
@@ -143,29 +370,198 @@ func (c *Client) Publish(topic string, qos int, retain bool, payload []byte) err
 	return nil
 }
 
-// Subscribe subscribes to the specified topic
-func (c *Client) Subscribe(topic string, qos int, callback func([]byte)) error {
-	token := c.client.Subscribe(topic, byte(qos), func(client paho.Client, msg paho.Message) {
-		callback(msg.Payload())
-	})
-	if !token.WaitTimeout(10 * time.Second) {
-		return fmt.Errorf("subscribe timeout")
+// PublishOrQueue publishes a message, or appends it to the queue if the
+// client is disconnected, earlier messages are still queued, or publishing
+// fails. It reports whether the message was queued. Without a queue it
+// behaves like PublishMessage.
+func (c *Client) PublishOrQueue(msg Message) (bool, error) {
+	if c.queue == nil {
+		return false, c.PublishMessage(msg)
+	}
+
+	// Publishing directly while older messages wait would reorder them
+	if c.connection().IsConnected() && c.queue.Len() == 0 {
+		err := c.PublishMessage(msg)
+		if err == nil {
+			return false, nil
+		}
+		c.logger.Warn("Failed to publish to MQTT, queueing message",
+			zap.Error(err),
+			zap.String("topic", msg.Topic))
+	}
+
+	if err := c.queue.Push(msg); err != nil {
+		return false, fmt.Errorf("failed to queue message: %w", err)
+	}
+	c.wakeForwarder()
+	return true, nil
+}
+
+// wakeForwarder asks the forwarder to drain the queue
+func (c *Client) wakeForwarder() {
+	if c.queue == nil {
+		return
+	}
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// forward drains the queue whenever woken until the client is closed
+func (c *Client) forward() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.wake:
+			c.drain()
+		}
+	}
+}
+
+// drain publishes queued messages in order while connected, stopping at the
+// first failure so that the message is retried first
+func (c *Client) drain() {
+	forwarded := 0
+	for c.connection().IsConnected() {
+		msg, ok := c.queue.Peek()
+		if !ok {
+			break
+		}
+		if err := c.PublishMessage(msg); err != nil {
+			c.logger.Warn("Failed to forward queued message",
+				zap.Error(err),
+				zap.String("topic", msg.Topic),
+				zap.Int("remaining", c.queue.Len()))
+			break
+		}
+		c.queue.Pop()
+		forwarded++
+	}
+
+	if forwarded > 0 {
+		c.logger.Info("Forwarded queued messages",
+			zap.Int("messages", forwarded),
+			zap.Int("remaining", c.queue.Len()))
+	}
+}
+
+// Subscribe subscribes to the specified topic filter. The subscription is
+// kept and restored after reconnecting even if subscribing now fails.
+func (c *Client) Subscribe(topic string, qos int, handler MessageHandler) error {
+	c.subMu.Lock()
+	c.subscriptions[topic] = subscription{qos: qos, handler: handler}
+	qos = c.subscriptionQoS(topic)
+	c.subMu.Unlock()
+
+	return c.subscribe(topic, qos)
+}
+
+// Unsubscribe removes the subscription to the specified topic filter. The
+// broker subscription stays while requests still wait for replies on it.
+func (c *Client) Unsubscribe(topic string) error {
+	c.subMu.Lock()
+	delete(c.subscriptions, topic)
+	reply := c.replyTopics[topic]
+	c.subMu.Unlock()
+
+	if reply {
+		return nil
+	}
+	return c.connection().Unsubscribe(topic, operationTimeout)
+}
+
+// subscriptionQoS returns the QoS a topic filter is subscribed with, the
+// highest of its subscription and its use as a reply topic. The caller must
+// hold subMu.
+func (c *Client) subscriptionQoS(topic string) int {
+	qos := c.subscriptions[topic].qos
+	if c.replyTopics[topic] && qos < replyQoS {
+		qos = replyQoS
 	}
-	return token.Error()
+	return qos
 }
 
-// Close disconnects the client
+// subscribe sends a subscription to the broker
+func (c *Client) subscribe(topic string, qos int) error {
+	return c.connection().Subscribe(topic, qos, c.dispatch(topic), operationTimeout)
+}
+
+// dispatch returns the handler of a topic filter's broker subscription. It
+// looks up the subscription and reply topic for every message, so both see
+// the messages whichever subscribed first.
+func (c *Client) dispatch(topic string) MessageHandler {
+	return func(msg Message) {
+		c.subMu.Lock()
+		sub, subscribed := c.subscriptions[topic]
+		reply := c.replyTopics[topic]
+		c.subMu.Unlock()
+
+		if reply {
+			c.handleReply(msg)
+		}
+		if subscribed {
+			sub.handler(msg)
+		}
+	}
+}
+
+// resubscribe restores every subscription and reply topic after
+// (re)connecting
+func (c *Client) resubscribe() {
+	c.subMu.Lock()
+	subs := make(map[string]int, len(c.subscriptions)+len(c.replyTopics))
+	for topic := range c.subscriptions {
+		subs[topic] = c.subscriptionQoS(topic)
+	}
+	for topic := range c.replyTopics {
+		subs[topic] = c.subscriptionQoS(topic)
+	}
+	c.subMu.Unlock()
+
+	for topic, qos := range subs {
+		if err := c.subscribe(topic, qos); err != nil {
+			c.logger.Error("Failed to restore MQTT subscription",
+				zap.Error(err),
+				zap.String("topic", topic))
+			continue
+		}
+		c.logger.Info("Restored MQTT subscription",
+			zap.String("topic", topic),
+			zap.Int("qos", qos))
+	}
+}
+
+// Close stops forwarding queued messages and disconnects the client. Queued
+// messages stay on disk for the next run.
 func (c *Client) Close() {
-	if c.client.IsConnected() {
-		c.client.Disconnect(250)
-		c.metrics.SetMQTTConnected(false)
+	close(c.done)
+	conn := c.connection()
+	if conn.IsConnected() {
+		conn.Disconnect()
+		c.metrics.SetMQTTConnected(c.name, false)
+	}
+}
+
+// ProtocolVersion returns the MQTT protocol version of the connection
+func (c *Client) ProtocolVersion() int {
+	if c.version == 0 {
+		return ProtocolV311
 	}
+	return c.version
+}
+
+// Name returns the name identifying the connection
+func (c *Client) Name() string {
+	return c.name
 }
 
 // IsConnected returns the connection status
 func (c *Client) IsConnected() bool {
-	connected := c.client != nil && c.client.IsConnected()
-	c.metrics.SetMQTTConnected(connected)
+	conn := c.connection()
+	connected := conn != nil && conn.IsConnected()
+	c.metrics.SetMQTTConnected(c.name, connected)
 	return connected
 }
 
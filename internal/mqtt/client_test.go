@@ -0,0 +1,92 @@
+//file: internal/mqtt/client_test.go
+
+package mqtt
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestFailback(t *testing.T) {
+	for _, version := range []int{ProtocolV311, ProtocolV5} {
+		t.Run(map[int]string{ProtocolV311: "MQTT 3.1.1", ProtocolV5: "MQTT v5"}[version], func(t *testing.T) {
+			_, failover := startBroker(t, nil)
+
+			// Reserve an address for the primary broker, which is down at first
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			address := l.Addr().String()
+			primary := "tcp://" + address
+			l.Close()
+
+			client, err := New(Config{
+				Name:             "test",
+				Broker:           primary,
+				Failover:         []string{failover},
+				FailbackInterval: 50 * time.Millisecond,
+				ClientID:         "client-" + t.Name(),
+				ProtocolVersion:  version,
+				Reconnect:        ReconnectConfig{Initial: 1, MaxDelay: 1},
+			}, zap.NewNop(), nil)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			t.Cleanup(client.Close)
+			if got := client.ActiveBroker(); got != failover {
+				t.Fatalf("ActiveBroker() = %s, want %s", got, failover)
+			}
+
+			received := make(chan Message, 10)
+			if err := client.Subscribe("devices/+", 1, func(msg Message) { received <- msg }); err != nil {
+				t.Fatalf("Subscribe() error = %v", err)
+			}
+
+			// A primary that accepts TCP connections but not MQTT ones leaves
+			// the current connection alone
+			l, err = net.Listen("tcp", address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			go func() {
+				for {
+					conn, err := l.Accept()
+					if err != nil {
+						return
+					}
+					conn.Close()
+				}
+			}()
+			current := client.connection()
+			deadline := time.Now().Add(1500 * time.Millisecond)
+			for time.Now().Before(deadline) {
+				if client.connection() != current || !current.IsConnected() {
+					t.Fatalf("connection to %s dropped while the primary broker is unusable", failover)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			l.Close()
+
+			// Once the primary broker is back the client switches to it
+			// with its subscriptions
+			startBrokerOn(t, address, nil)
+			waitFor(t, "fail back", func() bool { return client.ActiveBroker() == primary })
+
+			if err := client.Publish("devices/d1", 1, false, []byte("back")); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			select {
+			case msg := <-received:
+				if string(msg.Payload) != "back" {
+					t.Errorf("received %q, want %q", msg.Payload, "back")
+				}
+			case <-time.After(testTimeout):
+				t.Fatal("subscription not restored on the primary broker")
+			}
+		})
+	}
+}
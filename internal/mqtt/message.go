@@ -0,0 +1,31 @@
+//file: internal/mqtt/message.go
+
+package mqtt
+
+// Message is an MQTT message to publish or received on a subscription
+type Message struct {
+	Topic      string      `json:"topic"`
+	QoS        int         `json:"qos"`
+	Retain     bool        `json:"retain"`
+	Payload    []byte      `json:"payload"`
+	Properties *Properties `json:"properties,omitempty"`
+}
+
+// Properties are the MQTT v5 publish properties of a message. They are not
+// sent over MQTT 3.1.1 connections.
+type Properties struct {
+	ContentType     string         `json:"contentType,omitempty"`
+	MessageExpiry   uint32         `json:"messageExpiry,omitempty"` // seconds, 0 for none
+	ResponseTopic   string         `json:"responseTopic,omitempty"`
+	CorrelationData []byte         `json:"correlationData,omitempty"`
+	UserProperties  []UserProperty `json:"userProperties,omitempty"`
+}
+
+// UserProperty is an MQTT v5 user property; keys may repeat
+type UserProperty struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// MessageHandler receives messages for a subscription
+type MessageHandler func(msg Message)
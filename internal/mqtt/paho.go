@@ -0,0 +1,140 @@
+//file: internal/mqtt/paho.go
+
+package mqtt
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// pahoConn is an MQTT 3.1.1 broker connection backed by paho, which
+// reconnects automatically, trying the brokers in order
+type pahoConn struct {
+	client paho.Client
+
+	mu sync.Mutex
+	// attempted is the broker of the latest connection attempt, which is
+	// the connected broker once connected
+	attempted string
+}
+
+// newPahoConn creates an MQTT 3.1.1 connection. A connection made to fail
+// back only tries the first broker until it has connected, so that it never
+// takes over the session of the connection it replaces.
+func newPahoConn(cfg Config, tlsConfig *tls.Config, handlers connectionHandlers, failback bool) *pahoConn {
+	c := &pahoConn{}
+
+	opts := paho.NewClientOptions()
+	for _, broker := range cfg.Brokers() {
+		opts.AddBroker(broker)
+	}
+	servers := opts.Servers
+	if failback {
+		opts.Servers = servers[:1]
+	}
+	opts.SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetOrderMatters(false).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(time.Duration(cfg.Reconnect.Initial) * time.Second).
+		SetMaxReconnectInterval(time.Duration(cfg.Reconnect.MaxDelay) * time.Second)
+
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	opts.SetConnectionLostHandler(func(c paho.Client, err error) {
+		handlers.onConnectionLost(err)
+	})
+	opts.SetOnConnectHandler(func(c paho.Client) {
+		handlers.onConnect()
+	})
+	opts.SetReconnectingHandler(func(c paho.Client, opts *paho.ClientOptions) {
+		opts.Servers = servers
+		handlers.onReconnecting()
+	})
+	opts.SetConnectionAttemptHandler(func(broker *url.URL, tlsCfg *tls.Config) *tls.Config {
+		c.mu.Lock()
+		c.attempted = broker.String()
+		c.mu.Unlock()
+		return tlsCfg
+	})
+
+	c.client = paho.NewClient(opts)
+	return c
+}
+
+// Connect makes the initial connection to the broker. If it does not succeed
+// in time paho stops retrying.
+func (c *pahoConn) Connect(timeout time.Duration) error {
+	token := c.client.Connect()
+	if !token.WaitTimeout(timeout) {
+		c.client.Disconnect(0)
+		return fmt.Errorf("connection timeout")
+	}
+	return token.Error()
+}
+
+// Publish sends a message, dropping its v5 properties
+func (c *pahoConn) Publish(msg Message, timeout time.Duration) error {
+	token := c.client.Publish(msg.Topic, byte(msg.QoS), msg.Retain, msg.Payload)
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("publish timeout")
+	}
+	return token.Error()
+}
+
+// Subscribe subscribes to a topic filter
+func (c *pahoConn) Subscribe(topic string, qos int, handler MessageHandler, timeout time.Duration) error {
+	token := c.client.Subscribe(topic, byte(qos), func(client paho.Client, msg paho.Message) {
+		handler(Message{
+			Topic:   msg.Topic(),
+			QoS:     int(msg.Qos()),
+			Retain:  msg.Retained(),
+			Payload: msg.Payload(),
+		})
+	})
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("subscribe timeout")
+	}
+	return token.Error()
+}
+
+// Unsubscribe removes the subscription to a topic filter
+func (c *pahoConn) Unsubscribe(topic string, timeout time.Duration) error {
+	token := c.client.Unsubscribe(topic)
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("unsubscribe timeout")
+	}
+	return token.Error()
+}
+
+// IsConnected returns the connection status
+func (c *pahoConn) IsConnected() bool {
+	return c.client.IsConnected()
+}
+
+// Server returns the URL of the connected broker
+func (c *pahoConn) Server() string {
+	if !c.client.IsConnected() {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempted
+}
+
+// Disconnect closes the connection
+func (c *pahoConn) Disconnect() {
+	if c.client.IsConnected() {
+		c.client.Disconnect(250)
+	}
+}
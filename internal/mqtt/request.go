@@ -0,0 +1,126 @@
+//file: internal/mqtt/request.go
+
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// replyQoS is the QoS of reply topic subscriptions
+const replyQoS = 1
+
+// Request errors
+var (
+	ErrRequestTimeout     = errors.New("timed out waiting for reply")
+	ErrRequestUnsupported = errors.New("request/response requires MQTT v5")
+)
+
+// requests tracks the replies awaited by in-flight requests, keyed by
+// correlation ID
+type requests struct {
+	mu      sync.Mutex
+	pending map[string]chan Message
+}
+
+// Request publishes a message with replyTopic as its response topic and a
+// new correlation ID as its correlation data, then waits for the message on
+// replyTopic carrying the same correlation data or for ctx to end. Requests
+// are never queued since the caller is waiting.
+func (c *Client) Request(ctx context.Context, msg Message, replyTopic string) (Message, error) {
+	if c.ProtocolVersion() != ProtocolV5 {
+		return Message{}, ErrRequestUnsupported
+	}
+	if err := c.subscribeReplies(replyTopic); err != nil {
+		return Message{}, fmt.Errorf("failed to subscribe to reply topic: %w", err)
+	}
+
+	id := uuid.NewString()
+	replies := make(chan Message, 1)
+	c.requests.mu.Lock()
+	c.requests.pending[id] = replies
+	c.requests.mu.Unlock()
+	defer func() {
+		c.requests.mu.Lock()
+		delete(c.requests.pending, id)
+		c.requests.mu.Unlock()
+	}()
+
+	// Copy the properties so the caller's message is left unchanged
+	props := Properties{}
+	if msg.Properties != nil {
+		props = *msg.Properties
+	}
+	props.ResponseTopic = replyTopic
+	props.CorrelationData = []byte(id)
+	msg.Properties = &props
+
+	if err := c.PublishMessage(msg); err != nil {
+		return Message{}, err
+	}
+
+	select {
+	case reply := <-replies:
+		return reply, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Message{}, ErrRequestTimeout
+		}
+		return Message{}, ctx.Err()
+	}
+}
+
+// subscribeReplies subscribes to a reply topic the first time it is used.
+// The subscription is kept for later requests and restored on reconnect,
+// independently of any subscription on the same topic filter.
+func (c *Client) subscribeReplies(topic string) error {
+	c.subMu.Lock()
+	if c.replyTopics[topic] {
+		c.subMu.Unlock()
+		return nil
+	}
+	qos := c.subscriptions[topic].qos
+	c.subMu.Unlock()
+
+	if qos < replyQoS {
+		qos = replyQoS
+	}
+	if err := c.subscribe(topic, qos); err != nil {
+		return err
+	}
+
+	c.subMu.Lock()
+	c.replyTopics[topic] = true
+	c.subMu.Unlock()
+	return nil
+}
+
+// handleReply hands a reply to the request waiting for its correlation ID.
+// Replies nobody waits for, such as late replies, are discarded.
+func (c *Client) handleReply(msg Message) {
+	var id string
+	if msg.Properties != nil {
+		id = string(msg.Properties.CorrelationData)
+	}
+
+	c.requests.mu.Lock()
+	replies, exists := c.requests.pending[id]
+	c.requests.mu.Unlock()
+	if !exists {
+		c.logger.Debug("Discarding unmatched reply",
+			zap.String("topic", msg.Topic),
+			zap.String("correlation_id", id))
+		return
+	}
+
+	// Only the first reply is delivered
+	select {
+	case replies <- msg:
+	default:
+	}
+}
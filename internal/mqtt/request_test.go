@@ -0,0 +1,224 @@
+//file: internal/mqtt/request_test.go
+
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newTestClient connects a client to the broker
+func newTestClient(t *testing.T, brokerURL string, version int) *Client {
+	t.Helper()
+
+	client, err := New(Config{
+		Name:            "test",
+		Broker:          brokerURL,
+		ClientID:        "client-" + t.Name(),
+		ProtocolVersion: version,
+		Reconnect:       ReconnectConfig{Initial: 5, MaxDelay: 5},
+	}, zap.NewNop(), nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+// startResponder answers requests on a topic filter with the payload,
+// echoing the correlation data unless a fixed one is given
+func startResponder(t *testing.T, brokerURL, filter string, payload string, correlationData []byte) {
+	t.Helper()
+
+	device := connectV5(t, brokerURL, nil)
+	handler := func(msg Message) {
+		if msg.Properties == nil || msg.Properties.ResponseTopic == "" {
+			return
+		}
+		data := correlationData
+		if data == nil {
+			data = msg.Properties.CorrelationData
+		}
+		reply := Message{
+			Topic:      msg.Properties.ResponseTopic,
+			QoS:        1,
+			Payload:    []byte(payload),
+			Properties: &Properties{CorrelationData: data},
+		}
+		// Publishing waits for the broker, so it must not hold up delivery
+		go device.Publish(reply, testTimeout)
+	}
+	if err := device.Subscribe(filter, 1, handler, testTimeout); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	_, url := startBroker(t, nil)
+	startResponder(t, url, "commands/ok", `{"status":"done"}`, nil)
+	startResponder(t, url, "commands/wrong", `{"status":"other"}`, []byte("someone-else"))
+	client := newTestClient(t, url, ProtocolV5)
+
+	tests := []struct {
+		name    string
+		topic   string
+		want    string
+		wantErr error
+	}{
+		{name: "reply", topic: "commands/ok", want: `{"status":"done"}`},
+		{name: "reply for another request", topic: "commands/wrong", wantErr: ErrRequestTimeout},
+		{name: "no reply", topic: "commands/silent", wantErr: ErrRequestTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			msg := Message{Topic: tt.topic, QoS: 1, Payload: []byte(`{"command":"run"}`)}
+			reply, err := client.Request(ctx, msg, "replies/"+tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Request() error = %v, want %v", err, tt.wantErr)
+			}
+			if string(reply.Payload) != tt.want {
+				t.Errorf("Request() reply = %q, want %q", reply.Payload, tt.want)
+			}
+			if msg.Properties != nil {
+				t.Error("Request() changed the caller's message")
+			}
+		})
+	}
+
+	client.requests.mu.Lock()
+	defer client.requests.mu.Unlock()
+	if len(client.requests.pending) != 0 {
+		t.Errorf("%d requests still pending", len(client.requests.pending))
+	}
+}
+
+func TestRequestConcurrentReplies(t *testing.T) {
+	_, url := startBroker(t, nil)
+	client := newTestClient(t, url, ProtocolV5)
+
+	// Each device replies with its own name, all on the same reply topic
+	devices := []string{"d1", "d2", "d3", "d4"}
+	for _, device := range devices {
+		startResponder(t, url, "commands/"+device, device, nil)
+	}
+
+	results := make(chan error, len(devices))
+	for _, device := range devices {
+		go func(device string) {
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			reply, err := client.Request(ctx, Message{Topic: "commands/" + device, QoS: 1}, "replies/shared")
+			if err == nil && string(reply.Payload) != device {
+				err = errors.New(device + " received the reply for " + string(reply.Payload))
+			}
+			results <- err
+		}(device)
+	}
+	for range devices {
+		if err := <-results; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRequestCancelled(t *testing.T) {
+	_, url := startBroker(t, nil)
+	client := newTestClient(t, url, ProtocolV5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.Request(ctx, Message{Topic: "commands/none", QoS: 1}, "replies/cancelled")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Request() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRequestReplyTopicSharedWithSubscription(t *testing.T) {
+	_, url := startBroker(t, nil)
+	startResponder(t, url, "commands/d1", "done", nil)
+	client := newTestClient(t, url, ProtocolV5)
+
+	request := func() {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		reply, err := client.Request(ctx, Message{Topic: "commands/d1", QoS: 1}, "replies/d1")
+		if err != nil {
+			t.Fatalf("Request() error = %v", err)
+		}
+		if string(reply.Payload) != "done" {
+			t.Errorf("Request() reply = %q, want %q", reply.Payload, "done")
+		}
+	}
+
+	request()
+
+	// A subscription on the reply topic sees the replies without taking
+	// them from the requests
+	received := make(chan Message, 1)
+	if err := client.Subscribe("replies/d1", 0, func(msg Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	request()
+	select {
+	case msg := <-received:
+		if string(msg.Payload) != "done" {
+			t.Errorf("subscription received %q, want %q", msg.Payload, "done")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("subscription received no message")
+	}
+
+	// Removing the subscription keeps the reply subscription
+	if err := client.Unsubscribe("replies/d1"); err != nil {
+		t.Fatalf("Unsubscribe() error = %v", err)
+	}
+	request()
+	if len(received) != 0 {
+		t.Error("message delivered after Unsubscribe()")
+	}
+}
+
+func TestRequestRequiresV5(t *testing.T) {
+	_, url := startBroker(t, nil)
+	client := newTestClient(t, url, ProtocolV311)
+
+	_, err := client.Request(context.Background(), Message{Topic: "commands/d1"}, "replies/d1")
+	if !errors.Is(err, ErrRequestUnsupported) {
+		t.Errorf("Request() error = %v, want %v", err, ErrRequestUnsupported)
+	}
+}
+
+func TestHandleReplyDeliversFirstReply(t *testing.T) {
+	client := &Client{
+		logger:   zap.NewNop(),
+		requests: requests{pending: make(map[string]chan Message)},
+	}
+	replies := make(chan Message, 1)
+	client.requests.pending["id-1"] = replies
+
+	client.handleReply(Message{Payload: []byte("unmatched"), Properties: &Properties{CorrelationData: []byte("id-2")}})
+	client.handleReply(Message{Payload: []byte("none")})
+	client.handleReply(Message{Payload: []byte("first"), Properties: &Properties{CorrelationData: []byte("id-1")}})
+	client.handleReply(Message{Payload: []byte("second"), Properties: &Properties{CorrelationData: []byte("id-1")}})
+
+	select {
+	case reply := <-replies:
+		if string(reply.Payload) != "first" {
+			t.Errorf("reply = %q, want %q", reply.Payload, "first")
+		}
+	default:
+		t.Fatal("no reply delivered")
+	}
+	if len(replies) != 0 {
+		t.Error("more than one reply delivered")
+	}
+}
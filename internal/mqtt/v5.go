@@ -0,0 +1,486 @@
+//file: internal/mqtt/v5.go
+
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/session/state"
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+)
+
+// defaultKeepAlive is the keep alive interval requested from the broker
+const defaultKeepAlive = 30 * time.Second
+
+// sessionExpiry is how long the broker keeps the session after the
+// connection drops, so that in-flight QoS 1 and 2 messages are sent again
+// when reconnecting within it
+const sessionExpiry = 5 * time.Minute
+
+var (
+	errNotConnected = errors.New("not connected to MQTT broker")
+	errNotPrimary   = errors.New("failing back to the primary broker only")
+)
+
+// v5Conn is an MQTT v5 broker connection backed by paho.golang, which
+// reconnects automatically, trying the brokers in order. The session is kept
+// across reconnects so that unacknowledged QoS 1 and 2 messages are sent
+// again, and publishes respect the broker's Receive Maximum and Maximum QoS.
+// Incoming messages are passed to the handlers one at a time, in order.
+type v5Conn struct {
+	cfg      Config
+	servers  []*url.URL
+	tls      *tls.Config
+	handlers connectionHandlers
+	logger   *zap.Logger
+	session  *state.State
+
+	mu        sync.Mutex
+	manager   *autopaho.ConnectionManager
+	attempted string
+	// failback limits connection attempts to the first broker until the
+	// connection is made
+	failback     bool
+	connected    bool
+	reconnecting bool
+	lastErr      error
+	// up is closed when the initial connection is made
+	up   chan struct{}
+	subs map[string]MessageHandler
+}
+
+// newV5Conn creates an MQTT v5 connection for the broker URLs. A connection
+// made to fail back only tries the first broker until it has connected, so
+// that it never takes over the session of the connection it replaces.
+func newV5Conn(cfg Config, tlsConfig *tls.Config, handlers connectionHandlers, logger *zap.Logger, failback bool) (*v5Conn, error) {
+	var servers []*url.URL
+	for _, broker := range cfg.Brokers() {
+		if _, _, err := brokerAddress(broker); err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(broker)
+		if err != nil {
+			return nil, fmt.Errorf("invalid broker URL: %w", err)
+		}
+		servers = append(servers, u)
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return &v5Conn{
+		cfg:      cfg,
+		servers:  servers,
+		tls:      tlsConfig,
+		handlers: handlers,
+		logger:   logger,
+		session:  state.NewInMemory(),
+		failback: failback,
+		subs:     make(map[string]MessageHandler),
+	}, nil
+}
+
+// brokerAddress splits a broker URL into a dial address and whether it
+// uses TLS
+func brokerAddress(broker string) (string, bool, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid broker URL: %w", err)
+	}
+
+	var secure bool
+	var port string
+	switch strings.ToLower(u.Scheme) {
+	case "tcp", "mqtt":
+		port = "1883"
+	case "ssl", "tls", "mqtts", "tcps":
+		secure, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("unsupported broker scheme %q for MQTT v5", u.Scheme)
+	}
+
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), secure, nil
+}
+
+// Connect starts the connection and waits for the initial connection to the
+// broker. If it does not succeed in time the connection is stopped again.
+func (c *v5Conn) Connect(timeout time.Duration) error {
+	up := make(chan struct{})
+	c.mu.Lock()
+	c.up = up
+	c.mu.Unlock()
+
+	manager, err := autopaho.NewConnection(context.Background(), c.clientConfig(timeout))
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.manager = manager
+	c.mu.Unlock()
+
+	select {
+	case <-up:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	c.stop(manager)
+	c.mu.Lock()
+	lastErr := c.lastErr
+	c.manager = nil
+	c.connected = false
+	c.mu.Unlock()
+	if lastErr != nil {
+		return lastErr
+	}
+	return fmt.Errorf("connection timeout")
+}
+
+// clientConfig builds the paho configuration of the connection
+func (c *v5Conn) clientConfig(timeout time.Duration) autopaho.ClientConfig {
+	return autopaho.ClientConfig{
+		ServerUrls:                    c.servers,
+		TlsCfg:                        c.tls,
+		KeepAlive:                     uint16(defaultKeepAlive / time.Second),
+		CleanStartOnInitialConnection: true,
+		SessionExpiryInterval:         uint32(sessionExpiry / time.Second),
+		ReconnectBackoff:              c.backoff,
+		ConnectTimeout:                timeout,
+		AttemptConnection:             c.attemptConnection,
+		OnConnectionUp: func(*autopaho.ConnectionManager, *paho.Connack) {
+			c.mu.Lock()
+			c.connected = true
+			c.reconnecting = false
+			c.failback = false
+			c.lastErr = nil
+			if c.up != nil {
+				close(c.up)
+				c.up = nil
+			}
+			c.mu.Unlock()
+			c.handlers.onConnect()
+		},
+		OnConnectError: func(err error) {
+			c.mu.Lock()
+			c.lastErr = err
+			c.mu.Unlock()
+			c.logger.Debug("MQTT connection attempt failed", zap.Error(err))
+		},
+		ConnectPacketBuilder: requestProblemInfo,
+		ConnectUsername:      c.cfg.Username,
+		ConnectPassword:      []byte(c.cfg.Password),
+		ClientConfig: paho.ClientConfig{
+			ClientID:          c.cfg.ClientID,
+			Session:           c.session,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.receive},
+			OnClientError:     c.lost,
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				c.lost(fmt.Errorf("disconnected by broker: reason code %d", d.ReasonCode))
+			},
+		},
+	}
+}
+
+// requestProblemInfo asks the broker for reason strings and user properties,
+// which autopaho otherwise declines in the CONNECT packet; some brokers then
+// strip user properties from the messages they deliver
+func requestProblemInfo(cp *paho.Connect, _ *url.URL) (*paho.Connect, error) {
+	if cp.Properties == nil {
+		cp.Properties = &paho.ConnectProperties{}
+	}
+	cp.Properties.RequestProblemInfo = true
+	return cp, nil
+}
+
+// backoff returns the delay before a connection attempt: none for the first
+// attempt, then doubling from the initial delay up to the maximum delay
+func (c *v5Conn) backoff(attempt int) time.Duration {
+	if attempt == 0 {
+		return 0
+	}
+
+	delay := time.Duration(c.cfg.Reconnect.Initial) * time.Second
+	maxDelay := time.Duration(c.cfg.Reconnect.MaxDelay) * time.Second
+	if delay <= 0 {
+		delay = time.Second
+	}
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// attemptConnection opens a network connection to a broker, recording which
+// one was attempted
+func (c *v5Conn) attemptConnection(ctx context.Context, cfg autopaho.ClientConfig, u *url.URL) (net.Conn, error) {
+	c.mu.Lock()
+	if c.failback && u.String() != c.servers[0].String() {
+		c.mu.Unlock()
+		return nil, errNotPrimary
+	}
+	c.attempted = u.String()
+	reconnecting := c.reconnecting
+	c.mu.Unlock()
+	if reconnecting {
+		c.handlers.onReconnecting()
+	}
+
+	address, secure, err := brokerAddress(u.String())
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: cfg.ConnectTimeout}
+	var conn net.Conn
+	if secure {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: cfg.TlsCfg}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to broker: %w", err)
+	}
+	return packets.NewThreadSafeConn(conn), nil
+}
+
+// lost records the loss of the connection; paho reconnects by itself
+func (c *v5Conn) lost(err error) {
+	c.mu.Lock()
+	wasConnected := c.connected
+	c.connected = false
+	c.reconnecting = true
+	c.mu.Unlock()
+
+	if wasConnected {
+		c.handlers.onConnectionLost(err)
+	}
+}
+
+// receive passes an incoming message to the handlers of the matching
+// subscriptions. paho calls it for one message at a time and acknowledges
+// the message once it returns.
+func (c *v5Conn) receive(pr paho.PublishReceived) (bool, error) {
+	p := pr.Packet
+	msg := Message{
+		Topic:      p.Topic,
+		QoS:        int(p.QoS),
+		Retain:     p.Retain,
+		Payload:    p.Payload,
+		Properties: messageProperties(p.Properties),
+	}
+
+	c.mu.Lock()
+	var handlers []MessageHandler
+	for filter, handler := range c.subs {
+		if config.TopicMatches(filter, p.Topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+	return len(handlers) > 0, nil
+}
+
+// current returns the connection manager while connected
+func (c *v5Conn) current() (*autopaho.ConnectionManager, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.manager == nil || !c.connected {
+		return nil, errNotConnected
+	}
+	return c.manager, nil
+}
+
+// Publish sends a message and waits for the QoS flow to complete. Publishes
+// wait for the broker's Receive Maximum to allow them, and QoS levels above
+// the broker's Maximum QoS are rejected.
+func (c *v5Conn) Publish(msg Message, timeout time.Duration) error {
+	manager, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resp, err := manager.Publish(ctx, &paho.Publish{
+		Topic:      msg.Topic,
+		QoS:        byte(msg.QoS),
+		Retain:     msg.Retain,
+		Payload:    msg.Payload,
+		Properties: publishProperties(msg.Properties),
+	})
+	if err != nil {
+		return publishError(err)
+	}
+	if resp != nil && resp.ReasonCode >= 0x80 {
+		return fmt.Errorf("publish rejected by broker: reason code %d", resp.ReasonCode)
+	}
+	return nil
+}
+
+// publishError describes a failed publish
+func publishError(err error) error {
+	switch {
+	case errors.Is(err, autopaho.ConnectionDownError):
+		return errNotConnected
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("publish timeout")
+	default:
+		return err
+	}
+}
+
+// Subscribe subscribes to a topic filter
+func (c *v5Conn) Subscribe(topic string, qos int, handler MessageHandler, timeout time.Duration) error {
+	c.mu.Lock()
+	c.subs[topic] = handler
+	c.mu.Unlock()
+
+	manager, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ack, err := manager.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: byte(qos)}},
+	})
+	if err != nil {
+		return publishError(err)
+	}
+	if len(ack.Reasons) == 0 || ack.Reasons[0] >= 0x80 {
+		return fmt.Errorf("subscription rejected by broker")
+	}
+	return nil
+}
+
+// Unsubscribe removes the subscription to a topic filter
+func (c *v5Conn) Unsubscribe(topic string, timeout time.Duration) error {
+	c.mu.Lock()
+	delete(c.subs, topic)
+	c.mu.Unlock()
+
+	manager, err := c.current()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err = manager.Unsubscribe(ctx, &paho.Unsubscribe{Topics: []string{topic}})
+	if err != nil {
+		return publishError(err)
+	}
+	return nil
+}
+
+// IsConnected returns the connection status
+func (c *v5Conn) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// Server returns the URL of the connected broker
+func (c *v5Conn) Server() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return ""
+	}
+	return c.attempted
+}
+
+// Disconnect closes the connection and stops reconnecting
+func (c *v5Conn) Disconnect() {
+	c.mu.Lock()
+	manager := c.manager
+	c.manager = nil
+	c.connected = false
+	c.mu.Unlock()
+
+	if manager != nil {
+		c.stop(manager)
+	}
+}
+
+// stop shuts a connection manager down, sending a DISCONNECT if connected
+func (c *v5Conn) stop(manager *autopaho.ConnectionManager) {
+	ctx, cancel := context.WithTimeout(context.Background(), operationTimeout)
+	defer cancel()
+	if err := manager.Disconnect(ctx); err != nil {
+		c.logger.Warn("MQTT disconnect did not complete", zap.Error(err))
+	}
+}
+
+// publishProperties converts message properties to paho's
+func publishProperties(props *Properties) *paho.PublishProperties {
+	if props == nil {
+		return nil
+	}
+
+	p := &paho.PublishProperties{
+		ContentType:     props.ContentType,
+		ResponseTopic:   props.ResponseTopic,
+		CorrelationData: props.CorrelationData,
+	}
+	if props.MessageExpiry > 0 {
+		expiry := props.MessageExpiry
+		p.MessageExpiry = &expiry
+	}
+	for _, prop := range props.UserProperties {
+		p.User.Add(prop.Key, prop.Value)
+	}
+	return p
+}
+
+// messageProperties converts the properties of a received message, nil if
+// it has none
+func messageProperties(p *paho.PublishProperties) *Properties {
+	if p == nil {
+		return nil
+	}
+
+	props := &Properties{
+		ContentType:     p.ContentType,
+		ResponseTopic:   p.ResponseTopic,
+		CorrelationData: p.CorrelationData,
+	}
+	if p.MessageExpiry != nil {
+		props.MessageExpiry = *p.MessageExpiry
+	}
+	for _, prop := range p.User {
+		props.UserProperties = append(props.UserProperties, UserProperty{Key: prop.Key, Value: prop.Value})
+	}
+	if props.ContentType == "" && props.ResponseTopic == "" && props.CorrelationData == nil &&
+		props.MessageExpiry == 0 && len(props.UserProperties) == 0 {
+		return nil
+	}
+	return props
+}
@@ -0,0 +1,439 @@
+//file: internal/mqtt/v5_test.go
+
+package mqtt
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"go.uber.org/zap"
+)
+
+const testTimeout = 5 * time.Second
+
+// testClients numbers the client IDs of test connections
+var testClients int32
+
+// startBroker runs an embedded MQTT broker with the given capabilities and
+// returns it with its URL
+func startBroker(t *testing.T, configure func(*server.Capabilities)) (*server.Server, string) {
+	t.Helper()
+	return startBrokerOn(t, "127.0.0.1:0", configure)
+}
+
+// startBrokerOn runs an embedded MQTT broker listening on the address
+func startBrokerOn(t *testing.T, address string, configure func(*server.Capabilities)) (*server.Server, string) {
+	t.Helper()
+
+	caps := server.NewDefaultServerCapabilities()
+	if configure != nil {
+		configure(caps)
+	}
+	broker := server.New(&server.Options{
+		InlineClient: true,
+		Capabilities: caps,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := broker.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: address})
+	if err := broker.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	return broker, "tcp://" + tcp.Address()
+}
+
+// connectV5 connects an MQTT v5 connection to the broker, calling onConnect,
+// if set, on every connection
+func connectV5(t *testing.T, brokerURL string, onConnect func()) *v5Conn {
+	t.Helper()
+
+	if onConnect == nil {
+		onConnect = func() {}
+	}
+	cfg := Config{
+		Broker:          brokerURL,
+		ClientID:        fmt.Sprintf("test-%d", atomic.AddInt32(&testClients, 1)),
+		ProtocolVersion: 5,
+		Reconnect:       ReconnectConfig{Initial: 1, MaxDelay: 1},
+	}
+	handlers := connectionHandlers{
+		onConnect:        onConnect,
+		onConnectionLost: func(error) {},
+		onReconnecting:   func() {},
+	}
+	conn, err := newV5Conn(cfg, nil, handlers, zap.NewNop(), false)
+	if err != nil {
+		t.Fatalf("newV5Conn() error = %v", err)
+	}
+	if err := conn.Connect(testTimeout); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(conn.Disconnect)
+	return conn
+}
+
+// testProxy forwards connections to a broker and can cut them
+type testProxy struct {
+	listener net.Listener
+	target   string
+
+	mu      sync.Mutex
+	conns   []net.Conn
+	refuse  bool
+	replies bool
+}
+
+// startProxy starts a proxy for the broker URL
+func startProxy(t *testing.T, brokerURL string) *testProxy {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProxy{listener: listener, target: strings.TrimPrefix(brokerURL, "tcp://"), replies: true}
+	t.Cleanup(func() {
+		listener.Close()
+		p.cut(true)
+	})
+	go p.serve()
+	return p
+}
+
+// url returns the broker URL of the proxy
+func (p *testProxy) url() string {
+	return "tcp://" + p.listener.Addr().String()
+}
+
+// serve accepts connections until the listener is closed
+func (p *testProxy) serve() {
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		refuse := p.refuse
+		p.mu.Unlock()
+		if refuse {
+			client.Close()
+			continue
+		}
+
+		broker, err := net.Dial("tcp", p.target)
+		if err != nil {
+			client.Close()
+			continue
+		}
+		p.mu.Lock()
+		p.conns = append(p.conns, client, broker)
+		p.mu.Unlock()
+		go io.Copy(broker, client)
+		go p.reply(client, broker)
+	}
+}
+
+// reply forwards the broker's packets to the client unless replies are
+// being dropped
+func (p *testProxy) reply(client, broker net.Conn) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := broker.Read(buf)
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		forward := p.replies
+		p.mu.Unlock()
+		if forward {
+			if _, err := client.Write(buf[:n]); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// cut closes the open connections and refuses new ones, or accepts them
+// again
+func (p *testProxy) cut(refuse bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refuse = refuse
+	if refuse {
+		for _, conn := range p.conns {
+			conn.Close()
+		}
+		p.conns = nil
+	}
+}
+
+// dropReplies discards or forwards the broker's packets to the client
+func (p *testProxy) dropReplies(drop bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replies = !drop
+}
+
+// waitFor polls a condition until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestV5PublishSubscribeProperties(t *testing.T) {
+	_, url := startBroker(t, nil)
+	conn := connectV5(t, url, nil)
+
+	received := make(chan Message, 1)
+	if err := conn.Subscribe("props/#", 1, func(msg Message) { received <- msg }, testTimeout); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	sent := Message{
+		Topic:   "props/d1",
+		QoS:     1,
+		Payload: []byte(`{"id":"d1"}`),
+		Properties: &Properties{
+			ContentType:     "application/json",
+			ResponseTopic:   "replies/d1",
+			CorrelationData: []byte("req-1"),
+			MessageExpiry:   60,
+			UserProperties:  []UserProperty{{Key: "site", Value: "s1"}},
+		},
+	}
+	if err := conn.Publish(sent, testTimeout); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.Topic != sent.Topic || string(msg.Payload) != string(sent.Payload) {
+			t.Errorf("received %s %s, want %s %s", msg.Topic, msg.Payload, sent.Topic, sent.Payload)
+		}
+		p := msg.Properties
+		if p == nil {
+			t.Fatal("received message has no properties")
+		}
+		if p.ContentType != "application/json" || p.ResponseTopic != "replies/d1" || string(p.CorrelationData) != "req-1" {
+			t.Errorf("received properties %+v", p)
+		}
+		if p.MessageExpiry == 0 || p.MessageExpiry > 60 {
+			t.Errorf("message expiry = %d, want 1-60", p.MessageExpiry)
+		}
+		if len(p.UserProperties) != 1 || p.UserProperties[0] != (UserProperty{Key: "site", Value: "s1"}) {
+			t.Errorf("user properties = %v", p.UserProperties)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("message not received")
+	}
+}
+
+func TestV5DeliversMessagesSeriallyInOrder(t *testing.T) {
+	broker, url := startBroker(t, nil)
+	conn := connectV5(t, url, nil)
+
+	const count = 50
+	var mu sync.Mutex
+	var got []string
+	var active, overlapped int32
+	handler := func(msg Message) {
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		got = append(got, string(msg.Payload))
+		mu.Unlock()
+		atomic.AddInt32(&active, -1)
+	}
+	if err := conn.Subscribe("serial", 1, handler, testTimeout); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	for i := 0; i < count; i++ {
+		if err := broker.Publish("serial", []byte{byte('0' + i%10), byte(i)}, false, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "messages", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == count
+	})
+
+	if atomic.LoadInt32(&overlapped) != 0 {
+		t.Error("handler called concurrently")
+	}
+	for i, payload := range got {
+		if payload[1] != byte(i) {
+			t.Fatalf("message %d received at position %d", payload[1], i)
+		}
+	}
+}
+
+func TestV5RespectsReceiveMaximum(t *testing.T) {
+	// The broker drops clients that exceed its Receive Maximum
+	_, url := startBroker(t, func(caps *server.Capabilities) { caps.ReceiveMaximum = 2 })
+	conn := connectV5(t, url, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- conn.Publish(Message{Topic: "limited", QoS: 1, Payload: []byte("x")}, testTimeout)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	if !conn.IsConnected() {
+		t.Error("connection dropped")
+	}
+}
+
+func TestV5RejectsQoSAboveMaximum(t *testing.T) {
+	_, url := startBroker(t, func(caps *server.Capabilities) { caps.MaximumQos = 1 })
+	conn := connectV5(t, url, nil)
+
+	if err := conn.Publish(Message{Topic: "limited", QoS: 1, Payload: []byte("x")}, testTimeout); err != nil {
+		t.Errorf("Publish() QoS 1 error = %v", err)
+	}
+	if err := conn.Publish(Message{Topic: "limited", QoS: 2, Payload: []byte("x")}, testTimeout); err == nil {
+		t.Error("Publish() QoS 2 succeeded, want error")
+	}
+}
+
+func TestV5KeepsSessionAcrossReconnect(t *testing.T) {
+	broker, url := startBroker(t, nil)
+	proxy := startProxy(t, url)
+	conn := connectV5(t, proxy.url(), nil)
+
+	received := make(chan Message, 1)
+	if err := conn.Subscribe("session", 1, func(msg Message) { received <- msg }, testTimeout); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	// The subscription is not restored by the connection, so the message
+	// only arrives if the broker resumed the session
+	proxy.cut(true)
+	waitFor(t, "disconnect", func() bool { return !conn.IsConnected() })
+	if err := broker.Publish("session", []byte("queued"), false, 1); err != nil {
+		t.Fatal(err)
+	}
+	proxy.cut(false)
+
+	select {
+	case msg := <-received:
+		if string(msg.Payload) != "queued" {
+			t.Errorf("payload = %q, want %q", msg.Payload, "queued")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("message not received after reconnect")
+	}
+}
+
+func TestV5RetransmitsAfterReconnect(t *testing.T) {
+	broker, url := startBroker(t, nil)
+	proxy := startProxy(t, url)
+	conn := connectV5(t, proxy.url(), nil)
+
+	var deliveries int32
+	err := broker.Subscribe("retransmit", 1, func(*server.Client, packets.Subscription, packets.Packet) {
+		atomic.AddInt32(&deliveries, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The PUBACK is lost, so the publish completes only once the message is
+	// sent again on the next connection
+	proxy.dropReplies(true)
+	published := make(chan error, 1)
+	go func() {
+		published <- conn.Publish(Message{Topic: "retransmit", QoS: 1, Payload: []byte("x")}, 2*testTimeout)
+	}()
+	waitFor(t, "delivery", func() bool { return atomic.LoadInt32(&deliveries) > 0 })
+	proxy.cut(true)
+	waitFor(t, "disconnect", func() bool { return !conn.IsConnected() })
+	proxy.dropReplies(false)
+	proxy.cut(false)
+
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	case <-time.After(2 * testTimeout):
+		t.Fatal("publish not completed after reconnect")
+	}
+}
+
+func TestBrokerAddress(t *testing.T) {
+	tests := []struct {
+		name       string
+		broker     string
+		want       string
+		wantSecure bool
+		wantErr    bool
+	}{
+		{name: "tcp", broker: "tcp://localhost:1884", want: "localhost:1884"},
+		{name: "default port", broker: "mqtt://localhost", want: "localhost:1883"},
+		{name: "tls default port", broker: "ssl://broker", want: "broker:8883", wantSecure: true},
+		{name: "mqtts", broker: "mqtts://broker:8884", want: "broker:8884", wantSecure: true},
+		{name: "websocket", broker: "ws://broker:80", wantErr: true},
+		{name: "unparsable", broker: "tcp://%zz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, secure, err := brokerAddress(tt.broker)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("brokerAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want || secure != tt.wantSecure {
+				t.Errorf("brokerAddress() = %q, %v, want %q, %v", got, secure, tt.want, tt.wantSecure)
+			}
+		})
+	}
+}
+
+func TestV5Backoff(t *testing.T) {
+	conn := &v5Conn{cfg: Config{Reconnect: ReconnectConfig{Initial: 1, MaxDelay: 5}}}
+	want := []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, delay := range want {
+		if got := conn.backoff(attempt); got != delay {
+			t.Errorf("backoff(%d) = %v, want %v", attempt, got, delay)
+		}
+	}
+}
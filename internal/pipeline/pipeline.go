@@ -0,0 +1,252 @@
+//file: internal/pipeline/pipeline.go
+
+package pipeline
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"message-transformer/internal/metrics"
+)
+
+// Job statuses before a job completes; completed jobs take the status
+// reported by their publish function
+const (
+	StatusPending    = "pending"
+	StatusPublishing = "publishing"
+)
+
+// Pipeline errors
+var (
+	ErrFull   = errors.New("publish queue is full")
+	ErrClosed = errors.New("publish pipeline is closed")
+)
+
+// Config holds the pipeline settings
+type Config struct {
+	Workers   int
+	QueueSize int
+	// StatusTTL is how long job statuses can be queried after submission
+	StatusTTL time.Duration
+}
+
+// Result is the outcome of a publish job
+type Result struct {
+	Status string
+	Error  string
+	// Details are reported with the status, such as per-target results
+	Details interface{}
+}
+
+// PublishFunc publishes the messages of a job
+type PublishFunc func(ctx context.Context) Result
+
+// Status is the state of a submitted job
+type Status struct {
+	ID        string      `json:"message_id"`
+	RuleID    string      `json:"rule_id"`
+	Status    string      `json:"status"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+	Submitted time.Time   `json:"submitted"`
+	Completed *time.Time  `json:"completed,omitempty"`
+}
+
+// job is a queued publish with its status
+type job struct {
+	status  Status
+	publish PublishFunc
+	// element is the job's entry in the expiry list
+	element *list.Element
+}
+
+// Pipeline publishes submitted jobs from a bounded in-memory queue using a
+// fixed pool of workers, keeping job statuses for a while so that callers
+// can query them later
+type Pipeline struct {
+	cfg     Config
+	logger  *zap.Logger
+	metrics metrics.Recorder
+	queue   chan *job
+	wg      sync.WaitGroup
+	// ctx is passed to the publish functions and cancelled when closing
+	// takes too long
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+	jobs   map[string]*job
+	// order holds jobs by submission time for expiry
+	order *list.List
+}
+
+// New starts a pipeline with the configured number of workers
+func New(cfg Config, logger *zap.Logger, metricsRecorder metrics.Recorder) *Pipeline {
+	if metricsRecorder == nil {
+		metricsRecorder = metrics.NewNoOpRecorder()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pipeline{
+		cfg:     cfg,
+		logger:  logger,
+		metrics: metricsRecorder,
+		queue:   make(chan *job, cfg.QueueSize),
+		jobs:    make(map[string]*job),
+		order:   list.New(),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	p.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go p.work()
+	}
+	logger.Info("Started publish pipeline",
+		zap.Int("workers", cfg.Workers),
+		zap.Int("queueSize", cfg.QueueSize))
+	return p
+}
+
+// Submit queues a publish job for a rule and returns its message ID. It
+// fails with ErrFull instead of waiting when the queue is full.
+func (p *Pipeline) Submit(ruleID string, publish PublishFunc) (string, error) {
+	now := time.Now()
+	j := &job{
+		status: Status{
+			ID:        uuid.NewString(),
+			RuleID:    ruleID,
+			Status:    StatusPending,
+			Submitted: now.UTC(),
+		},
+		publish: publish,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return "", ErrClosed
+	}
+	p.expire(now)
+
+	select {
+	case p.queue <- j:
+	default:
+		p.metrics.IncPublishJobs(metrics.JobRejected)
+		return "", ErrFull
+	}
+	j.element = p.order.PushBack(j)
+	p.jobs[j.status.ID] = j
+	p.metrics.SetPublishQueueLength(len(p.queue))
+	return j.status.ID, nil
+}
+
+// Status returns the status of a job that has not expired
+func (p *Pipeline) Status(id string) (Status, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expire(time.Now())
+
+	j, exists := p.jobs[id]
+	if !exists {
+		return Status{}, false
+	}
+	return j.status, true
+}
+
+// Close stops accepting jobs and waits until the queued jobs are published.
+// If the context ends first, running jobs are cancelled and queued jobs fail
+// without publishing; Close still returns only once the workers have stopped.
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// work publishes jobs until the queue is closed
+func (p *Pipeline) work() {
+	defer p.wg.Done()
+	for j := range p.queue {
+		p.metrics.SetPublishQueueLength(len(p.queue))
+		p.setStatus(j, Result{Status: StatusPublishing}, false)
+
+		result := Result{Status: metrics.JobFailed, Error: "Publish pipeline closed"}
+		if p.ctx.Err() == nil {
+			result = p.run(j)
+		}
+		p.setStatus(j, result, true)
+		p.metrics.IncPublishJobs(result.Status)
+		p.metrics.ObservePublishLatency(time.Since(j.status.Submitted).Seconds())
+	}
+}
+
+// run calls a job's publish function, recovering from panics so that a
+// failing job cannot stop its worker
+func (p *Pipeline) run(j *job) (result Result) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			p.logger.Error("Publish job panicked",
+				zap.Any("panic", rec),
+				zap.String("rule_id", j.status.RuleID),
+				zap.String("message_id", j.status.ID))
+			result = Result{Status: metrics.JobFailed, Error: "Internal server error"}
+		}
+	}()
+	return j.publish(p.ctx)
+}
+
+// setStatus records a job's progress
+func (p *Pipeline) setStatus(j *job, result Result, completed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	j.status.Status = result.Status
+	j.status.Error = result.Error
+	j.status.Details = result.Details
+	if completed {
+		now := time.Now().UTC()
+		j.status.Completed = &now
+	}
+}
+
+// expire forgets completed jobs submitted longer than the status TTL ago;
+// callers must hold mu. Jobs still queued or publishing are kept.
+func (p *Pipeline) expire(now time.Time) {
+	for e := p.order.Front(); e != nil; {
+		j := e.Value.(*job)
+		if now.Sub(j.status.Submitted) < p.cfg.StatusTTL {
+			return
+		}
+		next := e.Next()
+		if j.status.Completed != nil {
+			p.order.Remove(e)
+			delete(p.jobs, j.status.ID)
+		}
+		e = next
+	}
+}
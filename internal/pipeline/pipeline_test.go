@@ -0,0 +1,202 @@
+//file: internal/pipeline/pipeline_test.go
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/metrics"
+)
+
+// waitStatus polls a job's status until it is the wanted one
+func waitStatus(t *testing.T, p *Pipeline, id, want string) Status {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, ok := p.Status(id)
+		if ok && status.Status == want {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status of %s = %q, want %q", id, status.Status, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// published returns a publish function that reports the status
+func published(status string) PublishFunc {
+	return func(context.Context) Result {
+		return Result{Status: status}
+	}
+}
+
+func TestPipelineSubmit(t *testing.T) {
+	p := New(Config{Workers: 2, QueueSize: 4, StatusTTL: time.Minute}, zap.NewNop(), nil)
+	defer p.Close(context.Background())
+
+	tests := []struct {
+		name    string
+		publish PublishFunc
+		want    string
+		wantErr string
+	}{
+		{name: "published", publish: published(metrics.JobPublished), want: metrics.JobPublished},
+		{name: "queued", publish: published(metrics.JobQueued), want: metrics.JobQueued},
+		{
+			name: "failed",
+			publish: func(context.Context) Result {
+				return Result{Status: metrics.JobFailed, Error: "Failed to publish message"}
+			},
+			want:    metrics.JobFailed,
+			wantErr: "Failed to publish message",
+		},
+		{
+			name:    "panic",
+			publish: func(context.Context) Result { panic("boom") },
+			want:    metrics.JobFailed,
+			wantErr: "Internal server error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := p.Submit("rule", tt.publish)
+			if err != nil {
+				t.Fatalf("Submit() error = %v", err)
+			}
+
+			status := waitStatus(t, p, id, tt.want)
+			if status.RuleID != "rule" || status.Error != tt.wantErr || status.Completed == nil {
+				t.Errorf("status = %+v", status)
+			}
+		})
+	}
+
+	if _, ok := p.Status("unknown"); ok {
+		t.Error("Status() found an unknown job")
+	}
+}
+
+func TestPipelineFull(t *testing.T) {
+	p := New(Config{Workers: 1, QueueSize: 2, StatusTTL: time.Minute}, zap.NewNop(), nil)
+
+	// The worker is held by the first job, so two more fill the queue
+	release := make(chan struct{})
+	started := make(chan struct{})
+	first, err := p.Submit("rule", func(context.Context) Result {
+		close(started)
+		<-release
+		return Result{Status: metrics.JobPublished}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if status, _ := p.Status(first); status.Status != StatusPublishing {
+		t.Errorf("running job status = %q, want %q", status.Status, StatusPublishing)
+	}
+
+	var queued []string
+	for i := 0; i < 2; i++ {
+		id, err := p.Submit("rule", published(metrics.JobPublished))
+		if err != nil {
+			t.Fatalf("Submit() %d error = %v", i, err)
+		}
+		if status, _ := p.Status(id); status.Status != StatusPending {
+			t.Errorf("queued job status = %q, want %q", status.Status, StatusPending)
+		}
+		queued = append(queued, id)
+	}
+	if _, err := p.Submit("rule", published(metrics.JobPublished)); !errors.Is(err, ErrFull) {
+		t.Fatalf("Submit() to a full queue error = %v, want %v", err, ErrFull)
+	}
+
+	// Closing publishes the waiting jobs, then rejects new ones
+	close(release)
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	for _, id := range append(queued, first) {
+		if status, _ := p.Status(id); status.Status != metrics.JobPublished {
+			t.Errorf("status of %s after Close() = %q, want %q", id, status.Status, metrics.JobPublished)
+		}
+	}
+	if _, err := p.Submit("rule", published(metrics.JobPublished)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit() after Close() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestPipelineCloseTimeout(t *testing.T) {
+	p := New(Config{Workers: 1, QueueSize: 1, StatusTTL: time.Minute}, zap.NewNop(), nil)
+
+	// The running job publishes until it is cancelled, holding up the job
+	// behind it
+	started := make(chan struct{})
+	running, err := p.Submit("rule", func(ctx context.Context) Result {
+		close(started)
+		<-ctx.Done()
+		return Result{Status: metrics.JobFailed, Error: "Failed to publish message"}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	queued, err := p.Submit("rule", func(context.Context) Result {
+		t.Error("queued job published after Close() timed out")
+		return Result{Status: metrics.JobPublished}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Both jobs have completed by the time Close returns
+	for id, wantErr := range map[string]string{running: "Failed to publish message", queued: "Publish pipeline closed"} {
+		status, _ := p.Status(id)
+		if status.Status != metrics.JobFailed || status.Error != wantErr || status.Completed == nil {
+			t.Errorf("status of %s after Close() = %+v, want failed with %q", id, status, wantErr)
+		}
+	}
+}
+
+func TestPipelineStatusExpiry(t *testing.T) {
+	p := New(Config{Workers: 1, QueueSize: 2, StatusTTL: 50 * time.Millisecond}, zap.NewNop(), nil)
+	defer p.Close(context.Background())
+
+	done, err := p.Submit("rule", published(metrics.JobPublished))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, p, done, metrics.JobPublished)
+
+	release := make(chan struct{})
+	defer close(release)
+	running, err := p.Submit("rule", func(context.Context) Result {
+		<-release
+		return Result{Status: metrics.JobPublished}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Completed jobs expire after the TTL; jobs still running are kept
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := p.Status(done); ok {
+		t.Error("completed job did not expire")
+	}
+	if _, ok := p.Status(running); !ok {
+		t.Error("running job expired")
+	}
+}
@@ -0,0 +1,318 @@
+//file: internal/queue/queue.go
+
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/metrics"
+	"message-transformer/internal/mqtt"
+)
+
+// entryExt is the file extension of queued messages
+const entryExt = ".msg"
+
+// Common queue errors
+var (
+	ErrFull = errors.New("queue is full")
+)
+
+// Config holds the queue limits. Zero limits are unlimited.
+type Config struct {
+	Directory   string
+	MaxMessages int
+	MaxBytes    int64
+	MaxAge      time.Duration
+}
+
+// record is a queued message as stored on disk
+type record struct {
+	mqtt.Message
+	Enqueued time.Time `json:"enqueued"`
+}
+
+// unexpired returns the message with its MQTT v5 message expiry reduced by
+// the time spent queued, reporting false once the expiry has passed
+func (r record) unexpired(now time.Time) (mqtt.Message, bool) {
+	props := r.Properties
+	if props == nil || props.MessageExpiry == 0 {
+		return r.Message, true
+	}
+
+	expiry := time.Duration(props.MessageExpiry) * time.Second
+	queued := now.Sub(r.Enqueued)
+	if queued >= expiry {
+		return mqtt.Message{}, false
+	}
+
+	remaining := *props
+	remaining.MessageExpiry = uint32((expiry - queued + time.Second - 1) / time.Second)
+	message := r.Message
+	message.Properties = &remaining
+	return message, true
+}
+
+// entry locates a queued message on disk
+type entry struct {
+	seq      uint64
+	size     int64
+	enqueued time.Time
+}
+
+// Queue is a persistent FIFO of messages, stored one file per message so a
+// crash can lose at most the message being written
+type Queue struct {
+	cfg     Config
+	logger  *zap.Logger
+	metrics metrics.Recorder
+
+	mu      sync.Mutex
+	entries []entry
+	bytes   int64
+	nextSeq uint64
+}
+
+// Open opens the queue in the configured directory, creating it if needed
+// and loading any messages left from a previous run
+func Open(cfg Config, logger *zap.Logger, metricsRecorder metrics.Recorder) (*Queue, error) {
+	if metricsRecorder == nil {
+		metricsRecorder = metrics.NewNoOpRecorder()
+	}
+	if err := os.MkdirAll(cfg.Directory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	q := &Queue{
+		cfg:     cfg,
+		logger:  logger,
+		metrics: metricsRecorder,
+		nextSeq: 1,
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	q.pruneExpired(time.Now())
+	q.recordDepth()
+	q.mu.Unlock()
+
+	if len(q.entries) > 0 {
+		logger.Info("Loaded queued messages",
+			zap.Int("messages", len(q.entries)),
+			zap.Int64("bytes", q.bytes))
+	}
+	return q, nil
+}
+
+// load indexes the messages stored in the queue directory
+func (q *Queue) load() error {
+	files, err := os.ReadDir(q.cfg.Directory)
+	if err != nil {
+		return fmt.Errorf("failed to read queue directory: %w", err)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || filepath.Ext(name) != entryExt {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, entryExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		msg, size, err := q.read(seq)
+		if err != nil {
+			q.logger.Warn("Discarding unreadable queued message",
+				zap.Error(err),
+				zap.String("file", name))
+			q.remove(seq)
+			continue
+		}
+
+		q.entries = append(q.entries, entry{seq: seq, size: size, enqueued: msg.Enqueued})
+		q.bytes += size
+		if seq >= q.nextSeq {
+			q.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(q.entries, func(i, j int) bool {
+		return q.entries[i].seq < q.entries[j].seq
+	})
+	return nil
+}
+
+// Push appends a message to the queue, failing with ErrFull if it would
+// exceed the configured limits
+func (q *Queue) Push(message mqtt.Message) error {
+	msg := record{Message: message, Enqueued: time.Now()}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode queued message: %w", err)
+	}
+	size := int64(len(data))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pruneExpired(msg.Enqueued)
+	if (q.cfg.MaxMessages > 0 && len(q.entries) >= q.cfg.MaxMessages) ||
+		(q.cfg.MaxBytes > 0 && q.bytes+size > q.cfg.MaxBytes) {
+		q.metrics.IncQueueDropped(metrics.QueueDroppedFull)
+		return ErrFull
+	}
+
+	seq := q.nextSeq
+	if err := q.write(seq, data); err != nil {
+		return err
+	}
+	q.nextSeq++
+	q.entries = append(q.entries, entry{seq: seq, size: size, enqueued: msg.Enqueued})
+	q.bytes += size
+	q.recordDepth()
+	return nil
+}
+
+// Peek returns the oldest message without removing it, reporting false if
+// the queue is empty. Expired and unreadable messages are discarded, as are
+// messages whose MQTT v5 message expiry passed while queued.
+func (q *Queue) Peek() (mqtt.Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pruneExpired(time.Now())
+	for len(q.entries) > 0 {
+		msg, _, err := q.read(q.entries[0].seq)
+		if err == nil {
+			if message, ok := msg.unexpired(time.Now()); ok {
+				return message, true
+			}
+			q.removeOldest()
+			q.metrics.IncQueueDropped(metrics.QueueDroppedExpired)
+			q.recordDepth()
+			continue
+		}
+		q.logger.Warn("Discarding unreadable queued message",
+			zap.Error(err),
+			zap.Uint64("seq", q.entries[0].seq))
+		q.removeOldest()
+		q.recordDepth()
+	}
+	return mqtt.Message{}, false
+}
+
+// Pop removes the oldest message once it has been published
+func (q *Queue) Pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) == 0 {
+		return
+	}
+	q.removeOldest()
+	q.recordDepth()
+}
+
+// Len returns the number of queued messages
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// pruneExpired drops messages older than the maximum age; callers must hold mu
+func (q *Queue) pruneExpired(now time.Time) {
+	if q.cfg.MaxAge <= 0 {
+		return
+	}
+
+	expired := 0
+	for len(q.entries) > 0 && now.Sub(q.entries[0].enqueued) > q.cfg.MaxAge {
+		q.removeOldest()
+		q.metrics.IncQueueDropped(metrics.QueueDroppedExpired)
+		expired++
+	}
+	if expired > 0 {
+		q.logger.Warn("Dropped expired queued messages", zap.Int("messages", expired))
+		q.recordDepth()
+	}
+}
+
+// removeOldest deletes the oldest message; callers must hold mu
+func (q *Queue) removeOldest() {
+	oldest := q.entries[0]
+	q.entries = q.entries[1:]
+	q.bytes -= oldest.size
+	q.remove(oldest.seq)
+}
+
+// recordDepth reports the queue depth; callers must hold mu
+func (q *Queue) recordDepth() {
+	q.metrics.SetQueueDepth(len(q.entries), q.bytes)
+}
+
+// path returns the file storing a message
+func (q *Queue) path(seq uint64) string {
+	return filepath.Join(q.cfg.Directory, fmt.Sprintf("%020d%s", seq, entryExt))
+}
+
+// read loads a message from disk
+func (q *Queue) read(seq uint64) (record, int64, error) {
+	data, err := os.ReadFile(q.path(seq))
+	if err != nil {
+		return record{}, 0, fmt.Errorf("failed to read queued message: %w", err)
+	}
+	var msg record
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return record{}, 0, fmt.Errorf("failed to decode queued message: %w", err)
+	}
+	return msg, int64(len(data)), nil
+}
+
+// write atomically stores a message so a crash never leaves a partial file
+func (q *Queue) write(seq uint64, data []byte) error {
+	tmp, err := os.CreateTemp(q.cfg.Directory, ".msg-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create queued message: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write queued message: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write queued message: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write queued message: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), q.path(seq)); err != nil {
+		return fmt.Errorf("failed to write queued message: %w", err)
+	}
+	return nil
+}
+
+// remove deletes a message file, logging failures since the message is
+// already gone from the index
+func (q *Queue) remove(seq uint64) {
+	if err := os.Remove(q.path(seq)); err != nil && !os.IsNotExist(err) {
+		q.logger.Error("Failed to remove queued message",
+			zap.Error(err),
+			zap.Uint64("seq", seq))
+	}
+}
@@ -0,0 +1,206 @@
+//file: internal/queue/queue_test.go
+
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/mqtt"
+)
+
+// openQueue opens a queue in a test directory
+func openQueue(t *testing.T, cfg Config) *Queue {
+	t.Helper()
+
+	if cfg.Directory == "" {
+		cfg.Directory = t.TempDir()
+	}
+	q, err := Open(cfg, zap.NewNop(), nil)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return q
+}
+
+// message returns a test message with the payload
+func message(payload string) mqtt.Message {
+	return mqtt.Message{Topic: "devices/d1", QoS: 1, Payload: []byte(payload)}
+}
+
+// drain pops every queued message and returns their payloads
+func drain(q *Queue) []string {
+	var payloads []string
+	for {
+		msg, ok := q.Peek()
+		if !ok {
+			return payloads
+		}
+		payloads = append(payloads, string(msg.Payload))
+		q.Pop()
+	}
+}
+
+func TestQueueOrderAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, Config{Directory: dir})
+	for _, payload := range []string{"1", "2", "3"} {
+		if err := q.Push(message(payload)); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+
+	msg, ok := q.Peek()
+	if !ok || string(msg.Payload) != "1" {
+		t.Fatalf("Peek() = %q, %v, want %q", msg.Payload, ok, "1")
+	}
+	q.Pop()
+
+	// Messages survive a restart, and new ones are appended after them
+	reopened := openQueue(t, Config{Directory: dir})
+	if got := reopened.Len(); got != 2 {
+		t.Fatalf("Len() after reopen = %d, want 2", got)
+	}
+	if err := reopened.Push(message("4")); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	got := drain(reopened)
+	want := []string{"2", "3", "4"}
+	if len(got) != len(want) {
+		t.Fatalf("messages = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("messages = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestQueueLimits(t *testing.T) {
+	// The size of one stored message
+	sized := openQueue(t, Config{})
+	if err := sized.Push(message("1")); err != nil {
+		t.Fatal(err)
+	}
+	size := sized.bytes
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		pushes int
+		want   int
+	}{
+		{name: "unlimited", pushes: 5, want: 5},
+		{name: "message limit", cfg: Config{MaxMessages: 3}, pushes: 5, want: 3},
+		{name: "byte limit", cfg: Config{MaxBytes: 2 * size}, pushes: 5, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := openQueue(t, tt.cfg)
+			for i := 0; i < tt.pushes; i++ {
+				err := q.Push(message("1"))
+				if i < tt.want && err != nil {
+					t.Fatalf("Push() %d error = %v", i, err)
+				}
+				if i >= tt.want && !errors.Is(err, ErrFull) {
+					t.Fatalf("Push() %d error = %v, want %v", i, err, ErrFull)
+				}
+			}
+			if got := q.Len(); got != tt.want {
+				t.Errorf("Len() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueMaxAge(t *testing.T) {
+	q := openQueue(t, Config{MaxAge: 50 * time.Millisecond})
+	if err := q.Push(message("old")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := q.Push(message("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := drain(q)
+	if len(got) != 1 || got[0] != "new" {
+		t.Errorf("messages = %v, want [new]", got)
+	}
+}
+
+func TestRecordUnexpired(t *testing.T) {
+	enqueued := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		expiry  uint32
+		queued  time.Duration
+		want    uint32
+		expired bool
+	}{
+		{name: "no expiry", queued: time.Hour},
+		{name: "not queued", expiry: 60, want: 60},
+		{name: "partly elapsed", expiry: 60, queued: 20 * time.Second, want: 40},
+		{name: "rounds up", expiry: 60, queued: 20*time.Second + time.Millisecond, want: 40},
+		{name: "expired", expiry: 60, queued: 60 * time.Second, expired: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := message("x")
+			if tt.expiry > 0 {
+				msg.Properties = &mqtt.Properties{MessageExpiry: tt.expiry}
+			}
+			r := record{Message: msg, Enqueued: enqueued}
+
+			got, ok := r.unexpired(enqueued.Add(tt.queued))
+			if ok == tt.expired {
+				t.Fatalf("unexpired() ok = %v, want %v", ok, !tt.expired)
+			}
+			if !ok {
+				return
+			}
+			var expiry uint32
+			if got.Properties != nil {
+				expiry = got.Properties.MessageExpiry
+			}
+			if expiry != tt.want {
+				t.Errorf("message expiry = %d, want %d", expiry, tt.want)
+			}
+			if tt.expiry > 0 && msg.Properties.MessageExpiry != tt.expiry {
+				t.Error("unexpired() changed the queued message")
+			}
+		})
+	}
+}
+
+func TestQueueDiscardsUnreadableMessages(t *testing.T) {
+	dir := t.TempDir()
+	q := openQueue(t, Config{Directory: dir})
+	for _, payload := range []string{"1", "2"} {
+		if err := q.Push(message(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(q.path(1), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openQueue(t, Config{Directory: dir})
+	got := drain(reopened)
+	if len(got) != 1 || got[0] != "2" {
+		t.Errorf("messages = %v, want [2]", got)
+	}
+	if _, err := os.Stat(q.path(1)); !os.IsNotExist(err) {
+		t.Error("unreadable message file was not removed")
+	}
+}
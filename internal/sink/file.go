@@ -0,0 +1,105 @@
+//file: internal/sink/file.go
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"message-transformer/internal/transformer"
+)
+
+// record is a message as written by the file and stdout sinks, one JSON
+// object per line
+type record struct {
+	Time    time.Time       `json:"time"`
+	RuleID  string          `json:"rule_id"`
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// writerSink appends messages as NDJSON records to a writer
+type writerSink struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+	// err is the last write error, cleared by a successful write
+	err error
+}
+
+// newFileSink opens a file for appending, creating it and its directory
+func newFileSink(path string) (*writerSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create sink directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sink file: %w", err)
+	}
+	return &writerSink{w: file, file: file}, nil
+}
+
+// newStdoutSink writes records to standard output
+func newStdoutSink() *writerSink {
+	return &writerSink{w: os.Stdout}
+}
+
+// Publish writes the message as a single line; concurrent writes never
+// interleave
+func (s *writerSink) Publish(ctx context.Context, ruleID string, msg transformer.Message) (bool, error) {
+	line, err := json.Marshal(record{
+		Time:    time.Now().UTC(),
+		RuleID:  ruleID,
+		Topic:   msg.Topic,
+		Payload: msg.Payload,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(line); err != nil {
+		s.err = fmt.Errorf("failed to write record: %w", err)
+		return false, s.err
+	}
+	s.err = nil
+	return false, nil
+}
+
+// Health reports the last write error
+func (s *writerSink) Health() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close closes the file; standard output is left open
+func (s *writerSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// nullSink discards every message, for testing rules without an output
+type nullSink struct{}
+
+func (nullSink) Publish(ctx context.Context, ruleID string, msg transformer.Message) (bool, error) {
+	return false, nil
+}
+
+func (nullSink) Health() error {
+	return nil
+}
+
+func (nullSink) Close() error {
+	return nil
+}
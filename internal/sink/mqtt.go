@@ -0,0 +1,39 @@
+//file: internal/sink/mqtt.go
+
+package sink
+
+import (
+	"context"
+	"errors"
+
+	"message-transformer/internal/mqtt"
+	"message-transformer/internal/transformer"
+)
+
+// mqttSink publishes to the MQTT broker, queueing messages while it is
+// unavailable if the store-and-forward queue is enabled
+type mqttSink struct {
+	client *mqtt.Client
+}
+
+func newMQTTSink(client *mqtt.Client) *mqttSink {
+	return &mqttSink{client: client}
+}
+
+// Publish publishes the message with its QoS, retain flag and properties
+func (s *mqttSink) Publish(ctx context.Context, ruleID string, msg transformer.Message) (bool, error) {
+	return s.client.PublishOrQueue(msg.MQTT())
+}
+
+// Health reports whether the client is connected
+func (s *mqttSink) Health() error {
+	if !s.client.IsConnected() {
+		return errors.New("not connected to MQTT broker")
+	}
+	return nil
+}
+
+// Close leaves the client open since it also serves subscriptions
+func (s *mqttSink) Close() error {
+	return nil
+}
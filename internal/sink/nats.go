@@ -0,0 +1,168 @@
+//file: internal/sink/nats.go
+
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/transformer"
+)
+
+// natsReconnectWait is the delay between NATS reconnect attempts
+const natsReconnectWait = 2 * time.Second
+
+var errNATSNotConnected = errors.New("not connected to NATS server")
+
+// natsSink publishes messages to a NATS server. MQTT topics are mapped to
+// subjects by replacing '/' with '.'. Every publish is flushed so that the
+// server's PONG confirms it processed the message. The connection is
+// re-established in the background; publishes fail instead of being
+// buffered while it is down.
+type natsSink struct {
+	conn    *nats.Conn
+	timeout time.Duration
+
+	mu sync.Mutex
+	// err is the last dial or disconnect error, reported while disconnected
+	err error
+}
+
+// natsDialer dials the NATS server, recording failures for the sink's health
+type natsDialer struct {
+	net.Dialer
+	sink *natsSink
+}
+
+// Dial opens a connection to the server
+func (d *natsDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.Dial(network, address)
+	if err != nil {
+		d.sink.setErr(err)
+	}
+	return conn, err
+}
+
+// newNATSSink connects to the sink's NATS server. An unreachable server is
+// not an error since the connection keeps retrying.
+func newNATSSink(cfg config.SinkConfig, logger *zap.Logger) (*natsSink, error) {
+	timeout := time.Duration(cfg.ConnectTimeout()) * time.Second
+	s := &natsSink{timeout: timeout}
+	opts := []nats.Option{
+		nats.Name("message-transformer"),
+		nats.Timeout(timeout),
+		nats.SetCustomDialer(&natsDialer{Dialer: net.Dialer{Timeout: timeout}, sink: s}),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(natsReconnectWait),
+		nats.ReconnectBufSize(-1),
+		nats.ConnectHandler(func(conn *nats.Conn) {
+			logger.Info("Connected to NATS server", zap.String("url", conn.ConnectedUrlRedacted()))
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.Info("Reconnected to NATS server", zap.String("url", conn.ConnectedUrlRedacted()))
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				s.setErr(err)
+			}
+			logger.Warn("NATS connection lost", zap.Error(err))
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			logger.Error("NATS server error", zap.Error(err))
+		}),
+	}
+	if cfg.Username != "" {
+		opts = append(opts, nats.UserInfo(cfg.Username, cfg.Password))
+	}
+	if cfg.Token != "" {
+		opts = append(opts, nats.Token(cfg.Token))
+	}
+
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS server: %w", err)
+	}
+	s.conn = conn
+	return s, nil
+}
+
+// Publish publishes the payload to the subject mapped from the topic and
+// waits for the server to acknowledge it
+func (s *natsSink) Publish(ctx context.Context, ruleID string, msg transformer.Message) (bool, error) {
+	subject, err := natsSubject(msg.Topic)
+	if err != nil {
+		return false, err
+	}
+	if !s.conn.IsConnected() {
+		return false, errNATSNotConnected
+	}
+
+	if err := s.conn.Publish(subject, msg.Payload); err != nil {
+		return false, fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if err := s.conn.FlushWithContext(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return false, errors.New("timed out waiting for NATS server")
+		}
+		return false, fmt.Errorf("NATS publish failed: %w", err)
+	}
+	return false, nil
+}
+
+// Health reports the state of the connection without waiting for the server
+func (s *natsSink) Health() error {
+	if s.conn.IsConnected() {
+		return nil
+	}
+
+	err := s.conn.LastError()
+	if err == nil {
+		s.mu.Lock()
+		err = s.err
+		s.mu.Unlock()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNATSNotConnected, err)
+	}
+	return errNATSNotConnected
+}
+
+// setErr records why the connection is down
+func (s *natsSink) setErr(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// Close closes the connection
+func (s *natsSink) Close() error {
+	s.conn.Close()
+	return nil
+}
+
+// natsSubject maps an MQTT topic to a NATS subject
+func natsSubject(topic string) (string, error) {
+	subject := strings.ReplaceAll(topic, "/", ".")
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n*>") {
+		return "", fmt.Errorf("topic %q is not a valid NATS subject", topic)
+	}
+	for _, token := range strings.Split(subject, ".") {
+		if token == "" {
+			return "", fmt.Errorf("topic %q is not a valid NATS subject", topic)
+		}
+	}
+	return subject, nil
+}
@@ -0,0 +1,183 @@
+//file: internal/sink/nats_test.go
+
+package sink
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/transformer"
+)
+
+func TestNATSSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		want    string
+		wantErr bool
+	}{
+		{name: "single level", topic: "orders", want: "orders"},
+		{name: "levels", topic: "orders/42/created", want: "orders.42.created"},
+		{name: "dots kept", topic: "orders/v1.2", want: "orders.v1.2"},
+		{name: "empty", topic: "", wantErr: true},
+		{name: "leading separator", topic: "/orders", wantErr: true},
+		{name: "trailing separator", topic: "orders/", wantErr: true},
+		{name: "empty level", topic: "orders//42", wantErr: true},
+		{name: "empty token from dot", topic: "orders./42", wantErr: true},
+		{name: "space", topic: "orders/new order", wantErr: true},
+		{name: "newline", topic: "orders/42\r\nPUB x 0", wantErr: true},
+		{name: "wildcard", topic: "orders/*", wantErr: true},
+		{name: "full wildcard", topic: "orders/>", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := natsSubject(tt.topic)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("natsSubject(%q) error = %v, wantErr %v", tt.topic, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("natsSubject(%q) = %q, want %q", tt.topic, got, tt.want)
+			}
+		})
+	}
+}
+
+// natsPublish is a message received by the test server
+type natsPublish struct {
+	subject string
+	payload string
+}
+
+// startNATSServer runs a server speaking enough of the NATS protocol for
+// publishing and returns its URL and the messages it receives
+func startNATSServer(t *testing.T) (string, <-chan natsPublish) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	published := make(chan natsPublish, 16)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveNATS(conn, published)
+		}
+	}()
+	return "nats://" + listener.Addr().String(), published
+}
+
+// serveNATS answers a client connection until it closes
+func serveNATS(conn net.Conn, published chan<- natsPublish) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"proto\":1,\"max_payload\":1048576}\r\n")
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "PUB":
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			published <- natsPublish{subject: fields[1], payload: string(payload[:size])}
+		}
+	}
+}
+
+func TestNATSSinkPublish(t *testing.T) {
+	url, published := startNATSServer(t)
+	sink, err := newNATSSink(config.SinkConfig{Name: "events", Type: config.SinkNATS, URL: url}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newNATSSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Health(); err != nil {
+		t.Errorf("Health() error = %v", err)
+	}
+	msg := transformer.Message{Topic: "orders/42", Payload: []byte(`{"id":42}`)}
+	if _, err := sink.Publish(context.Background(), "rule", msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	select {
+	case got := <-published:
+		if got.subject != "orders.42" || got.payload != `{"id":42}` {
+			t.Errorf("published %s %s", got.subject, got.payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not published")
+	}
+
+	if _, err := sink.Publish(context.Background(), "rule", transformer.Message{Topic: "orders/*"}); err == nil {
+		t.Error("Publish() to invalid subject succeeded")
+	}
+}
+
+func TestNATSSinkUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "nats://" + listener.Addr().String()
+	listener.Close()
+
+	cfg := config.SinkConfig{Name: "events", Type: config.SinkNATS, URL: url, Timeout: 1}
+	sink, err := newNATSSink(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newNATSSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	start := time.Now()
+	if err := sink.Health(); !errors.Is(err, errNATSNotConnected) {
+		t.Errorf("Health() error = %v, want %v", err, errNATSNotConnected)
+	}
+	msg := transformer.Message{Topic: "orders/42", Payload: []byte(`{}`)}
+	if _, err := sink.Publish(context.Background(), "rule", msg); !errors.Is(err, errNATSNotConnected) {
+		t.Errorf("Publish() error = %v, want %v", err, errNATSNotConnected)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Health() and Publish() took %v, want no waiting", elapsed)
+	}
+}
+
+func TestNATSSinkInvalidURL(t *testing.T) {
+	cfg := config.SinkConfig{Name: "events", Type: config.SinkNATS, URL: "nats://%zz"}
+	if _, err := newNATSSink(cfg, zap.NewNop()); err == nil {
+		t.Error("newNATSSink() succeeded for an invalid URL")
+	}
+}
@@ -0,0 +1,216 @@
+//file: internal/sink/sink.go
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/metrics"
+	"message-transformer/internal/mqtt"
+	"message-transformer/internal/transformer"
+	"message-transformer/internal/webhook"
+)
+
+// Publisher delivers transformed messages to an output
+type Publisher interface {
+	// Publish delivers a message. It reports whether the message was queued
+	// for later delivery instead.
+	Publish(ctx context.Context, ruleID string, msg transformer.Message) (bool, error)
+	// Health returns nil while the sink can deliver messages
+	Health() error
+	// Close releases the sink's resources
+	Close() error
+}
+
+// Health is the state of a sink as reported by the health endpoint
+type Health struct {
+	Type    string `json:"type"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Registry holds the configured sinks by name, including the MQTT brokers
+type Registry struct {
+	logger  *zap.Logger
+	metrics metrics.Recorder
+	sinks   map[string]Publisher
+	types   map[string]string
+	brokers map[string]*mqtt.Client
+}
+
+// New creates the configured sinks. Each MQTT client is registered as a sink
+// under its name, the default broker as "mqtt", and webhook sinks deliver
+// through the webhook client.
+func New(cfgs []config.SinkConfig, brokers []*mqtt.Client, webhooks *webhook.Client, logger *zap.Logger, metricsRecorder metrics.Recorder) (*Registry, error) {
+	if metricsRecorder == nil {
+		metricsRecorder = metrics.NewNoOpRecorder()
+	}
+
+	r := &Registry{
+		logger:  logger,
+		metrics: metricsRecorder,
+		sinks:   make(map[string]Publisher, len(cfgs)+len(brokers)),
+		types:   make(map[string]string, len(cfgs)+len(brokers)),
+		brokers: make(map[string]*mqtt.Client, len(brokers)),
+	}
+	for _, client := range brokers {
+		r.sinks[client.Name()] = newMQTTSink(client)
+		r.types[client.Name()] = config.SinkMQTT
+		r.brokers[client.Name()] = client
+	}
+
+	for _, cfg := range cfgs {
+		var (
+			sink Publisher
+			err  error
+		)
+		switch cfg.Type {
+		case config.SinkNATS:
+			sink, err = newNATSSink(cfg, logger.With(zap.String("sink", cfg.Name)))
+		case config.SinkWebhook:
+			sink = newWebhookSink(cfg, webhooks)
+		case config.SinkFile:
+			sink, err = newFileSink(cfg.Path)
+		case config.SinkStdout:
+			sink = newStdoutSink()
+		case config.SinkNull:
+			sink = nullSink{}
+		default:
+			err = fmt.Errorf("invalid sink type: %s", cfg.Type)
+		}
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("failed to create sink %s: %w", cfg.Name, err)
+		}
+
+		r.sinks[cfg.Name] = sink
+		r.types[cfg.Name] = cfg.Type
+		logger.Info("Created sink",
+			zap.String("sink", cfg.Name),
+			zap.String("type", cfg.Type))
+	}
+
+	return r, nil
+}
+
+// Publish delivers a message to the sink it names, the MQTT broker if none
+func (r *Registry) Publish(ctx context.Context, ruleID string, msg transformer.Message) (bool, error) {
+	name := sinkName(msg.Sink)
+	sink, exists := r.sinks[name]
+	if !exists {
+		return false, fmt.Errorf("unknown sink: %s", name)
+	}
+
+	queued, err := sink.Publish(ctx, ruleID, msg)
+	r.metrics.IncSinkPublishes(name, err == nil)
+	return queued, err
+}
+
+// Broker returns the MQTT client of the named broker, the default broker if
+// the name is empty
+func (r *Registry) Broker(name string) (*mqtt.Client, bool) {
+	client, exists := r.brokers[sinkName(name)]
+	return client, exists
+}
+
+// ValidateRules checks that every sink used by the rules exists, that MQTT
+// source rules subscribe on a configured broker, and that rules waiting for
+// replies publish on a broker connected with MQTT v5
+func (r *Registry) ValidateRules(rules []config.Rule) error {
+	var errs config.ValidationErrors
+	for _, rule := range rules {
+		if rule.SourceType() == config.SourceMQTT {
+			if _, exists := r.Broker(rule.Source.Broker); !exists {
+				errs = append(errs, config.ValidationError{
+					Field:   "source.broker",
+					Message: fmt.Sprintf("rule %s subscribes on unknown broker %s", rule.ID, rule.Source.BrokerName()),
+				})
+			}
+		}
+		if rule.Reply != nil {
+			if client, exists := r.Broker(""); exists && client.ProtocolVersion() != mqtt.ProtocolV5 {
+				errs = append(errs, config.ValidationError{
+					Field:   "reply",
+					Message: fmt.Sprintf("rule %s waits for replies, which requires MQTT v5 on broker %s", rule.ID, client.Name()),
+				})
+			}
+		}
+		for _, name := range rule.SinkNames() {
+			if _, exists := r.sinks[sinkName(name)]; !exists {
+				errs = append(errs, config.ValidationError{
+					Field:   "sink",
+					Message: fmt.Sprintf("rule %s publishes to unknown sink %s", rule.ID, name),
+				})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Health checks every sink, recording the results as metrics
+func (r *Registry) Health() map[string]Health {
+	health := make(map[string]Health, len(r.sinks))
+	for name, sink := range r.sinks {
+		err := sink.Health()
+		h := Health{Type: r.types[name], Healthy: err == nil}
+		if err != nil {
+			h.Error = err.Error()
+		}
+		health[name] = h
+		r.metrics.SetSinkHealthy(name, err == nil)
+	}
+	return health
+}
+
+// BrokerStatus is the state of an MQTT connection as reported by the health
+// endpoint
+type BrokerStatus struct {
+	Connected bool `json:"connected"`
+	// Active is the URL of the connected broker
+	Active string `json:"active,omitempty"`
+}
+
+// Brokers reports the connection status of each MQTT broker
+func (r *Registry) Brokers() map[string]BrokerStatus {
+	brokers := make(map[string]BrokerStatus, len(r.brokers))
+	for name, client := range r.brokers {
+		brokers[name] = BrokerStatus{
+			Connected: client.IsConnected(),
+			Active:    client.ActiveBroker(),
+		}
+	}
+	return brokers
+}
+
+// Close closes every sink, logging failures
+func (r *Registry) Close() {
+	names := make([]string, 0, len(r.sinks))
+	for name := range r.sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := r.sinks[name].Close(); err != nil {
+			r.logger.Error("Failed to close sink",
+				zap.Error(err),
+				zap.String("sink", name))
+		}
+	}
+}
+
+// sinkName maps the empty sink name of targets to the MQTT broker
+func sinkName(name string) string {
+	if name == "" {
+		return config.SinkMQTT
+	}
+	return name
+}
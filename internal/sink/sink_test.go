@@ -0,0 +1,101 @@
+//file: internal/sink/sink_test.go
+
+package sink
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/mqtt"
+)
+
+// startMQTTBroker runs an embedded MQTT broker and returns its URL
+func startMQTTBroker(t *testing.T) string {
+	t.Helper()
+
+	broker := server.New(&server.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := broker.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	if err := broker.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	if err := broker.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	return "tcp://" + tcp.Address()
+}
+
+// newTestRegistry creates a registry whose default broker connects with the
+// given MQTT protocol version
+func newTestRegistry(t *testing.T, version int) *Registry {
+	t.Helper()
+
+	client, err := mqtt.New(mqtt.Config{
+		Name:            config.SinkMQTT,
+		Broker:          startMQTTBroker(t),
+		ClientID:        "client-" + t.Name(),
+		ProtocolVersion: version,
+		Reconnect:       mqtt.ReconnectConfig{Initial: 5, MaxDelay: 5},
+	}, zap.NewNop(), nil)
+	if err != nil {
+		t.Fatalf("mqtt.New() error = %v", err)
+	}
+	t.Cleanup(client.Close)
+
+	r, err := New(nil, []*mqtt.Client{client}, nil, zap.NewNop(), nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return r
+}
+
+func TestValidateRulesReply(t *testing.T) {
+	var rule config.Rule
+	if err := json.Unmarshal([]byte(`{
+		"id": "command",
+		"api": {"method": "POST", "path": "/command"},
+		"target": {"topic": "commands/d1", "qos": 1},
+		"transform": {"template": "{}"},
+		"reply": {"topic": "replies/d1"}
+	}`), &rule); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		version int
+		wantErr bool
+	}{
+		{name: "MQTT v5", version: mqtt.ProtocolV5},
+		{name: "MQTT 3.1.1", version: mqtt.ProtocolV311, wantErr: true},
+		{name: "default version", version: 0, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRegistry(t, tt.version)
+			err := r.ValidateRules([]config.Rule{rule})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "MQTT v5") {
+				t.Errorf("ValidateRules() error = %v, want an MQTT v5 error", err)
+			}
+		})
+	}
+}
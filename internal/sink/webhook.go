@@ -0,0 +1,48 @@
+//file: internal/sink/webhook.go
+
+package sink
+
+import (
+	"context"
+	"sync"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/transformer"
+	"message-transformer/internal/webhook"
+)
+
+// webhookSink delivers message payloads to an HTTP endpoint
+type webhookSink struct {
+	hook   *config.Webhook
+	client *webhook.Client
+
+	mu sync.Mutex
+	// err is the last delivery error, cleared by a successful delivery
+	err error
+}
+
+func newWebhookSink(cfg config.SinkConfig, client *webhook.Client) *webhookSink {
+	return &webhookSink{hook: cfg.Webhook, client: client}
+}
+
+// Publish delivers the payload, retrying as configured for the webhook
+func (s *webhookSink) Publish(ctx context.Context, ruleID string, msg transformer.Message) (bool, error) {
+	err := s.client.Deliver(ctx, ruleID, s.hook, msg.Payload)
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	return false, err
+}
+
+// Health reports the last delivery error
+func (s *webhookSink) Health() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close has nothing to release since the HTTP client is shared
+func (s *webhookSink) Close() error {
+	return nil
+}
@@ -0,0 +1,47 @@
+//file: internal/transformer/escape.go
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// quoteJSON returns s encoded as a JSON string literal, including quotes
+func quoteJSON(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return `""`
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// stringValue converts a decoded JSON value to its string form
+func stringValue(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	case json.Number:
+		return string(s)
+	default:
+		return fmt.Sprint(s)
+	}
+}
+
+// jsonString renders a value as a quoted JSON string
+func jsonString(v interface{}) string {
+	return quoteJSON(stringValue(v))
+}
+
+// jsonEscape renders a value as the contents of a JSON string, without the
+// surrounding quotes, for use inside a quoted template literal
+func jsonEscape(v interface{}) string {
+	quoted := quoteJSON(stringValue(v))
+	return quoted[1 : len(quoted)-1]
+}
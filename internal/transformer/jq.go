@@ -0,0 +1,119 @@
+//file: internal/transformer/jq.go
+
+package transformer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/itchyny/gojq"
+
+	"message-transformer/internal/config"
+)
+
+// jqTimeout bounds the run time of a single jq expression
+const jqTimeout = 5 * time.Second
+
+// compiledJQ runs a pre-compiled jq expression
+type compiledJQ struct {
+	code   *gojq.Code
+	fanout bool
+}
+
+// compileJQ compiles the jq expression of a transform
+func compileJQ(transform config.Transform) (*compiledJQ, error) {
+	code, err := config.CompileExpression(transform.Expression)
+	if err != nil {
+		return nil, &TransformError{
+			Message: "failed to parse expression",
+			Err:     err,
+		}
+	}
+
+	return &compiledJQ{
+		code:   code,
+		fanout: transform.Fanout(),
+	}, nil
+}
+
+// apply runs the expression and encodes each result. Unless the transform
+// fans out, the expression must yield exactly one result.
+func (j *compiledJQ) apply(data interface{}, _ *Request) ([][]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jqTimeout)
+	defer cancel()
+
+	var outputs [][]byte
+	iter := j.code.RunWithContext(ctx, copyValue(data))
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, isErr := v.(error); isErr {
+			if haltErr, isHalt := err.(*gojq.HaltError); isHalt && haltErr.Value() == nil {
+				break
+			}
+			return nil, &TransformError{
+				Message: "failed to execute expression",
+				Err:     err,
+			}
+		}
+
+		output, err := marshalJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+
+	if !j.fanout && len(outputs) != 1 {
+		return nil, &TransformError{
+			Message: "expression must produce exactly one result",
+			Err:     fmt.Errorf("expression produced %d results", len(outputs)),
+		}
+	}
+
+	return outputs, nil
+}
+
+// evaluateCondition runs a jq condition and reports whether its first
+// result is truthy, i.e. neither false nor null
+func evaluateCondition(code *gojq.Code, data interface{}) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jqTimeout)
+	defer cancel()
+
+	v, ok := code.RunWithContext(ctx, copyValue(data)).Next()
+	if !ok {
+		return false, nil
+	}
+	if err, isErr := v.(error); isErr {
+		if haltErr, isHalt := err.(*gojq.HaltError); isHalt && haltErr.Value() == nil {
+			return false, nil
+		}
+		return false, err
+	}
+	return v != nil && v != false, nil
+}
+
+// copyValue returns a deep copy of decoded JSON data. gojq normalizes
+// json.Number values in place, so each run gets its own copy to leave the
+// input unchanged for the conditions and transforms that share it.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			copied[key] = copyValue(value)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, value := range v {
+			copied[i] = copyValue(value)
+		}
+		return copied
+	default:
+		return v
+	}
+}
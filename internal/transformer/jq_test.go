@@ -0,0 +1,109 @@
+//file: internal/transformer/jq_test.go
+
+package transformer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"message-transformer/internal/config"
+)
+
+func TestCompiledJQApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		multiple   string
+		input      string
+		want       []string
+		wantErr    bool
+	}{
+		{name: "object", expression: `{id: .device.id, v: .value}`, input: `{"device": {"id": "d1"}, "value": 1.5}`, want: []string{`{"id":"d1","v":1.5}`}},
+		{name: "arithmetic on numbers", expression: `{v: (.value * 2)}`, input: `{"value": 21}`, want: []string{`{"v":42}`}},
+		{name: "large integer", expression: `{n: .n}`, input: `{"n": 12345678901234567890}`, want: []string{`{"n":12345678901234567890}`}},
+		{name: "no HTML escaping", expression: `.s`, input: `{"s": "<a&b>"}`, want: []string{`"<a&b>"`}},
+		{name: "array input", expression: `map(. + 1)`, input: `[1, 2]`, want: []string{`[2,3]`}},
+		{name: "multiple results rejected", expression: `.items[]`, input: `{"items": [1, 2]}`, wantErr: true},
+		{name: "multiple results rejected explicitly", expression: `.items[]`, multiple: config.MultipleReject, input: `{"items": [1, 2]}`, wantErr: true},
+		{name: "no result rejected", expression: `empty`, input: `{}`, wantErr: true},
+		{name: "multiple results fanned out", expression: `.items[] | {v: .}`, multiple: config.MultipleFanout, input: `{"items": [1, 2]}`, want: []string{`{"v":1}`, `{"v":2}`}},
+		{name: "no result fanned out", expression: `empty`, multiple: config.MultipleFanout, input: `{}`},
+		{name: "halt stops fan-out", expression: `1, halt, 2`, multiple: config.MultipleFanout, input: `{}`, want: []string{`1`}},
+		{name: "runtime error", expression: `.a + 1`, input: `{"a": "x"}`, wantErr: true},
+		{name: "error function", expression: `error("bad")`, input: `{}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jq, err := compileJQ(config.Transform{Type: config.TransformJQ, Expression: tt.expression, Multiple: tt.multiple})
+			if err != nil {
+				t.Fatalf("compileJQ() error = %v", err)
+			}
+			data, err := decodeInput([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outputs, err := jq.apply(data, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, output := range outputs {
+				got = append(got, string(output))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileJQInvalidExpression(t *testing.T) {
+	for _, expr := range []string{`.a |`, `undefined_function(1)`} {
+		_, err := compileJQ(config.Transform{Type: config.TransformJQ, Expression: expr})
+		if te, ok := err.(*TransformError); !ok || te.Message != "failed to parse expression" {
+			t.Errorf("compileJQ(%q) error = %v, want a parse error", expr, err)
+		}
+	}
+}
+
+func TestCompiledJQLeavesInputUnchanged(t *testing.T) {
+	input := `{"n": 1.50, "nested": {"values": [10, 2.5e3]}}`
+	data, err := decodeInput([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := decodeInput([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jq, err := compileJQ(config.Transform{Type: config.TransformJQ, Expression: `{n: (.n + 1), values: .nested.values}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jq.apply(data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// gojq normalizes json.Number values in place; transforms sharing the
+	// input must still see the numbers as decoded
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("input after apply = %#v, want %#v", data, want)
+	}
+
+	// Templates print the decoded numbers exactly as received
+	tmpl, err := compileTemplate("rule", config.Transform{Template: `{{.n}} {{index .nested.values 1}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := tmpl.Template.Execute(&sb, data); err != nil {
+		t.Fatal(err)
+	}
+	if got := sb.String(); got != "1.50 2.5e3" {
+		t.Errorf("template output = %s, want 1.50 2.5e3", got)
+	}
+}
@@ -0,0 +1,241 @@
+//file: internal/transformer/mapping.go
+
+package transformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/jsonpath"
+)
+
+// compiledMapping builds the output object from field mappings
+type compiledMapping struct {
+	fields []mappedField
+}
+
+// mappedField is a single compiled output field
+type mappedField struct {
+	name     string
+	output   []string
+	selector jsonpath.Path
+	coerce   string
+	def      interface{}
+}
+
+// compileMapping compiles the selectors of a mapping transform
+func compileMapping(mapping map[string]config.FieldMapping) (*compiledMapping, error) {
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m := &compiledMapping{fields: make([]mappedField, 0, len(names))}
+	for _, name := range names {
+		fm := mapping[name]
+		selector, err := jsonpath.Compile(fm.Path)
+		if err != nil {
+			return nil, &TransformError{
+				Message: "failed to parse mapping",
+				Err:     fmt.Errorf("field %s: %w", name, err),
+			}
+		}
+		m.fields = append(m.fields, mappedField{
+			name:     name,
+			output:   strings.Split(name, "."),
+			selector: selector,
+			coerce:   fm.Type,
+			def:      fm.Default,
+		})
+	}
+
+	return m, nil
+}
+
+// apply selects and coerces every field and marshals the resulting object.
+// Missing or null inputs fall back to the field default, or null without one.
+func (m *compiledMapping) apply(data interface{}, _ *Request) ([][]byte, error) {
+	out := make(map[string]interface{}, len(m.fields))
+	for _, f := range m.fields {
+		value, found := f.selector.Get(data)
+		if !found || value == nil {
+			value = f.def
+		}
+
+		if value != nil {
+			coerced, err := coerce(value, f.coerce)
+			if err != nil && f.def != nil {
+				coerced, err = coerce(f.def, f.coerce)
+			}
+			if err != nil {
+				return nil, &TransformError{
+					Message: "failed to apply mapping",
+					Err:     fmt.Errorf("field %s: %w", f.name, err),
+				}
+			}
+			value = coerced
+		}
+
+		setPath(out, f.output, value)
+	}
+
+	output, err := marshalJSON(out)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{output}, nil
+}
+
+// setPath stores value at the nested object path, creating parents as needed
+func setPath(obj map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		child, ok := obj[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			obj[key] = child
+		}
+		obj = child
+	}
+	obj[path[len(path)-1]] = value
+}
+
+// coerce converts a decoded JSON value to the requested type
+func coerce(v interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case config.CoerceNumber:
+		return coerceNumber(v)
+	case config.CoerceBool:
+		return coerceBool(v)
+	case config.CoerceString:
+		return coerceString(v)
+	case config.CoerceTimestamp:
+		return coerceTimestamp(v)
+	default:
+		return v, nil
+	}
+}
+
+// coerceNumber converts numbers, numeric strings and booleans to a number
+func coerceNumber(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case json.Number:
+		return n, nil
+	case float64:
+		return json.Number(strconv.FormatFloat(n, 'f', -1, 64)), nil
+	case int:
+		return json.Number(strconv.Itoa(n)), nil
+	case string:
+		s := strings.TrimSpace(n)
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), nil
+		}
+		return nil, fmt.Errorf("cannot convert %q to number", n)
+	case bool:
+		if n {
+			return json.Number("1"), nil
+		}
+		return json.Number("0"), nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to number", v)
+	}
+}
+
+// coerceBool converts booleans, boolean strings and numbers to a boolean
+func coerceBool(v interface{}) (interface{}, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(b))
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %q to bool", b)
+		}
+		return parsed, nil
+	case json.Number:
+		f, err := b.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %s to bool", b)
+		}
+		return f != 0, nil
+	case float64:
+		return b != 0, nil
+	case int:
+		return b != 0, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to bool", v)
+	}
+}
+
+// coerceString converts scalars to their string form and objects or arrays
+// to their JSON encoding
+func coerceString(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		b, err := marshalJSON(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	default:
+		return stringValue(v), nil
+	}
+}
+
+// epochMillisThreshold separates epoch seconds from epoch milliseconds;
+// 1e12 seconds is far in the future while 1e12 milliseconds is in 2001
+const epochMillisThreshold = 1e12
+
+// coerceTimestamp converts RFC3339 strings and epoch seconds or
+// milliseconds to an RFC3339 UTC timestamp
+func coerceTimestamp(v interface{}) (interface{}, error) {
+	var epoch float64
+	switch t := v.(type) {
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(t))
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %q to timestamp", t)
+		}
+		return parsed.UTC().Format(time.RFC3339Nano), nil
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %s to timestamp", t)
+		}
+		epoch = f
+	case float64:
+		epoch = t
+	case int:
+		epoch = float64(t)
+	default:
+		return nil, fmt.Errorf("cannot convert %T to timestamp", v)
+	}
+
+	if math.Abs(epoch) >= epochMillisThreshold {
+		return time.UnixMilli(int64(epoch)).UTC().Format(time.RFC3339Nano), nil
+	}
+	sec, frac := math.Modf(epoch)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC().Format(time.RFC3339Nano), nil
+}
+
+// marshalJSON encodes v without escaping HTML characters, matching the
+// output of templates
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, &TransformError{
+			Message: "failed to encode output",
+			Err:     err,
+		}
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,173 @@
+//file: internal/transformer/mapping_test.go
+
+package transformer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"message-transformer/internal/config"
+)
+
+func TestCompiledMappingApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "fields",
+			mapping: `{"id": "$.device.id", "value": "$.readings[0].value"}`,
+			input:   `{"device": {"id": "d1"}, "readings": [{"value": 21.5}]}`,
+			want:    `{"id":"d1","value":21.5}`,
+		},
+		{
+			name:    "nested output",
+			mapping: `{"device.id": "$.id", "device.site": "$.site", "seen": "$.ts"}`,
+			input:   `{"id": "d1", "site": "s1", "ts": 1}`,
+			want:    `{"device":{"id":"d1","site":"s1"},"seen":1}`,
+		},
+		{
+			name:    "large number keeps precision",
+			mapping: `{"n": "$.n"}`,
+			input:   `{"n": 12345678901234567890}`,
+			want:    `{"n":12345678901234567890}`,
+		},
+		{
+			name:    "object and array values",
+			mapping: `{"meta": "$.meta", "tags": "$.tags"}`,
+			input:   `{"meta": {"a": 1}, "tags": ["x", "y"]}`,
+			want:    `{"meta":{"a":1},"tags":["x","y"]}`,
+		},
+		{
+			name:    "missing field is null",
+			mapping: `{"id": "$.id"}`,
+			input:   `{}`,
+			want:    `{"id":null}`,
+		},
+		{
+			name:    "default for missing field",
+			mapping: `{"unit": {"path": "$.unit", "default": "C"}}`,
+			input:   `{}`,
+			want:    `{"unit":"C"}`,
+		},
+		{
+			name:    "default for null field",
+			mapping: `{"unit": {"path": "$.unit", "default": "C"}}`,
+			input:   `{"unit": null}`,
+			want:    `{"unit":"C"}`,
+		},
+		{
+			name:    "number from string",
+			mapping: `{"v": {"path": "$.v", "type": "number"}}`,
+			input:   `{"v": " 21.50 "}`,
+			want:    `{"v":21.5}`,
+		},
+		{
+			name:    "number from bool",
+			mapping: `{"v": {"path": "$.v", "type": "number"}}`,
+			input:   `{"v": true}`,
+			want:    `{"v":1}`,
+		},
+		{
+			name:    "invalid number",
+			mapping: `{"v": {"path": "$.v", "type": "number"}}`,
+			input:   `{"v": "high"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid number falls back to default",
+			mapping: `{"v": {"path": "$.v", "type": "number", "default": 0}}`,
+			input:   `{"v": "high"}`,
+			want:    `{"v":0}`,
+		},
+		{
+			name:    "bool from string and number",
+			mapping: `{"on": {"path": "$.on", "type": "bool"}, "off": {"path": "$.off", "type": "bool"}}`,
+			input:   `{"on": "true", "off": 0}`,
+			want:    `{"off":false,"on":true}`,
+		},
+		{
+			name:    "invalid bool",
+			mapping: `{"on": {"path": "$.on", "type": "bool"}}`,
+			input:   `{"on": "yes"}`,
+			wantErr: true,
+		},
+		{
+			name:    "string from scalars and objects",
+			mapping: `{"n": {"path": "$.n", "type": "string"}, "meta": {"path": "$.meta", "type": "string"}}`,
+			input:   `{"n": 42, "meta": {"a": "<b>"}}`,
+			want:    `{"meta":"{\"a\":\"<b>\"}","n":"42"}`,
+		},
+		{
+			name:    "timestamp from RFC3339",
+			mapping: `{"ts": {"path": "$.ts", "type": "timestamp"}}`,
+			input:   `{"ts": "2024-05-01T12:00:00+02:00"}`,
+			want:    `{"ts":"2024-05-01T10:00:00Z"}`,
+		},
+		{
+			name:    "timestamp from epoch seconds",
+			mapping: `{"ts": {"path": "$.ts", "type": "timestamp"}}`,
+			input:   `{"ts": 1714557600}`,
+			want:    `{"ts":"2024-05-01T10:00:00Z"}`,
+		},
+		{
+			name:    "timestamp from epoch milliseconds",
+			mapping: `{"ts": {"path": "$.ts", "type": "timestamp"}}`,
+			input:   `{"ts": 1714557600500}`,
+			want:    `{"ts":"2024-05-01T10:00:00.5Z"}`,
+		},
+		{
+			name:    "invalid timestamp",
+			mapping: `{"ts": {"path": "$.ts", "type": "timestamp"}}`,
+			input:   `{"ts": "yesterday"}`,
+			wantErr: true,
+		},
+		{
+			name:    "array input",
+			mapping: `{"first": "$[0]", "all": "$"}`,
+			input:   `[1, 2]`,
+			want:    `{"all":[1,2],"first":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mapping map[string]config.FieldMapping
+			if err := json.Unmarshal([]byte(tt.mapping), &mapping); err != nil {
+				t.Fatal(err)
+			}
+			m, err := compileMapping(mapping)
+			if err != nil {
+				t.Fatalf("compileMapping() error = %v", err)
+			}
+			data, err := decodeInput([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outputs, err := m.apply(data, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(outputs) != 1 || string(outputs[0]) != tt.want {
+				t.Errorf("apply() = %s, want %s", outputs, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileMappingInvalidSelector(t *testing.T) {
+	_, err := compileMapping(map[string]config.FieldMapping{"id": {Path: "device.id"}})
+	if err == nil {
+		t.Fatal("compileMapping() error = nil, want an error")
+	}
+	if te, ok := err.(*TransformError); !ok || te.Message != "failed to parse mapping" {
+		t.Errorf("compileMapping() error = %v, want a mapping parse error", err)
+	}
+}
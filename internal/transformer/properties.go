@@ -0,0 +1,159 @@
+//file: internal/transformer/properties.go
+
+package transformer
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"text/template"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/mqtt"
+)
+
+// compiledProperties renders the MQTT v5 properties of a target's messages
+type compiledProperties struct {
+	contentType     string
+	messageExpiry   uint32
+	responseTopic   *compiledTopic
+	correlationData *propertyTemplate
+	userProperties  []compiledUserProperty
+}
+
+// compiledUserProperty is a user property with a templated value
+type compiledUserProperty struct {
+	key   string
+	value *propertyTemplate
+}
+
+// propertyTemplate is a compiled property value template
+type propertyTemplate struct {
+	tmpl *template.Template
+	// request is whether the template was rewritten by bindRequest
+	request bool
+}
+
+// compileProperties parses the property templates of a target; targets
+// without properties compile to nil
+func compileProperties(id string, props *config.PublishProperties) (*compiledProperties, error) {
+	if props == nil {
+		return nil, nil
+	}
+
+	compiled := &compiledProperties{
+		contentType:   props.ContentType,
+		messageExpiry: uint32(props.MessageExpiry),
+	}
+
+	if props.ResponseTopic != "" {
+		topic, err := compileTopic(id+"/responseTopic", props.ResponseTopic)
+		if err != nil {
+			return nil, err
+		}
+		compiled.responseTopic = topic
+	}
+
+	if props.CorrelationData != "" {
+		tmpl, err := compilePropertyTemplate(id+"/correlationData", props.CorrelationData)
+		if err != nil {
+			return nil, err
+		}
+		compiled.correlationData = tmpl
+	}
+
+	// Sort user properties so messages carry them in a stable order
+	keys := make([]string, 0, len(props.UserProperties))
+	for key := range props.UserProperties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		tmpl, err := compilePropertyTemplate(id+"/userProperties/"+key, props.UserProperties[key])
+		if err != nil {
+			return nil, err
+		}
+		compiled.userProperties = append(compiled.userProperties, compiledUserProperty{key: key, value: tmpl})
+	}
+
+	return compiled, nil
+}
+
+// compilePropertyTemplate parses a property value template. Like topic
+// templates, missing or null values fail instead of printing "<no value>",
+// but values may contain '/'.
+func compilePropertyTemplate(name, text string) (*propertyTemplate, error) {
+	funcs := templateFuncs()
+	funcs[topicValueFuncName] = requiredValue
+	funcs["header"] = func(string) string { return "" }
+	tmpl, err := template.New(name).
+		Funcs(funcs).
+		Option("missingkey=error").
+		Parse(text)
+	if err != nil {
+		return nil, &TransformError{
+			Message: "failed to parse property template",
+			Err:     err,
+		}
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			requireTopicValues(t.Tree.Root)
+		}
+	}
+	request := bindRequest(tmpl)
+	return &propertyTemplate{tmpl: tmpl, request: request}, nil
+}
+
+// render builds the properties for a message from the input data and the
+// request, which may be nil
+func (c *compiledProperties) render(data interface{}, req *Request) (*mqtt.Properties, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	props := &mqtt.Properties{
+		ContentType:   c.contentType,
+		MessageExpiry: c.messageExpiry,
+	}
+
+	if c.responseTopic != nil {
+		topic, err := c.responseTopic.render(data, req)
+		if err != nil {
+			return nil, err
+		}
+		props.ResponseTopic = topic
+	}
+
+	if c.correlationData != nil {
+		value, err := c.correlationData.execute(data, req)
+		if err != nil {
+			return nil, err
+		}
+		props.CorrelationData = []byte(value)
+	}
+
+	for _, up := range c.userProperties {
+		value, err := up.value.execute(data, req)
+		if err != nil {
+			return nil, err
+		}
+		props.UserProperties = append(props.UserProperties, mqtt.UserProperty{Key: up.key, Value: value})
+	}
+
+	return props, nil
+}
+
+// execute renders a property template for the request, which may be nil
+func (p *propertyTemplate) execute(data interface{}, req *Request) (string, error) {
+	var sb strings.Builder
+	if err := p.tmpl.Execute(&sb, templateData(p.request, data, req)); err != nil {
+		_, _, msg := templateErrorPosition(p.tmpl.Name(), err)
+		return "", &TransformError{
+			Message: "failed to render property",
+			Err:     errors.New(msg),
+		}
+	}
+	return sb.String(), nil
+}
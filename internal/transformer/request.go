@@ -0,0 +1,307 @@
+//file: internal/transformer/request.go
+
+package transformer
+
+import (
+	"net/http"
+	"net/url"
+	"text/template"
+	"text/template/parse"
+
+	"message-transformer/internal/config"
+)
+
+// Request describes the HTTP request an input payload was received with
+type Request struct {
+	Headers http.Header
+	Query   url.Values
+	// Params are the URL parameters matched by the rule's path
+	Params   map[string]string
+	RemoteIP string
+	ID       string
+}
+
+// header returns the request headers, which may be nil
+func (r *Request) header() http.Header {
+	if r == nil {
+		return nil
+	}
+	return r.Headers
+}
+
+// params returns the URL parameters of the request, which may be nil
+func (r *Request) params() map[string]string {
+	if r == nil {
+		return nil
+	}
+	return r.Params
+}
+
+// requestMethods maps the template functions that read the request to the
+// templateRequest methods bindRequest rewrites their calls to
+var requestMethods = map[string]string{
+	config.ParamFuncName: "Param",
+	"header":             "Header",
+}
+
+const (
+	// requestVar holds the templateRequest in templates rewritten by
+	// bindRequest
+	requestVar = "$__request"
+	// dataVar holds the input data in templates rewritten by bindRequest,
+	// replacing $
+	dataVar = "$__data"
+)
+
+// templateRequest is the request as read by templates rewritten by
+// bindRequest
+type templateRequest struct {
+	req *Request
+}
+
+// Param returns a URL parameter of the request; absent parameters give an
+// empty string
+func (r templateRequest) Param(name string) string {
+	return r.req.params()[name]
+}
+
+// Header returns the first value of a request header
+func (r templateRequest) Header(name string) string {
+	return r.req.header().Get(name)
+}
+
+// Input returns the data for invoking a template with data as dot
+func (r templateRequest) Input(data interface{}) templateInput {
+	return templateInput{Request: r, Data: []interface{}{data}}
+}
+
+// templateInput is the data templates rewritten by bindRequest execute with.
+// The input data is the only element of Data so that ranging over it sets
+// dot whatever its value, where {{with}} would skip empty values.
+type templateInput struct {
+	Request templateRequest
+	Data    []interface{}
+}
+
+// templateData returns the data to execute a template with: the input data
+// itself, or wrapped with the request, which may be nil, for templates
+// rewritten by bindRequest
+func templateData(bound bool, data interface{}, req *Request) interface{} {
+	if !bound {
+		return data
+	}
+	return templateRequest{req: req}.Input(data)
+}
+
+// bindRequest rewrites the templates of tmpl that read the request through
+// the param or header functions to read it from their data instead, so the
+// template is compiled once and executed with templateData for every
+// request. Each template becomes
+//
+//	{{$__request := .Request}}{{range $__data := .Data}}...{{end}}
+//
+// with calls to the functions replaced by $__request methods, $ by $__data
+// and {{template}} invocations passing the request on. It reports whether
+// the templates were rewritten; those that do not read the request are left
+// unchanged.
+func bindRequest(tmpl *template.Template) bool {
+	uses := false
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walkTemplate(t.Tree.Root, func(node parse.Node) {
+				if cmd, ok := node.(*parse.CommandNode); ok {
+					for _, arg := range cmd.Args {
+						if ident, ok := arg.(*parse.IdentifierNode); ok && requestMethods[ident.Ident] != "" {
+							uses = true
+						}
+					}
+				}
+			})
+		}
+	}
+	if !uses {
+		return false
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil || t.Tree.Root == nil {
+			continue
+		}
+		root := t.Tree.Root
+		walkTemplate(root, bindRequestNode)
+
+		pos := root.Pos
+		t.Tree.Root = &parse.ListNode{
+			NodeType: parse.NodeList,
+			Pos:      pos,
+			Nodes: []parse.Node{
+				&parse.ActionNode{
+					NodeType: parse.NodeAction,
+					Pos:      pos,
+					Pipe:     fieldPipe(pos, requestVar, "Request"),
+				},
+				&parse.RangeNode{BranchNode: parse.BranchNode{
+					NodeType: parse.NodeRange,
+					Pos:      pos,
+					Pipe:     fieldPipe(pos, dataVar, "Data"),
+					List:     root,
+				}},
+			},
+		}
+	}
+	return true
+}
+
+// bindRequestNode rewrites a node of a template for bindRequest
+func bindRequestNode(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.CommandNode:
+		for i, arg := range n.Args {
+			if ident, ok := arg.(*parse.IdentifierNode); ok && requestMethods[ident.Ident] != "" {
+				n.Args[i] = variable(ident.Pos, requestVar, requestMethods[ident.Ident])
+			}
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" {
+			n.Ident[0] = dataVar
+		}
+	case *parse.TemplateNode:
+		var data parse.Node = &parse.NilNode{NodeType: parse.NodeNil, Pos: n.Pos}
+		if n.Pipe != nil {
+			data = n.Pipe
+		}
+		n.Pipe = &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      n.Pos,
+			Line:     n.Line,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{variable(n.Pos, requestVar, "Input"), data},
+			}},
+		}
+	}
+}
+
+// fieldPipe builds the pipeline {{name := .field}}
+func fieldPipe(pos parse.Pos, name, field string) *parse.PipeNode {
+	return &parse.PipeNode{
+		NodeType: parse.NodePipe,
+		Pos:      pos,
+		Decl:     []*parse.VariableNode{variable(pos, name)},
+		Cmds: []*parse.CommandNode{{
+			NodeType: parse.NodeCommand,
+			Pos:      pos,
+			Args:     []parse.Node{&parse.FieldNode{NodeType: parse.NodeField, Pos: pos, Ident: []string{field}}},
+		}},
+	}
+}
+
+// variable builds a variable node, with any fields or methods following the
+// variable name
+func variable(pos parse.Pos, ident ...string) *parse.VariableNode {
+	return &parse.VariableNode{NodeType: parse.NodeVariable, Pos: pos, Ident: ident}
+}
+
+// walkTemplate calls visit for every node of a template in depth-first
+// order, visiting a node before its children
+func walkTemplate(node parse.Node, visit func(parse.Node)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplate(child, visit)
+		}
+		return
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+	}
+
+	visit(node)
+	switch n := node.(type) {
+	case *parse.ActionNode:
+		walkTemplate(n.Pipe, visit)
+	case *parse.PipeNode:
+		for _, decl := range n.Decl {
+			walkTemplate(decl, visit)
+		}
+		for _, cmd := range n.Cmds {
+			walkTemplate(cmd, visit)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkTemplate(arg, visit)
+		}
+	case *parse.ChainNode:
+		walkTemplate(n.Node, visit)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.TemplateNode:
+		walkTemplate(n.Pipe, visit)
+	}
+}
+
+// walkBranch walks the pipeline and both arms of a control structure
+func walkBranch(branch *parse.BranchNode, visit func(parse.Node)) {
+	walkTemplate(branch.Pipe, visit)
+	walkTemplate(branch.List, visit)
+	walkTemplate(branch.ElseList, visit)
+}
+
+// ruleMetadata returns the rule details exposed to rules using the request
+// context
+func ruleMetadata(rule config.Rule) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          rule.ID,
+		"description": rule.Description,
+		"method":      rule.API.Method,
+		"path":        rule.API.Path,
+	}
+}
+
+// requestContext builds the input of rules using the request context: the
+// decoded payload under body alongside the request details. Headers and
+// query parameters with several values give their first value. A nil
+// request, as for previews, gives empty details.
+func requestContext(req *Request, rule map[string]interface{}, body interface{}) map[string]interface{} {
+	headers := make(map[string]interface{})
+	query := make(map[string]interface{})
+	params := make(map[string]interface{})
+	ctx := map[string]interface{}{
+		"body":      body,
+		"headers":   headers,
+		"query":     query,
+		"params":    params,
+		"remoteIP":  "",
+		"requestId": "",
+		"rule":      rule,
+	}
+	if req == nil {
+		return ctx
+	}
+
+	for name, values := range req.Headers {
+		if len(values) > 0 {
+			headers[http.CanonicalHeaderKey(name)] = values[0]
+		}
+	}
+	for name, values := range req.Query {
+		if len(values) > 0 {
+			query[name] = values[0]
+		}
+	}
+	for name, value := range req.Params {
+		params[name] = value
+	}
+	ctx["remoteIP"] = req.RemoteIP
+	ctx["requestId"] = req.ID
+	return ctx
+}
@@ -0,0 +1,280 @@
+//file: internal/transformer/request_test.go
+
+package transformer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"message-transformer/internal/config"
+)
+
+func TestBindRequest(t *testing.T) {
+	req := &Request{
+		Params:  map[string]string{"id": "d1", "seq": "7"},
+		Headers: http.Header{"X-Tenant": []string{"acme"}},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		input    string
+		escape   string
+		req      *Request
+		want     string
+	}{
+		{name: "param", template: `{"id": "{{param "id"}}"}`, input: `{}`, req: req, want: `{"id": "d1"}`},
+		{name: "piped param", template: `{"seq": {{"seq" | param}}}`, input: `{}`, req: req, want: `{"seq": 7}`},
+		{name: "missing param", template: `{"x": "{{param "x"}}"}`, input: `{}`, req: req, want: `{"x": ""}`},
+		{name: "no request", template: `{"id": "{{param "id"}}"}`, input: `{}`, want: `{"id": ""}`},
+		{
+			name:     "param in range with root data",
+			template: `[{{range $i, $v := .items}}{{if $i}},{{end}}"{{param "id"}}-{{$v}}-{{$.n}}"{{end}}]`,
+			input:    `{"items": ["a", "b"], "n": 1}`,
+			req:      req,
+			want:     `["d1-a-1","d1-b-1"]`,
+		},
+		{
+			name:     "param in invoked template",
+			template: `{{define "item"}}"{{param "id"}}-{{.}}"{{end}}[{{template "item" .a}}, {{template "item" "b"}}]`,
+			input:    `{"a": "x"}`,
+			req:      req,
+			want:     `["d1-x", "d1-b"]`,
+		},
+		{
+			name:     "root data in invoked template",
+			template: `{{define "n"}}{{$.n}}{{end}}{"id": "{{param "id"}}", "n": {{template "n" .}}}`,
+			input:    `{"n": 2}`,
+			req:      req,
+			want:     `{"id": "d1", "n": 2}`,
+		},
+		{name: "empty input", template: `{"id": "{{param "id"}}", "v": {{.}}}`, input: `0`, req: req, want: `{"id": "d1", "v": 0}`},
+		{
+			name:     "escaped param",
+			template: `{"id": "{{param "id"}}"}`,
+			input:    `{}`,
+			escape:   config.EscapeJSON,
+			req:      &Request{Params: map[string]string{"id": `say "hi"`}},
+			want:     `{"id": "say \"hi\""}`,
+		},
+		{name: "without param", template: `{"v": {{.v}}}`, input: `{"v": 1}`, req: req, want: `{"v": 1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := compileTemplate("rule", config.Transform{Template: tt.template, Escape: tt.escape})
+			if err != nil {
+				t.Fatalf("compileTemplate() error = %v", err)
+			}
+			data, err := decodeInput([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			outputs, err := compiled.apply(data, tt.req)
+			if err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			if string(outputs[0]) != tt.want {
+				t.Errorf("apply() = %s, want %s", outputs[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestBindRequestLeavesOtherTemplatesUnchanged(t *testing.T) {
+	text := `{{define "v"}}{{$.v}}{{end}}{"v": {{template "v" .}}}`
+	compiled, err := compileTemplate("rule", config.Transform{Template: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if compiled.request {
+		t.Error("template without param was rewritten")
+	}
+	if got := compiled.Template.Tree.Root.String(); got != `{"v": {{template "v" .}}}` {
+		t.Errorf("template = %s, want it unchanged", got)
+	}
+}
+
+func TestBindRequestConcurrentRequests(t *testing.T) {
+	compiled, err := compileTemplate("rule", config.Transform{Template: `{"id": "{{param "id"}}"}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each request renders its own parameters from the shared template
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			outputs, err := compiled.apply(map[string]interface{}{}, &Request{Params: map[string]string{"id": id}})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if want := `{"id": "` + id + `"}`; string(outputs[0]) != want {
+				t.Errorf("apply() = %s, want %s", outputs[0], want)
+			}
+		}(fmt.Sprint(i))
+	}
+	wg.Wait()
+}
+
+func TestPropertyTemplateHeader(t *testing.T) {
+	tmpl, err := compilePropertyTemplate("rule/userProperties/tenant", `{{header "X-Tenant"}}/{{param "id"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		req  *Request
+		want string
+	}{
+		{
+			name: "request",
+			req:  &Request{Params: map[string]string{"id": "d1"}, Headers: http.Header{"X-Tenant": []string{"acme"}}},
+			want: "acme/d1",
+		},
+		{name: "no request", want: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tmpl.execute(map[string]interface{}{}, tt.req)
+			if err != nil {
+				t.Fatalf("execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	rule := map[string]interface{}{"id": "status"}
+	body := map[string]interface{}{"state": "on"}
+
+	tests := []struct {
+		name string
+		req  *Request
+		want map[string]interface{}
+	}{
+		{
+			name: "request",
+			req: &Request{
+				Headers:  http.Header{"X-Tenant": []string{"acme", "other"}, "x-lower": []string{"v"}},
+				Query:    url.Values{"verbose": []string{"1", "2"}, "empty": []string{}},
+				Params:   map[string]string{"id": "d1"},
+				RemoteIP: "10.0.0.1",
+				ID:       "req-1",
+			},
+			want: map[string]interface{}{
+				"body":      body,
+				"headers":   map[string]interface{}{"X-Tenant": "acme", "X-Lower": "v"},
+				"query":     map[string]interface{}{"verbose": "1"},
+				"params":    map[string]interface{}{"id": "d1"},
+				"remoteIP":  "10.0.0.1",
+				"requestId": "req-1",
+				"rule":      rule,
+			},
+		},
+		{
+			name: "no request",
+			want: map[string]interface{}{
+				"body":      body,
+				"headers":   map[string]interface{}{},
+				"query":     map[string]interface{}{},
+				"params":    map[string]interface{}{},
+				"remoteIP":  "",
+				"requestId": "",
+				"rule":      rule,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestContext(tt.req, rule, body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requestContext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformRequestContext(t *testing.T) {
+	tr, _ := newTestTransformer(t,
+		`{
+			"id": "context",
+			"description": "Device status",
+			"api": {"method": "POST", "path": "/devices/{id}", "requestContext": true},
+			"transform": {"template": "{\"state\": {{jsonString .body.state}}, \"device\": {{jsonString .params.id}}, \"tenant\": {{jsonString (index .headers \"X-Tenant\")}}, \"rule\": {{jsonString .rule.description}}, \"request\": {{jsonString .requestId}}}"},
+			"target": {"topic": "devices/{{.params.id}}/{{.body.state}}"}
+		}`,
+		`{
+			"id": "jq",
+			"api": {"method": "POST", "path": "/jq", "requestContext": true},
+			"filter": ".headers[\"X-Tenant\"] == \"acme\"",
+			"transform": {"type": "jq", "expression": "{state: .body.state, verbose: .query.verbose}"},
+			"target": {"topic": "out"}
+		}`,
+		`{
+			"id": "plain",
+			"api": {"method": "POST", "path": "/plain"},
+			"transform": {"template": "{\"state\": {{jsonString .state}}}"},
+			"target": {"topic": "out"}
+		}`,
+	)
+	req := &Request{
+		Headers: http.Header{"X-Tenant": []string{"acme"}},
+		Query:   url.Values{"verbose": []string{"1"}},
+		Params:  map[string]string{"id": "d1"},
+		ID:      "req-1",
+	}
+
+	tests := []struct {
+		name         string
+		ruleID       string
+		req          *Request
+		wantTopic    string
+		want         string
+		wantFiltered bool
+	}{
+		{
+			name:      "template",
+			ruleID:    "context",
+			req:       req,
+			wantTopic: "devices/d1/on",
+			want:      `{"state": "on", "device": "d1", "tenant": "acme", "rule": "Device status", "request": "req-1"}`,
+		},
+		{name: "jq", ruleID: "jq", req: req, wantTopic: "out", want: `{"state":"on","verbose":"1"}`},
+		{name: "filter on headers", ruleID: "jq", req: &Request{}, wantFiltered: true},
+		{name: "payload at the root without the flag", ruleID: "plain", req: req, wantTopic: "out", want: `{"state": "on"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tr.TransformRequest(tt.ruleID, []byte(`{"state": "on"}`), tt.req)
+			if err != nil {
+				t.Fatalf("TransformRequest() error = %v", err)
+			}
+			if result.Filtered != tt.wantFiltered {
+				t.Fatalf("filtered = %v, want %v", result.Filtered, tt.wantFiltered)
+			}
+			if tt.wantFiltered {
+				return
+			}
+			want := []targetOutput{{topic: tt.wantTopic, payloads: []string{tt.want}}}
+			if got := targetOutputs(result); !reflect.DeepEqual(got, want) {
+				t.Errorf("targets = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+//file: internal/transformer/route.go
+
+package transformer
+
+import (
+	"fmt"
+
+	"github.com/itchyny/gojq"
+
+	"message-transformer/internal/config"
+)
+
+// compiledRoute is a route with its compiled condition and target
+type compiledRoute struct {
+	name      string
+	condition *gojq.Code // nil for the default route
+	drop      bool
+	target    *CompiledTransform // nil for drop routes
+}
+
+// compileRoutes compiles the conditions and targets of a rule's routes
+func compileRoutes(rule config.Rule) ([]*compiledRoute, error) {
+	routes := make([]*compiledRoute, len(rule.Routes))
+	for i, route := range rule.Routes {
+		compiled := &compiledRoute{
+			name: route.Name,
+			drop: route.Drops(),
+		}
+
+		if !route.IsDefault() {
+			code, err := config.CompileExpression(route.Condition)
+			if err != nil {
+				return nil, &TransformError{
+					Message: "failed to parse route condition",
+					Err:     fmt.Errorf("route %s: %w", route.Name, err),
+				}
+			}
+			compiled.condition = code
+		}
+
+		if !compiled.drop {
+			target, err := compile(rule.ID+"/"+route.Name, rule.ResolveTarget(route.Target))
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %w", route.Name, err)
+			}
+			compiled.target = target
+		}
+
+		routes[i] = compiled
+	}
+	return routes, nil
+}
+
+// matchRoute returns the first route whose condition matches the decoded
+// input data
+func matchRoute(routes []*compiledRoute, data interface{}) (*compiledRoute, error) {
+	for _, route := range routes {
+		if route.condition == nil {
+			return route, nil
+		}
+		matched, err := evaluateCondition(route.condition, data)
+		if err != nil {
+			return nil, &TransformError{
+				Message: "failed to evaluate route condition",
+				Err:     fmt.Errorf("route %s: %w", route.name, err),
+			}
+		}
+		if matched {
+			return route, nil
+		}
+	}
+
+	return nil, &TransformError{
+		Message: "no route matched",
+		Err:     fmt.Errorf("no route condition matched the payload"),
+	}
+}
@@ -0,0 +1,127 @@
+//file: internal/transformer/route_test.go
+
+package transformer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransformRuleRoutes(t *testing.T) {
+	tr, counter := newTestTransformer(t,
+		`{
+			"id": "alerts",
+			"api": {"method": "POST", "path": "/alerts"},
+			"transform": {"template": "{\"id\": {{jsonString .id}}}"},
+			"routes": [
+				{"name": "heartbeat", "condition": ".type == \"heartbeat\"", "action": "drop"},
+				{
+					"name": "battery",
+					"condition": ".battery < 20",
+					"topic": "alerts/battery",
+					"transform": {"type": "jq", "expression": "{id, battery}"}
+				},
+				{"name": "critical", "condition": ".severity == \"critical\"", "topic": "alerts/critical"},
+				{"name": "default", "topic": "alerts/other"}
+			]
+		}`,
+		`{
+			"id": "critical",
+			"api": {"method": "POST", "path": "/critical"},
+			"transform": {"template": "{\"id\": {{jsonString .id}}}"},
+			"routes": [
+				{"name": "critical", "condition": ".severity == \"critical\"", "topic": "alerts/critical"}
+			]
+		}`,
+	)
+
+	tests := []struct {
+		name        string
+		ruleID      string
+		input       string
+		wantRoute   string
+		wantDropped bool
+		want        []targetOutput
+		// wantMessage is the TransformError message of inputs that fail
+		wantMessage string
+		wantCounts  map[string]int
+	}{
+		{
+			name:       "first matching route",
+			ruleID:     "alerts",
+			input:      `{"id": "d1", "battery": 15, "severity": "critical"}`,
+			wantRoute:  "battery",
+			want:       []targetOutput{{name: "battery", topic: "alerts/battery", payloads: []string{`{"battery":15,"id":"d1"}`}}},
+			wantCounts: map[string]int{"success": 1},
+		},
+		{
+			name:       "later route",
+			ruleID:     "alerts",
+			input:      `{"id": "d1", "battery": 80, "severity": "critical"}`,
+			wantRoute:  "critical",
+			want:       []targetOutput{{name: "critical", topic: "alerts/critical", payloads: []string{`{"id": "d1"}`}}},
+			wantCounts: map[string]int{"success": 1},
+		},
+		{
+			name:       "default route",
+			ruleID:     "alerts",
+			input:      `{"id": "d1", "battery": 80}`,
+			wantRoute:  "default",
+			want:       []targetOutput{{name: "default", topic: "alerts/other", payloads: []string{`{"id": "d1"}`}}},
+			wantCounts: map[string]int{"success": 1},
+		},
+		{
+			name:        "drop route",
+			ruleID:      "alerts",
+			input:       `{"id": "d1", "type": "heartbeat", "battery": 5}`,
+			wantRoute:   "heartbeat",
+			wantDropped: true,
+			wantCounts:  map[string]int{"dropped": 1},
+		},
+		{
+			name:        "no matching route without default",
+			ruleID:      "critical",
+			input:       `{"id": "d1", "severity": "low"}`,
+			wantMessage: "no route matched",
+			wantCounts:  map[string]int{"failure": 1},
+		},
+		{
+			name:        "condition error",
+			ruleID:      "alerts",
+			input:       `["d1"]`,
+			wantMessage: "failed to evaluate route condition",
+			wantCounts:  map[string]int{"failure": 1},
+		},
+		{
+			name:        "invalid input",
+			ruleID:      "alerts",
+			input:       `{"id":`,
+			wantMessage: "failed to parse input data",
+			wantCounts:  map[string]int{"failure": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter.counts = nil
+			result, err := tr.TransformRule(tt.ruleID, []byte(tt.input))
+			if tt.wantMessage != "" {
+				if te, ok := err.(*TransformError); !ok || te.Message != tt.wantMessage {
+					t.Errorf("TransformRule() error = %v, want %q", err, tt.wantMessage)
+				}
+			} else if err != nil {
+				t.Fatalf("TransformRule() error = %v", err)
+			} else {
+				if result.Route != tt.wantRoute || result.Dropped != tt.wantDropped {
+					t.Errorf("route = %q, dropped %v, want %q, dropped %v", result.Route, result.Dropped, tt.wantRoute, tt.wantDropped)
+				}
+				if got := targetOutputs(result); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("targets = %+v, want %+v", got, tt.want)
+				}
+			}
+			if !reflect.DeepEqual(counter.counts, tt.wantCounts) {
+				t.Errorf("transform metrics = %v, want %v", counter.counts, tt.wantCounts)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+//file: internal/transformer/topic.go
+
+package transformer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"message-transformer/internal/config"
+)
+
+// topicValueFuncName is the template function appended to every action in a
+// topic or property template so that missing fields fail instead of printing
+// "<no value>"
+const topicValueFuncName = "topicValue"
+
+// compiledTopic renders the target topic for a message
+type compiledTopic struct {
+	static string
+	tmpl   *template.Template
+	// request is whether the template was rewritten by bindRequest
+	request bool
+}
+
+// compileTopic parses a topic template; topics without actions are static
+func compileTopic(id, topic string) (*compiledTopic, error) {
+	if !config.IsTopicTemplate(topic) {
+		return &compiledTopic{static: topic}, nil
+	}
+
+	funcs := templateFuncs()
+	funcs[topicValueFuncName] = topicValue
+	tmpl, err := template.New(id + "/topic").
+		Funcs(funcs).
+		Option("missingkey=error").
+		Parse(topic)
+	if err != nil {
+		return nil, &TransformError{
+			Message: "failed to parse topic template",
+			Err:     err,
+		}
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			requireTopicValues(t.Tree.Root)
+		}
+	}
+
+	request := bindRequest(tmpl)
+
+	return &compiledTopic{tmpl: tmpl, request: request}, nil
+}
+
+// render executes the topic template for the request, which may be nil, and
+// validates the result
+func (c *compiledTopic) render(data interface{}, req *Request) (string, error) {
+	if c.tmpl == nil {
+		return c.static, nil
+	}
+
+	var sb strings.Builder
+	if err := c.tmpl.Execute(&sb, templateData(c.request, data, req)); err != nil {
+		_, _, msg := templateErrorPosition(c.tmpl.Name(), err)
+		return "", &TransformError{
+			Message: "failed to render topic",
+			Err:     errors.New(msg),
+		}
+	}
+
+	topic := sb.String()
+	if err := config.ValidateRenderedTopic(topic); err != nil {
+		return "", &TransformError{
+			Message: "rendered topic is invalid",
+			Err:     err,
+		}
+	}
+	return topic, nil
+}
+
+// requiredValue converts a value printed by a template to a string, failing
+// for null values
+func requiredValue(v interface{}) (string, error) {
+	if v == nil {
+		return "", fmt.Errorf("value is null or missing")
+	}
+	return stringValue(v), nil
+}
+
+// topicValue converts a value printed into a topic to a string, failing for
+// null values and for values containing '/', which would add topic levels
+func topicValue(v interface{}) (string, error) {
+	if v == nil {
+		return "", fmt.Errorf("topic value is null or missing")
+	}
+	s := stringValue(v)
+	if strings.Contains(s, "/") {
+		return "", fmt.Errorf("topic value %q contains a topic level separator", s)
+	}
+	return s, nil
+}
+
+// requireTopicValues pipes every printing action in the list, including
+// those inside control structures, through topicValue
+func requireTopicValues(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) == 0 {
+				n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+					NodeType: parse.NodeCommand,
+					Pos:      n.Pos,
+					Args:     []parse.Node{parse.NewIdentifier(topicValueFuncName).SetPos(n.Pos)},
+				})
+			}
+		case *parse.IfNode:
+			requireTopicValues(n.List)
+			requireTopicValues(n.ElseList)
+		case *parse.RangeNode:
+			requireTopicValues(n.List)
+			requireTopicValues(n.ElseList)
+		case *parse.WithNode:
+			requireTopicValues(n.List)
+			requireTopicValues(n.ElseList)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+//file: internal/transformer/topic_test.go
+
+package transformer
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompiledTopicRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		topic   string
+		input   string
+		params  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "static", topic: "devices/status", input: `{}`, want: "devices/status"},
+		{name: "field", topic: "devices/{{.id}}/status", input: `{"id": "d1"}`, want: "devices/d1/status"},
+		{name: "number", topic: "sites/{{.site}}", input: `{"site": 42}`, want: "sites/42"},
+		{name: "several values", topic: "{{.site}}/{{.id}}", input: `{"site": "s1", "id": "d1"}`, want: "s1/d1"},
+		{name: "param", topic: `devices/{{param "id"}}`, input: `{}`, params: map[string]string{"id": "d1"}, want: "devices/d1"},
+		{name: "missing field", topic: "devices/{{.id}}", input: `{}`, wantErr: true},
+		{name: "null field", topic: "devices/{{.id}}", input: `{"id": null}`, wantErr: true},
+		{name: "value adds levels", topic: "devices/{{.id}}", input: `{"id": "d1/extra"}`, wantErr: true},
+		{name: "param adds levels", topic: `devices/{{param "id"}}`, input: `{}`, params: map[string]string{"id": "a/b"}, wantErr: true},
+		{name: "empty value", topic: "devices/{{.id}}/status", input: `{"id": ""}`, wantErr: true},
+		{name: "wildcard value", topic: "devices/{{.id}}", input: `{"id": "+"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topic, err := compileTopic("rule", tt.topic)
+			if err != nil {
+				t.Fatalf("compileTopic() error = %v", err)
+			}
+			data, err := decodeInput([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("decodeInput() error = %v", err)
+			}
+
+			got, err := topic.render(data, &Request{Params: tt.params})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompiledPropertiesAllowSeparators(t *testing.T) {
+	tmpl, err := compilePropertyTemplate("rule/correlationData", "{{.path}}")
+	if err != nil {
+		t.Fatalf("compilePropertyTemplate() error = %v", err)
+	}
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{"path": "a/b"}`), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tmpl.execute(data, nil)
+	if err != nil {
+		t.Fatalf("execute() error = %v", err)
+	}
+	if got != "a/b" {
+		t.Errorf("execute() = %q, want %q", got, "a/b")
+	}
+}
@@ -5,42 +5,142 @@ package transformer
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/itchyny/gojq"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 	"go.uber.org/zap"
 
 	"message-transformer/internal/config"
 	"message-transformer/internal/metrics"
+	"message-transformer/internal/mqtt"
+	"message-transformer/internal/validator"
 )
 
 // Transformer handles message transformations with pre-compiled templates
 type Transformer struct {
-	logger    *zap.Logger
-	metrics   metrics.Recorder
-	templates sync.Map // thread-safe map for template access
+	logger  *zap.Logger
+	metrics metrics.Recorder
+	rules   atomic.Pointer[Rules] // active rule set, replaced as a whole
+}
+
+// Rules is a compiled rule set. It is not changed once compiled, so that
+// the transforms of a rule always match the rule they were compiled from.
+type Rules struct {
+	t     *Transformer
+	rules map[string]*compiledRule
+}
+
+// engine produces one or more JSON outputs from decoded input data and the
+// request it was received with, which may be nil
+type engine interface {
+	apply(data interface{}, req *Request) ([][]byte, error)
+}
+
+// CompiledTransform wraps a pre-compiled transform engine with metadata
+type CompiledTransform struct {
+	ID     string
+	Target config.Target
+	engine engine
+	topic  *compiledTopic
+	props  *compiledProperties
+	output *jsonschema.Schema
+}
+
+// Message is a transformed payload and where it is published to
+type Message struct {
+	Topic   string
+	QoS     int
+	Retain  bool
+	Payload []byte
+	// Properties are the MQTT v5 properties of targets that set them
+	Properties *mqtt.Properties
+	// Sink names the output the message is published to, empty for the
+	// MQTT broker
+	Sink string
+}
+
+// MQTT returns the message for publishing to the broker
+func (m Message) MQTT() mqtt.Message {
+	return mqtt.Message{
+		Topic:      m.Topic,
+		QoS:        m.QoS,
+		Retain:     m.Retain,
+		Payload:    m.Payload,
+		Properties: m.Properties,
+	}
+}
+
+// TargetResult is the outcome of transforming the input for one target
+type TargetResult struct {
+	Target   config.Target
+	Messages []Message
+	Err      error
+}
+
+// Result is the outcome of transforming the input of a rule
+type Result struct {
+	// Route names the matched route of routed rules
+	Route string
+	// Dropped is set when the matched route discards the message
+	Dropped bool
+	// Filtered is set when the message fails the rule's filter
+	Filtered bool
+	Targets  []TargetResult
+}
+
+// compiledRule holds the compiled transforms of a rule's targets, or its
+// routes for routed rules, its filter and its reply transform
+type compiledRule struct {
+	// rule is the definition the transforms were compiled from
+	rule    config.Rule
+	filter  *gojq.Code
+	targets []*CompiledTransform
+	routes  []*compiledRoute
+	reply   engine
+	// metadata is the rule's entry in the request context of rules that
+	// use it, nil otherwise
+	metadata map[string]interface{}
 }
 
 // CompiledTemplate wraps a pre-compiled template with metadata
 type CompiledTemplate struct {
 	Template *template.Template
 	ID       string
+	// request is whether the template was rewritten by bindRequest
+	request bool
 }
 
 // TransformError wraps transformation errors with context
 type TransformError struct {
 	Message string
 	Err     error
+	// Line and Column locate the error in the template (or in the template
+	// output for invalid JSON) when known; zero otherwise
+	Line   int
+	Column int
 }
 
 func (e *TransformError) Error() string {
 	return fmt.Sprintf("%s: %v", e.Message, e.Err)
 }
 
+func (e *TransformError) Unwrap() error {
+	return e.Err
+}
+
+// errOutputSchema is the TransformError message for outputs that do not
+// match the rule's output schema
+const errOutputSchema = "output does not match schema"
+
 // New creates a new transformer with pre-compiled templates
 func New(logger *zap.Logger, rules []config.Rule, metricsRecorder metrics.Recorder) (*Transformer, error) {
 	if metricsRecorder == nil {
@@ -53,39 +153,230 @@ func New(logger *zap.Logger, rules []config.Rule, metricsRecorder metrics.Record
 	}
 
 	// Pre-compile all templates at startup
+	compiled, err := t.Compile(rules)
+	if err != nil {
+		return nil, err
+	}
+	t.Swap(compiled)
+
+	return t, nil
+}
+
+// Compile compiles the transforms of a rule set without activating it.
+// Rules defined as in the active set reuse its compiled transforms.
+func (t *Transformer) Compile(rules []config.Rule) (*Rules, error) {
+	active := t.Rules()
+	compiled := &Rules{t: t, rules: make(map[string]*compiledRule, len(rules))}
 	for _, rule := range rules {
-		if err := t.compileTemplate(rule.ID, rule.Transform.Template); err != nil {
+		if old, ok := active.lookup(rule.ID); ok && old.rule.SameDefinition(&rule) {
+			compiled.rules[rule.ID] = old
+			continue
+		}
+
+		c, err := compileRule(rule)
+		if err != nil {
+			t.metrics.IncTransforms(rule.ID, false)
 			return nil, fmt.Errorf("failed to compile template for rule %s: %w", rule.ID, err)
 		}
+		compiled.rules[rule.ID] = c
 	}
+	return compiled, nil
+}
+
+// Swap makes a compiled rule set the active one
+func (t *Transformer) Swap(rules *Rules) {
+	t.rules.Store(rules)
+	t.metrics.SetActiveRules(len(rules.rules))
+}
 
-	// Set initial active rules count
-	t.metrics.SetActiveRules(len(rules))
+// Rules returns the active rule set
+func (t *Transformer) Rules() *Rules {
+	return t.rules.Load()
+}
 
-	return t, nil
+// lookup returns the compiled transforms of a rule
+func (r *Rules) lookup(ruleID string) (*compiledRule, bool) {
+	if r == nil {
+		return nil, false
+	}
+	compiled, ok := r.rules[ruleID]
+	return compiled, ok
+}
+
+// compileRule compiles the transform of every target of a rule, in order,
+// or the conditions and targets of its routes
+func compileRule(rule config.Rule) (*compiledRule, error) {
+	compiled := &compiledRule{rule: rule}
+	if rule.API.RequestContext {
+		compiled.metadata = ruleMetadata(rule)
+	}
+	if rule.Filter != "" {
+		code, err := config.CompileExpression(rule.Filter)
+		if err != nil {
+			return nil, &TransformError{
+				Message: "failed to parse filter",
+				Err:     err,
+			}
+		}
+		compiled.filter = code
+	}
+
+	if rule.Reply != nil && rule.Reply.Transform != nil {
+		eng, err := compileEngine(rule.ID+"/reply", *rule.Reply.Transform)
+		if err != nil {
+			return nil, fmt.Errorf("reply: %w", err)
+		}
+		compiled.reply = eng
+	}
+
+	if len(rule.Routes) > 0 {
+		routes, err := compileRoutes(rule)
+		if err != nil {
+			return nil, err
+		}
+		compiled.routes = routes
+		return compiled, nil
+	}
+
+	targets := rule.PublishTargets()
+	compiled.targets = make([]*CompiledTransform, len(targets))
+	for i, target := range targets {
+		id := rule.ID
+		if target.Name != "" {
+			id = rule.ID + "/" + target.Name
+		}
+		c, err := compile(id, target)
+		if err != nil {
+			if target.Name != "" {
+				return nil, fmt.Errorf("target %s: %w", target.Name, err)
+			}
+			return nil, err
+		}
+		compiled.targets[i] = c
+	}
+	return compiled, nil
+}
+
+// compile builds the engine selected by the target's transform configuration
+func compile(id string, target config.Target) (*CompiledTransform, error) {
+	eng, err := compileEngine(id, *target.Transform)
+	if err != nil {
+		return nil, err
+	}
+
+	topic, err := compileTopic(id, target.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := compileProperties(id, target.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CompiledTransform{
+		ID:     id,
+		Target: target,
+		engine: eng,
+		topic:  topic,
+		props:  props,
+		output: target.Schema.Compiled(),
+	}, nil
+}
+
+// compileEngine builds the engine selected by a transform configuration
+func compileEngine(id string, transform config.Transform) (engine, error) {
+	switch transform.EngineType() {
+	case config.TransformMapping:
+		return compileMapping(transform.Mapping)
+	case config.TransformJQ:
+		return compileJQ(transform)
+	default:
+		return compileTemplate(id, transform)
+	}
 }
 
-// compileTemplate compiles a template and stores it in the sync.Map
-func (t *Transformer) compileTemplate(id, templateStr string) error {
+// compileTemplate parses a template with the common template functions,
+// applying JSON string escaping if the transform requests it
+func compileTemplate(id string, transform config.Transform) (*CompiledTemplate, error) {
 	tmpl, err := template.New(id).
 		Funcs(templateFuncs()).
-		Parse(templateStr)
+		Parse(transform.Template)
 	if err != nil {
-		t.metrics.IncTransforms(id, false)
-		return fmt.Errorf("failed to parse template: %w", err)
+		line, column, msg := templateErrorPosition(id, err)
+		return nil, &TransformError{
+			Message: "failed to parse template",
+			Err:     errors.New(msg),
+			Line:    line,
+			Column:  column,
+		}
+	}
+
+	if transform.Escape == config.EscapeJSON {
+		if err := config.EscapeJSONStrings(tmpl); err != nil {
+			return nil, &TransformError{
+				Message: "failed to escape template",
+				Err:     err,
+			}
+		}
 	}
 
-	t.templates.Store(id, &CompiledTemplate{
+	request := bindRequest(tmpl)
+
+	return &CompiledTemplate{
 		Template: tmpl,
 		ID:       id,
-	})
-	return nil
+		request:  request,
+	}, nil
 }
 
-// Transform applies a pre-compiled template transformation to the input data
+// Transform applies a pre-compiled transformation to the input data and
+// returns the message produced for the rule's first target. It fails if that
+// target produces anything other than a single message.
 func (t *Transformer) Transform(ruleID string, inputData []byte) ([]byte, error) {
-	// Get pre-compiled template
-	tmplValue, exists := t.templates.Load(ruleID)
+	result, err := t.TransformRule(ruleID, inputData)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []Message
+	if len(result.Targets) > 0 {
+		if err := result.Targets[0].Err; err != nil {
+			return nil, err
+		}
+		outputs = result.Targets[0].Messages
+	}
+	if len(outputs) != 1 {
+		return nil, &TransformError{
+			Message: "transform must produce exactly one result",
+			Err:     fmt.Errorf("transform produced %d results", len(outputs)),
+		}
+	}
+	return outputs[0].Payload, nil
+}
+
+// TransformRule applies the pre-compiled transform of every target of a rule
+// to the input data, or of the target of the matching route for routed
+// rules. A target that fails to transform records its error in its result
+// without affecting the others.
+func (t *Transformer) TransformRule(ruleID string, inputData []byte) (*Result, error) {
+	return t.TransformRequest(ruleID, inputData, nil)
+}
+
+// TransformRequest is TransformRule for input received over HTTP, making the
+// request headers available to property templates and the request context
+// to rules that use it. The request may be nil.
+func (t *Transformer) TransformRequest(ruleID string, inputData []byte, req *Request) (*Result, error) {
+	return t.Rules().TransformRequest(ruleID, inputData, req)
+}
+
+// TransformRequest is Transformer.TransformRequest using the rule set's
+// transforms
+func (r *Rules) TransformRequest(ruleID string, inputData []byte, req *Request) (*Result, error) {
+	t := r.t
+
+	// Get pre-compiled transforms
+	compiled, exists := r.lookup(ruleID)
 	if !exists {
 		t.metrics.IncTransforms(ruleID, false)
 		return nil, &TransformError{
@@ -93,86 +384,306 @@ func (t *Transformer) Transform(ruleID string, inputData []byte) ([]byte, error)
 			Err:     fmt.Errorf("no template for rule %s", ruleID),
 		}
 	}
-	compiledTmpl := tmplValue.(*CompiledTemplate)
 
-	// Parse input data using a decoder for precise number handling
-	var data map[string]interface{}
+	result, err := compiled.run(inputData, req)
+	if err != nil {
+		t.metrics.IncTransforms(ruleID, false)
+		return nil, err
+	}
+	if result.Filtered {
+		t.metrics.IncTransformsStatus(ruleID, metrics.StatusFiltered)
+		t.logger.Debug("Message filtered",
+			zap.String("rule_id", ruleID))
+		return result, nil
+	}
+	if result.Dropped {
+		t.metrics.IncTransformsStatus(ruleID, metrics.StatusDropped)
+		t.logger.Debug("Message dropped by route",
+			zap.String("rule_id", ruleID),
+			zap.String("route", result.Route))
+		return result, nil
+	}
+
+	for _, target := range result.Targets {
+		if err := target.Err; err != nil {
+			var transformErr *TransformError
+			if errors.As(err, &transformErr) && transformErr.Message == errOutputSchema {
+				t.metrics.IncTransformsStatus(ruleID, metrics.StatusSchemaError)
+			} else {
+				t.metrics.IncTransforms(ruleID, false)
+			}
+			continue
+		}
+
+		// Record successful transformation
+		t.metrics.IncTransforms(ruleID, true)
+
+		t.logger.Debug("Message transformed successfully",
+			zap.String("rule_id", ruleID),
+			zap.String("target", target.Target.Name),
+			zap.Int("input_size", len(inputData)),
+			zap.Int("outputs", len(target.Messages)))
+	}
+
+	return result, nil
+}
+
+// TransformReply applies a rule's reply transform to a reply payload. Rules
+// without a reply transform return the payload unchanged.
+func (t *Transformer) TransformReply(ruleID string, payload []byte) ([]byte, error) {
+	return t.Rules().TransformReply(ruleID, payload)
+}
+
+// TransformReply is Transformer.TransformReply using the rule set's
+// transforms
+func (r *Rules) TransformReply(ruleID string, payload []byte) ([]byte, error) {
+	compiled, exists := r.lookup(ruleID)
+	if !exists {
+		return nil, &TransformError{
+			Message: "template not found",
+			Err:     fmt.Errorf("no template for rule %s", ruleID),
+		}
+	}
+	if compiled.reply == nil {
+		return payload, nil
+	}
+
+	data, err := decodeInput(payload)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := compiled.reply.apply(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) != 1 {
+		return nil, &TransformError{
+			Message: "transform must produce exactly one result",
+			Err:     fmt.Errorf("reply transform produced %d results", len(outputs)),
+		}
+	}
+	return outputs[0], nil
+}
+
+// Preview compiles the rule's transforms and applies them to the input data
+// without storing the templates or recording metrics. Rules using the request
+// context see empty request details.
+func (t *Transformer) Preview(rule config.Rule, inputData []byte) (*Result, error) {
+	compiled, err := compileRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.run(inputData, nil)
+}
+
+// run checks the input data against the rule's filter and transforms it for
+// the rule's targets, or for the target of the first matching route
+func (c *compiledRule) run(inputData []byte, req *Request) (*Result, error) {
+	targets := c.targets
+	result := &Result{}
+	if c.filter == nil && len(c.routes) == 0 {
+		return c.transform(result, targets, inputData, req), nil
+	}
+
+	// The filter and route conditions share one decoded input; jq runs on a
+	// copy of it
+	data, err := c.input(inputData, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.filter != nil {
+		pass, err := evaluateCondition(c.filter, data)
+		if err != nil {
+			return nil, &TransformError{
+				Message: "failed to evaluate filter",
+				Err:     err,
+			}
+		}
+		if !pass {
+			result.Filtered = true
+			return result, nil
+		}
+	}
+
+	if len(c.routes) > 0 {
+		route, err := matchRoute(c.routes, data)
+		if err != nil {
+			return nil, err
+		}
+		result.Route = route.name
+		if route.drop {
+			result.Dropped = true
+			return result, nil
+		}
+		targets = []*CompiledTransform{route.target}
+	}
+
+	return c.transform(result, targets, inputData, req), nil
+}
+
+// transform runs each target's transform on its own copy of the input and
+// records the results
+func (c *compiledRule) transform(result *Result, targets []*CompiledTransform, inputData []byte, req *Request) *Result {
+	result.Targets = make([]TargetResult, len(targets))
+	for i, target := range targets {
+		data, err := c.input(inputData, req)
+		var messages []Message
+		if err == nil {
+			messages, err = execute(target, data, req)
+		}
+		result.Targets[i] = TargetResult{Target: target.Target, Messages: messages, Err: err}
+	}
+	return result
+}
+
+// input decodes the input data, wrapping it in the request context for
+// rules that use it
+func (c *compiledRule) input(inputData []byte, req *Request) (interface{}, error) {
+	data, err := decodeInput(inputData)
+	if err != nil || c.metadata == nil {
+		return data, err
+	}
+	return requestContext(req, c.metadata, data), nil
+}
+
+// decodeInput parses input data using a decoder for precise number handling.
+// The input may be any JSON value: objects decode to maps, so templates read
+// their fields as .field, while arrays and scalars are available as . itself.
+func decodeInput(inputData []byte) (interface{}, error) {
+	var data interface{}
 	decoder := json.NewDecoder(bytes.NewReader(inputData))
 	decoder.UseNumber()
 	if err := decoder.Decode(&data); err != nil {
-		t.metrics.IncTransforms(ruleID, false)
 		return nil, &TransformError{
 			Message: "failed to parse input data",
 			Err:     err,
 		}
 	}
+	return data, nil
+}
+
+// execute runs a compiled transform against the decoded input data and
+// renders the target topic and properties
+func execute(compiled *CompiledTransform, data interface{}, req *Request) ([]Message, error) {
+	topic, err := compiled.topic.render(data, req)
+	if err != nil {
+		return nil, err
+	}
+
+	props, err := compiled.props.render(data, req)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := compiled.engine.apply(data, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check every output against the rule's output schema
+	if compiled.output != nil {
+		for _, output := range outputs {
+			if err := validator.ValidateSchema(output, compiled.output); err != nil {
+				return nil, &TransformError{
+					Message: errOutputSchema,
+					Err:     err,
+				}
+			}
+		}
+	}
 
+	messages := make([]Message, len(outputs))
+	for i, output := range outputs {
+		messages[i] = Message{
+			Topic:      topic,
+			QoS:        compiled.Target.QoS,
+			Retain:     compiled.Target.Retain,
+			Payload:    output,
+			Properties: props,
+			Sink:       compiled.Target.Sink,
+		}
+	}
+	return messages, nil
+}
+
+// apply executes the template and checks that the output is valid JSON
+func (compiledTmpl *CompiledTemplate) apply(data interface{}, req *Request) ([][]byte, error) {
 	// Execute template with buffer pool for efficiency
 	buf := bufPool.Get().(*bytes.Buffer)
 	buf.Reset()
 	defer bufPool.Put(buf)
 
-	if err := compiledTmpl.Template.Execute(buf, data); err != nil {
-		t.metrics.IncTransforms(ruleID, false)
+	if err := compiledTmpl.Template.Execute(buf, templateData(compiledTmpl.request, data, req)); err != nil {
+		line, column, msg := templateErrorPosition(compiledTmpl.ID, err)
 		return nil, &TransformError{
 			Message: "failed to execute template",
-			Err:     err,
+			Err:     errors.New(msg),
+			Line:    line,
+			Column:  column,
 		}
 	}
 
 	// Validate output is valid JSON
 	output := buf.Bytes()
-	if !json.Valid(output) {
-		t.metrics.IncTransforms(ruleID, false)
+	var syntaxErr *json.SyntaxError
+	if err := json.Unmarshal(output, new(json.RawMessage)); errors.As(err, &syntaxErr) {
+		line, column := offsetPosition(output, syntaxErr.Offset)
+		return nil, &TransformError{
+			Message: "template output is not valid JSON",
+			Err:     fmt.Errorf("invalid JSON output for rule %s: %w", compiledTmpl.ID, err),
+			Line:    line,
+			Column:  column,
+		}
+	} else if err != nil {
 		return nil, &TransformError{
 			Message: "template output is not valid JSON",
-			Err:     fmt.Errorf("invalid JSON output for rule %s", ruleID),
+			Err:     fmt.Errorf("invalid JSON output for rule %s: %w", compiledTmpl.ID, err),
 		}
 	}
 
 	// Create a copy of the output since we're returning the buffer to the pool
 	result := make([]byte, len(output))
 	copy(result, output)
-
-	// Record successful transformation
-	t.metrics.IncTransforms(ruleID, true)
-
-	t.logger.Debug("Message transformed successfully",
-		zap.String("rule_id", ruleID),
-		zap.Int("input_size", len(inputData)),
-		zap.Int("output_size", len(result)))
-
-	return result, nil
+	return [][]byte{result}, nil
 }
 
-// AddTemplate adds a new template at runtime
-func (t *Transformer) AddTemplate(id, templateStr string) error {
-	if err := t.compileTemplate(id, templateStr); err != nil {
-		return err
-	}
-
-	// Update active rules count
-	count := 0
-	t.templates.Range(func(key, value interface{}) bool {
-		count++
-		return true
-	})
-	t.metrics.SetActiveRules(count)
+// templateErrorRegex matches the "template: name:line:col: msg" prefix used
+// by text/template parse and execution errors
+var templateErrorRegex = regexp.MustCompile(`^template: (.*?):(\d+):(?:(\d+):)? (.*)$`)
 
-	return nil
+// templateErrorPosition extracts the line and column from a template error,
+// returning the remaining message without the position prefix
+func templateErrorPosition(name string, err error) (line, column int, msg string) {
+	msg = err.Error()
+	m := templateErrorRegex.FindStringSubmatch(msg)
+	if m == nil || m[1] != name {
+		return 0, 0, msg
+	}
+	line, _ = strconv.Atoi(m[2])
+	column, _ = strconv.Atoi(m[3])
+	return line, column, m[4]
 }
 
-// RemoveTemplate removes a template
-func (t *Transformer) RemoveTemplate(id string) {
-	t.templates.Delete(id)
-
-	// Update active rules count
-	count := 0
-	t.templates.Range(func(key, value interface{}) bool {
-		count++
-		return true
-	})
-	t.metrics.SetActiveRules(count)
+// offsetPosition converts a json.SyntaxError offset (bytes read up to and
+// including the offending byte) into a 1-based line and column
+func offsetPosition(data []byte, offset int64) (line, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data)) + 1
+	}
+	if offset > 0 {
+		offset--
+	}
+	line, column = 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return line, column
 }
 
 // Buffer pool for template execution
@@ -202,6 +713,13 @@ func templateFuncs() template.FuncMap {
 		"now": func() string {
 			return time.Now().UTC().Format(time.RFC3339)
 		},
+		"jsonString": jsonString,
+		// param is rewritten by bindRequest to read the request's URL
+		// parameters
+		config.ParamFuncName: func(name string) string {
+			return ""
+		},
+		config.EscapeFuncName: jsonEscape,
 		"uuid7": func() string {
 			id, err := uuid.NewV7()
 			if err != nil {
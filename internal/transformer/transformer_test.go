@@ -0,0 +1,440 @@
+//file: internal/transformer/transformer_test.go
+
+package transformer
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/metrics"
+)
+
+// transformCounter records the transform metrics of a transformer
+type transformCounter struct {
+	metrics.NoOpRecorder
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// IncTransforms counts transforms as "success" or "failure"
+func (c *transformCounter) IncTransforms(ruleID string, success bool) {
+	status := "failure"
+	if success {
+		status = "success"
+	}
+	c.IncTransformsStatus(ruleID, status)
+}
+
+// IncTransformsStatus counts transforms by status
+func (c *transformCounter) IncTransformsStatus(ruleID, status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[status]++
+}
+
+// newTestTransformer creates a transformer for the rules, given as JSON,
+// and the counter recording its transform metrics
+func newTestTransformer(t *testing.T, rules ...string) (*Transformer, *transformCounter) {
+	t.Helper()
+
+	var parsed []config.Rule
+	for _, data := range rules {
+		rule, err := config.ParseRule([]byte(data), t.TempDir())
+		if err != nil {
+			t.Fatalf("ParseRule() error = %v", err)
+		}
+		parsed = append(parsed, rule)
+	}
+
+	counter := &transformCounter{}
+	tr, err := New(zap.NewNop(), parsed, counter)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	counter.counts = nil
+	return tr, counter
+}
+
+// targetOutput is the topic and payloads of a target's messages, or its
+// error
+type targetOutput struct {
+	name     string
+	topic    string
+	payloads []string
+	err      bool
+}
+
+// targetOutputs summarizes the target results of a transform
+func targetOutputs(result *Result) []targetOutput {
+	var outputs []targetOutput
+	for _, target := range result.Targets {
+		output := targetOutput{name: target.Target.Name, err: target.Err != nil}
+		for _, msg := range target.Messages {
+			output.topic = msg.Topic
+			output.payloads = append(output.payloads, string(msg.Payload))
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs
+}
+
+func TestTransformRuleTargets(t *testing.T) {
+	tr, counter := newTestTransformer(t, `{
+		"id": "status",
+		"api": {"method": "POST", "path": "/status"},
+		"transform": {"template": "{\"id\": {{jsonString .id}}, \"battery\": {{.battery}}}"},
+		"targets": [
+			{"name": "full", "topic": "devices/{{.id}}/status"},
+			{
+				"name": "alert",
+				"topic": "alerts/battery",
+				"qos": 1,
+				"transform": {"type": "mapping", "mapping": {"device": "$.id", "level": {"path": "$.battery", "type": "number"}}}
+			},
+			{
+				"name": "readings",
+				"topic": "devices/{{.id}}/readings",
+				"transform": {"type": "jq", "expression": ".readings[] | {v: .}", "multiple": "fanout"}
+			}
+		]
+	}`)
+
+	tests := []struct {
+		name  string
+		input string
+		want  []targetOutput
+		// wantCounts are the transform metrics recorded for the input
+		wantCounts map[string]int
+	}{
+		{
+			name:  "every target",
+			input: `{"id": "d1", "battery": 15, "readings": [1, 2]}`,
+			want: []targetOutput{
+				{name: "full", topic: "devices/d1/status", payloads: []string{`{"id": "d1", "battery": 15}`}},
+				{name: "alert", topic: "alerts/battery", payloads: []string{`{"device":"d1","level":15}`}},
+				{name: "readings", topic: "devices/d1/readings", payloads: []string{`{"v":1}`, `{"v":2}`}},
+			},
+			wantCounts: map[string]int{"success": 3},
+		},
+		{
+			name:  "failing target leaves the others",
+			input: `{"id": "d1", "battery": 15, "readings": 3}`,
+			want: []targetOutput{
+				{name: "full", topic: "devices/d1/status", payloads: []string{`{"id": "d1", "battery": 15}`}},
+				{name: "alert", topic: "alerts/battery", payloads: []string{`{"device":"d1","level":15}`}},
+				{name: "readings", err: true},
+			},
+			wantCounts: map[string]int{"success": 2, "failure": 1},
+		},
+		{
+			name:  "failing topic",
+			input: `{"battery": 15, "readings": []}`,
+			want: []targetOutput{
+				{name: "full", err: true},
+				{name: "alert", topic: "alerts/battery", payloads: []string{`{"device":null,"level":15}`}},
+				{name: "readings", err: true},
+			},
+			wantCounts: map[string]int{"success": 1, "failure": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter.counts = nil
+			result, err := tr.TransformRule("status", []byte(tt.input))
+			if err != nil {
+				t.Fatalf("TransformRule() error = %v", err)
+			}
+			if got := targetOutputs(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("targets = %+v, want %+v", got, tt.want)
+			}
+			for _, msg := range result.Targets[1].Messages {
+				if msg.QoS != 1 {
+					t.Errorf("alert QoS = %d, want 1", msg.QoS)
+				}
+			}
+			if !reflect.DeepEqual(counter.counts, tt.wantCounts) {
+				t.Errorf("transform metrics = %v, want %v", counter.counts, tt.wantCounts)
+			}
+		})
+	}
+}
+
+func TestTransformRuleErrors(t *testing.T) {
+	tr, counter := newTestTransformer(t, `{
+		"id": "status",
+		"api": {"method": "POST", "path": "/status"},
+		"transform": {"template": "{{toJSON .}}"},
+		"target": {"topic": "out"}
+	}`)
+
+	tests := []struct {
+		name        string
+		ruleID      string
+		input       string
+		wantMessage string
+		// wantTargetErr is whether the error is reported on the target
+		// rather than for the rule
+		wantTargetErr bool
+	}{
+		{name: "unknown rule", ruleID: "missing", input: `{}`, wantMessage: "template not found"},
+		{name: "invalid input", ruleID: "status", input: `{"id":`, wantMessage: "failed to parse input data", wantTargetErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter.counts = nil
+			result, err := tr.TransformRule(tt.ruleID, []byte(tt.input))
+			if tt.wantTargetErr {
+				if err != nil || len(result.Targets) != 1 {
+					t.Fatalf("TransformRule() = %+v, %v, want one target result", result, err)
+				}
+				err = result.Targets[0].Err
+			}
+			if te, ok := err.(*TransformError); !ok || te.Message != tt.wantMessage {
+				t.Errorf("error = %v, want %q", err, tt.wantMessage)
+			}
+			if counter.counts["failure"] != 1 {
+				t.Errorf("transform metrics = %v, want one failure", counter.counts)
+			}
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tr, _ := newTestTransformer(t,
+		`{
+			"id": "single",
+			"api": {"method": "POST", "path": "/single"},
+			"transform": {"template": "{\"v\": {{.v}}}"},
+			"target": {"topic": "out"}
+		}`,
+		`{
+			"id": "targets",
+			"api": {"method": "POST", "path": "/targets"},
+			"transform": {"template": "{\"v\": {{.v}}}"},
+			"targets": [
+				{"name": "first", "topic": "first", "transform": {"type": "jq", "expression": "{first: .v}"}},
+				{"name": "second", "topic": "second"}
+			]
+		}`,
+		`{
+			"id": "fanout",
+			"api": {"method": "POST", "path": "/fanout"},
+			"transform": {"type": "jq", "expression": ".items[]", "multiple": "fanout"},
+			"target": {"topic": "out"}
+		}`,
+	)
+
+	tests := []struct {
+		name    string
+		ruleID  string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "single target", ruleID: "single", input: `{"v": 1}`, want: `{"v": 1}`},
+		{name: "first of several targets", ruleID: "targets", input: `{"v": 1}`, want: `{"first":1}`},
+		{name: "target error", ruleID: "single", input: `{"v": 1`, wantErr: true},
+		{name: "one fanned out result", ruleID: "fanout", input: `{"items": [1]}`, want: `1`},
+		{name: "several fanned out results", ruleID: "fanout", input: `{"items": [1, 2]}`, wantErr: true},
+		{name: "no fanned out results", ruleID: "fanout", input: `{"items": []}`, wantErr: true},
+		{name: "unknown rule", ruleID: "missing", input: `{}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tr.Transform(tt.ruleID, []byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Transform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Transform() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformRuleFilter(t *testing.T) {
+	tr, counter := newTestTransformer(t,
+		`{
+			"id": "events",
+			"api": {"method": "POST", "path": "/events"},
+			"filter": ".type != \"heartbeat\" and .value",
+			"transform": {"template": "{\"v\": {{.value}}}"},
+			"target": {"topic": "events"}
+		}`,
+		`{
+			"id": "routed",
+			"api": {"method": "POST", "path": "/routed"},
+			"filter": ".value > 0",
+			"transform": {"template": "{\"v\": {{.value}}}"},
+			"routes": [
+				{"name": "high", "condition": ".value > 10", "topic": "events/high"},
+				{"name": "low", "topic": "events/low"}
+			]
+		}`,
+	)
+
+	tests := []struct {
+		name         string
+		ruleID       string
+		input        string
+		wantFiltered bool
+		want         []targetOutput
+		wantErr      bool
+		wantCounts   map[string]int
+	}{
+		{
+			name:       "passes",
+			ruleID:     "events",
+			input:      `{"type": "reading", "value": 1}`,
+			want:       []targetOutput{{topic: "events", payloads: []string{`{"v": 1}`}}},
+			wantCounts: map[string]int{"success": 1},
+		},
+		{
+			name:         "false",
+			ruleID:       "events",
+			input:        `{"type": "heartbeat", "value": 1}`,
+			wantFiltered: true,
+			wantCounts:   map[string]int{"filtered": 1},
+		},
+		{
+			name:         "null",
+			ruleID:       "events",
+			input:        `{"type": "reading"}`,
+			wantFiltered: true,
+			wantCounts:   map[string]int{"filtered": 1},
+		},
+		{
+			name:       "before routes",
+			ruleID:     "routed",
+			input:      `{"value": 20}`,
+			want:       []targetOutput{{name: "high", topic: "events/high", payloads: []string{`{"v": 20}`}}},
+			wantCounts: map[string]int{"success": 1},
+		},
+		{
+			name:         "filtered before routes",
+			ruleID:       "routed",
+			input:        `{"value": 0}`,
+			wantFiltered: true,
+			wantCounts:   map[string]int{"filtered": 1},
+		},
+		{
+			name:       "error",
+			ruleID:     "events",
+			input:      `[1]`,
+			wantErr:    true,
+			wantCounts: map[string]int{"failure": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter.counts = nil
+			result, err := tr.TransformRule(tt.ruleID, []byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TransformRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if result.Filtered != tt.wantFiltered {
+					t.Errorf("filtered = %v, want %v", result.Filtered, tt.wantFiltered)
+				}
+				if got := targetOutputs(result); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("targets = %+v, want %+v", got, tt.want)
+				}
+			}
+			if !reflect.DeepEqual(counter.counts, tt.wantCounts) {
+				t.Errorf("transform metrics = %v, want %v", counter.counts, tt.wantCounts)
+			}
+		})
+	}
+}
+
+func TestDecodeInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "object", input: `{"a": 1}`, want: map[string]interface{}{"a": json.Number("1")}},
+		{name: "array", input: `[1, "x", null]`, want: []interface{}{json.Number("1"), "x", nil}},
+		{name: "string", input: `"text"`, want: "text"},
+		{name: "number keeps its text", input: `12345678901234567890.10`, want: json.Number("12345678901234567890.10")},
+		{name: "bool", input: `true`, want: true},
+		{name: "null", input: `null`, want: nil},
+		{name: "surrounding whitespace", input: " \n[]\n", want: []interface{}{}},
+		{name: "empty", input: ``, wantErr: true},
+		{name: "invalid", input: `{"a":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeInput([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeInput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeInput() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransformNonObjectInput(t *testing.T) {
+	tr, _ := newTestTransformer(t,
+		`{
+			"id": "list",
+			"api": {"method": "POST", "path": "/list"},
+			"transform": {"template": "{\"count\": {{len .}}, \"first\": {{index . 0}}, \"all\": [{{range $i, $v := .}}{{if $i}},{{end}}{{$v}}{{end}}]}"},
+			"target": {"topic": "out"}
+		}`,
+		`{
+			"id": "text",
+			"api": {"method": "POST", "path": "/text"},
+			"transform": {"template": "{\"text\": {{jsonString .}}}"},
+			"target": {"topic": "out"}
+		}`,
+		`{
+			"id": "object",
+			"api": {"method": "POST", "path": "/object"},
+			"transform": {"template": "{\"v\": {{.v}}}"},
+			"target": {"topic": "out"}
+		}`,
+	)
+
+	tests := []struct {
+		name    string
+		ruleID  string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "array", ruleID: "list", input: `[3, 1.50, 2]`, want: `{"count": 3, "first": 3, "all": [3,1.50,2]}`},
+		{name: "string", ruleID: "text", input: `"say \"hi\""`, want: `{"text": "say \"hi\""}`},
+		{name: "number as text", ruleID: "text", input: `42`, want: `{"text": "42"}`},
+		{name: "object", ruleID: "object", input: `{"v": 1}`, want: `{"v": 1}`},
+		{name: "field of array", ruleID: "object", input: `[1]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tr.Transform(tt.ruleID, []byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Transform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Transform() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
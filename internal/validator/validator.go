@@ -3,11 +3,14 @@
 package validator
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
-	"text/template"
 
+	"github.com/santhosh-tekuri/jsonschema/v5"
 	"go.uber.org/zap"
 
 	"message-transformer/internal/config"
@@ -17,11 +20,34 @@ import (
 var (
 	ErrInvalidMQTTTopic   = fmt.Errorf("invalid MQTT topic format")
 	ErrInvalidHTTPMethod  = fmt.Errorf("invalid HTTP method")
-	ErrInvalidTemplate    = fmt.Errorf("invalid template syntax")
 	ErrInvalidJSONSchema  = fmt.Errorf("invalid JSON schema")
 	ErrEmptyConfiguration = fmt.Errorf("empty configuration")
 )
 
+// SchemaViolation describes a single place where a payload breaks its schema
+type SchemaViolation struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// SchemaError lists every schema violation found in a payload
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = fmt.Sprintf("%s: %s", v.Pointer, v.Message)
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidJSONSchema, strings.Join(msgs, "; "))
+}
+
+// Unwrap allows errors.Is(err, ErrInvalidJSONSchema)
+func (e *SchemaError) Unwrap() error {
+	return ErrInvalidJSONSchema
+}
+
 // Validator handles validation of rules and messages
 type Validator struct {
 	logger *zap.Logger
@@ -46,41 +72,6 @@ func New(logger *zap.Logger) *Validator {
 	}
 }
 
-// ValidateRule performs comprehensive validation of a rule configuration
-func (v *Validator) ValidateRule(rule config.Rule) error {
-	// Validate required fields
-	if rule.ID == "" {
-		return fmt.Errorf("rule ID is required")
-	}
-
-	// Validate HTTP method
-	if err := v.ValidateHTTPMethod(rule.API.Method); err != nil {
-		return fmt.Errorf("invalid HTTP method for rule %s: %w", rule.ID, err)
-	}
-
-	// Validate API path
-	if err := v.ValidateAPIPath(rule.API.Path); err != nil {
-		return fmt.Errorf("invalid API path for rule %s: %w", rule.ID, err)
-	}
-
-	// Validate transformation template
-	if err := v.ValidateTemplate(rule.Transform.Template); err != nil {
-		return fmt.Errorf("invalid template for rule %s: %w", rule.ID, err)
-	}
-
-	// Validate MQTT topic
-	if err := v.ValidateMQTTTopic(rule.Target.Topic); err != nil {
-		return fmt.Errorf("invalid MQTT topic for rule %s: %w", rule.ID, err)
-	}
-
-	// Validate QoS level
-	if err := v.ValidateQoS(rule.Target.QoS); err != nil {
-		return fmt.Errorf("invalid QoS for rule %s: %w", rule.ID, err)
-	}
-
-	return nil
-}
-
 // ValidateHTTPMethod validates the HTTP method
 func (v *Validator) ValidateHTTPMethod(method string) error {
 	if !v.validMethods[strings.ToUpper(method)] {
@@ -97,35 +88,20 @@ func (v *Validator) ValidateAPIPath(path string) error {
 	return nil
 }
 
-// ValidateTemplate validates the transformation template syntax
-func (v *Validator) ValidateTemplate(templateStr string) error {
-	if templateStr == "" {
-		return fmt.Errorf("%w: template is empty", ErrInvalidTemplate)
-	}
-
-	// Create template with all supported functions for validation
-	tmpl := template.New("validator").Funcs(template.FuncMap{
-		"toJSON": func(v interface{}) string { return "" },
-		"fromJSON": func(s string) interface{} { return nil },
-		"now": func() string { return "" },
-		"uuid7": func() string { return "00000000-0000-7000-0000-000000000000" },
-		"num": func(v interface{}) string { return "0" },
-		"bool": func(v interface{}) string { return "false" },
-	})
-
-	if _, err := tmpl.Parse(templateStr); err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
-	}
-
-	return nil
-}
-
-// ValidateMQTTTopic validates the MQTT topic format
+// ValidateMQTTTopic validates the MQTT topic format, checking the static
+// parts of topic templates
 func (v *Validator) ValidateMQTTTopic(topic string) error {
 	if topic == "" {
 		return fmt.Errorf("%w: topic is empty", ErrInvalidMQTTTopic)
 	}
 
+	if config.IsTopicTemplate(topic) {
+		if err := config.ValidateTopicTemplate(topic); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMQTTTopic, err)
+		}
+		return nil
+	}
+
 	if !v.topicRegex.MatchString(topic) {
 		return fmt.Errorf("%w: topic contains invalid characters", ErrInvalidMQTTTopic)
 	}
@@ -141,10 +117,58 @@ func (v *Validator) ValidateQoS(qos int) error {
 	return nil
 }
 
-// ValidatePayload validates a message payload against a rule's requirements
+// ValidatePayload validates a message payload against a rule's requirements,
+// including the rule's input schema if it has one
 func (v *Validator) ValidatePayload(payload []byte, rule config.Rule) error {
 	if len(payload) == 0 {
 		return fmt.Errorf("empty payload")
 	}
-	return nil
+
+	if rule.Schema == nil {
+		return nil
+	}
+	return ValidateSchema(payload, rule.Schema.Input.Compiled())
+}
+
+// ValidateSchema checks a JSON document against a compiled schema, returning
+// a *SchemaError listing every violation if it does not match
+func ValidateSchema(payload []byte, schema *jsonschema.Schema) error {
+	if schema == nil {
+		return nil
+	}
+
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("invalid JSON payload: %w", err)
+	}
+
+	err := schema.Validate(doc)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return fmt.Errorf("%w: %v", ErrInvalidJSONSchema, err)
+	}
+
+	schemaErr := &SchemaError{}
+	collectViolations(validationErr, &schemaErr.Violations)
+	return schemaErr
+}
+
+// collectViolations flattens a validation error tree into its leaf errors
+func collectViolations(err *jsonschema.ValidationError, violations *[]SchemaViolation) {
+	if len(err.Causes) == 0 {
+		*violations = append(*violations, SchemaViolation{
+			Pointer: err.InstanceLocation,
+			Message: err.Message,
+		})
+		return
+	}
+	for _, cause := range err.Causes {
+		collectViolations(cause, violations)
+	}
 }
@@ -0,0 +1,130 @@
+//file: internal/webhook/webhook.go
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"message-transformer/internal/config"
+	"message-transformer/internal/metrics"
+)
+
+// maxResponseDrain bounds how much of a response body is read so the
+// connection can be reused
+const maxResponseDrain = 64 << 10
+
+// StatusError is returned when an endpoint answers with a status that is not
+// configured as a success
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook returned status %d", e.StatusCode)
+}
+
+// Client delivers transformed messages to HTTP endpoints
+type Client struct {
+	logger  *zap.Logger
+	http    *http.Client
+	metrics metrics.Recorder
+}
+
+// New creates a webhook client
+func New(logger *zap.Logger, metricsRecorder metrics.Recorder) *Client {
+	if metricsRecorder == nil {
+		metricsRecorder = metrics.NewNoOpRecorder()
+	}
+	return &Client{
+		logger:  logger,
+		http:    &http.Client{},
+		metrics: metricsRecorder,
+	}
+}
+
+// Deliver sends a payload to the webhook, retrying failed attempts with
+// exponential backoff. Client errors other than 408 and 429 are not retried
+// since repeating the request would not change the answer.
+func (c *Client) Deliver(ctx context.Context, ruleID string, hook *config.Webhook, payload []byte) error {
+	var err error
+	for attempt := 0; attempt <= hook.Retry.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := time.Duration(hook.Retry.Backoff(attempt)) * time.Second
+			c.logger.Warn("Retrying webhook delivery",
+				zap.Error(err),
+				zap.String("rule_id", ruleID),
+				zap.Int("retry", attempt),
+				zap.Duration("delay", delay))
+
+			select {
+			case <-ctx.Done():
+				c.metrics.IncWebhookDeliveries(ruleID, false)
+				return fmt.Errorf("webhook delivery cancelled: %w", ctx.Err())
+			case <-time.After(delay):
+			}
+		}
+
+		err = c.send(ctx, hook, payload)
+		if err == nil {
+			c.metrics.IncWebhookDeliveries(ruleID, true)
+			return nil
+		}
+		if !retryable(err) {
+			break
+		}
+	}
+
+	c.metrics.IncWebhookDeliveries(ruleID, false)
+	return err
+}
+
+// send makes a single delivery attempt
+func (c *Client) send(ctx context.Context, hook *config.Webhook, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(hook.RequestTimeout())*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, hook.RequestMethod(), hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseDrain))
+
+	if !hook.IsSuccess(resp.StatusCode) {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// retryable reports whether a failed attempt may succeed if repeated
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	switch {
+	case statusErr.StatusCode == http.StatusRequestTimeout,
+		statusErr.StatusCode == http.StatusTooManyRequests:
+		return true
+	case statusErr.StatusCode >= 400 && statusErr.StatusCode < 500:
+		return false
+	}
+	return true
+}